@@ -0,0 +1,256 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// the highest bitrates in bits per second the formats are expected to have, a duration
+// shorter than the file takes at this bitrate comes from a forged header
+const (
+	maxPcmBitrate          = 96000 * 24 * 2 // 96 kHz, 24 bit, stereo
+	maxMp3Bitrate          = 320000
+	maxOggBitrate          = 512000
+	maxMp4Bitrate          = 44100 * 16 * 2 // CD quality, which also covers lossless alac
+	audioDurationTolerance = 1.0            // seconds, for the headers of very short files
+)
+
+// GetAudioDuration returns the duration in seconds of an uploaded audio file,
+// it supports wav, mp3, flac, ogg (vorbis & opus) and mp4/m4a containers
+func GetAudioDuration(data []byte) (float64, error) {
+	var duration float64
+	var maxBitrate float64
+	var err error
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		duration, err = getWavDuration(data)
+		maxBitrate = maxPcmBitrate
+	case len(data) >= 4 && string(data[0:4]) == "fLaC":
+		duration, err = getFlacDuration(data)
+		maxBitrate = maxPcmBitrate
+	case len(data) >= 4 && string(data[0:4]) == "OggS":
+		duration, err = getOggDuration(data)
+		maxBitrate = maxOggBitrate
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		duration, err = getMp4Duration(data)
+		maxBitrate = maxMp4Bitrate
+	case len(data) >= 3 && string(data[0:3]) == "ID3",
+		len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		duration, err = getMp3Duration(data)
+		maxBitrate = maxMp3Bitrate
+	default:
+		return 0, errors.New("unsupported audio format")
+	}
+	if err != nil {
+		return 0, err
+	}
+	// the duration is read from headers of the uploaded file, which is billed by it
+	if duration+audioDurationTolerance < float64(len(data))*8/maxBitrate {
+		return 0, fmt.Errorf("implausible audio duration %.2fs for %d bytes", duration, len(data))
+	}
+	return duration, nil
+}
+
+func getWavDuration(data []byte) (float64, error) {
+	var byteRate uint32
+	offset := 12
+	for offset+8 <= len(data) {
+		chunkId := string(data[offset : offset+4])
+		chunkSize := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		offset += 8
+		switch chunkId {
+		case "fmt ":
+			if offset+12 > len(data) {
+				return 0, errors.New("invalid wav fmt chunk")
+			}
+			byteRate = binary.LittleEndian.Uint32(data[offset+8 : offset+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("invalid wav byte rate")
+			}
+			// streamed wav files may leave the size unset
+			if chunkSize == 0 || chunkSize == 0xFFFFFFFF || offset+int(chunkSize) > len(data) {
+				chunkSize = uint32(len(data) - offset)
+			}
+			return float64(chunkSize) / float64(byteRate), nil
+		}
+		offset += int(chunkSize) + int(chunkSize%2)
+	}
+	return 0, errors.New("wav data chunk not found")
+}
+
+var mp3Bitrates = [2][3][16]int{
+	// MPEG-1, layer I, II, III
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	// MPEG-2 & 2.5, layer I, II, III
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mp3SampleRates = map[int][3]int{
+	3: {44100, 48000, 32000}, // MPEG-1
+	2: {22050, 24000, 16000}, // MPEG-2
+	0: {11025, 12000, 8000},  // MPEG-2.5
+}
+
+func getMp3Duration(data []byte) (float64, error) {
+	offset := 0
+	if len(data) >= 10 && string(data[0:3]) == "ID3" {
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		offset = 10 + size
+		if data[5]&0x10 != 0 {
+			offset += 10 // footer present
+		}
+	}
+	duration := 0.0
+	frames := 0
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF || data[offset+1]&0xE0 != 0xE0 {
+			offset++
+			continue
+		}
+		version := int(data[offset+1]>>3) & 0x03
+		layer := int(data[offset+1]>>1) & 0x03
+		bitrateIndex := int(data[offset+2]>>4) & 0x0F
+		sampleRateIndex := int(data[offset+2]>>2) & 0x03
+		padding := int(data[offset+2]>>1) & 0x01
+		if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+			offset++
+			continue
+		}
+		versionIndex := 0
+		if version != 3 {
+			versionIndex = 1
+		}
+		layerIndex := 3 - layer // 0: layer I, 1: layer II, 2: layer III
+		bitrate := mp3Bitrates[versionIndex][layerIndex][bitrateIndex] * 1000
+		sampleRate := mp3SampleRates[version][sampleRateIndex]
+		var frameLength, samples int
+		switch layerIndex {
+		case 0:
+			frameLength = (12*bitrate/sampleRate + padding) * 4
+			samples = 384
+		case 1:
+			frameLength = 144*bitrate/sampleRate + padding
+			samples = 1152
+		default:
+			if version == 3 {
+				frameLength = 144*bitrate/sampleRate + padding
+				samples = 1152
+			} else {
+				frameLength = 72*bitrate/sampleRate + padding
+				samples = 576
+			}
+		}
+		if frameLength <= 0 {
+			offset++
+			continue
+		}
+		duration += float64(samples) / float64(sampleRate)
+		frames++
+		offset += frameLength
+	}
+	if frames == 0 {
+		return 0, errors.New("no mp3 frame found")
+	}
+	return duration, nil
+}
+
+func getFlacDuration(data []byte) (float64, error) {
+	// the first metadata block is always STREAMINFO
+	if len(data) < 8+18 || data[4]&0x7F != 0 {
+		return 0, errors.New("invalid flac stream info")
+	}
+	info := data[8:]
+	sampleRate := int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	totalSamples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	if sampleRate == 0 {
+		return 0, errors.New("invalid flac sample rate")
+	}
+	return float64(totalSamples) / float64(sampleRate), nil
+}
+
+func getOggDuration(data []byte) (float64, error) {
+	sampleRate := 0
+	preSkip := 0
+	if i := bytes.Index(data, []byte("OpusHead")); i >= 0 && i+12 <= len(data) {
+		sampleRate = 48000 // opus granule positions are always in 48kHz
+		preSkip = int(binary.LittleEndian.Uint16(data[i+10 : i+12]))
+	} else if i := bytes.Index(data, []byte("\x01vorbis")); i >= 0 && i+16 <= len(data) {
+		sampleRate = int(binary.LittleEndian.Uint32(data[i+12 : i+16]))
+	}
+	if sampleRate == 0 {
+		return 0, errors.New("unsupported ogg codec")
+	}
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || last+14 > len(data) {
+		return 0, errors.New("invalid ogg page")
+	}
+	granule := int64(binary.LittleEndian.Uint64(data[last+6 : last+14]))
+	if granule <= int64(preSkip) {
+		return 0, errors.New("invalid ogg granule position")
+	}
+	return float64(granule-int64(preSkip)) / float64(sampleRate), nil
+}
+
+func getMp4Duration(data []byte) (float64, error) {
+	mvhd := findMp4Box(data, "moov", "mvhd")
+	if mvhd == nil || len(mvhd) < 20 {
+		return 0, errors.New("mp4 mvhd box not found")
+	}
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return 0, errors.New("invalid mp4 mvhd box")
+		}
+		timescale = binary.BigEndian.Uint32(mvhd[20:24])
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(mvhd[12:16])
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, errors.New("invalid mp4 timescale")
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// findMp4Box walks the nested boxes by type and returns the payload of the last one
+func findMp4Box(data []byte, path ...string) []byte {
+	for offset := 0; offset+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[offset : offset+4]))
+		boxType := string(data[offset+4 : offset+8])
+		header := uint64(8)
+		if size == 1 {
+			if offset+16 > len(data) {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(data[offset+8 : offset+16])
+			header = 16
+		} else if size == 0 {
+			size = uint64(len(data) - offset)
+		}
+		if size < header || uint64(offset)+size > uint64(len(data)) {
+			return nil
+		}
+		if boxType == path[0] {
+			payload := data[uint64(offset)+header : uint64(offset)+size]
+			if len(path) == 1 {
+				return payload
+			}
+			return findMp4Box(payload, path[1:]...)
+		}
+		offset += int(size)
+	}
+	return nil
+}
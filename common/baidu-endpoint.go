@@ -0,0 +1,56 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const BaiduWenxinworkshopURL = "https://aip.baidubce.com/rpc/2.0/ai_custom/v1/wenxinworkshop"
+
+// BaiduModelEndpoints maps the models to the endpoints of wenxinworkshop,
+// an endpoint is a path relative to BaiduWenxinworkshopURL, e.g. chat/completions_pro,
+// or a full url, custom deployed models can be added in the same way
+// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/Nlks5zkzu
+var BaiduModelEndpoints = map[string]string{
+	"ERNIE-Bot":          "chat/completions",
+	"ERNIE-Bot-turbo":    "chat/eb-instant",
+	"ERNIE-Bot-4":        "chat/completions_pro",
+	"BLOOMZ-7B":          "chat/bloomz_7b1",
+	"ERNIE-4.0-8K":       "chat/completions_pro",
+	"ERNIE-4.0-Turbo-8K": "chat/ernie-4.0-turbo-8k",
+	"ERNIE-3.5-8K":       "chat/completions",
+	"ERNIE-Speed-8K":     "chat/ernie_speed",
+	"ERNIE-Speed-128K":   "chat/ernie-speed-128k",
+	"ERNIE-Lite-8K":      "chat/ernie-lite-8k",
+	"ERNIE-Tiny-8K":      "chat/ernie-tiny-8k",
+	"ERNIE-Character-8K": "chat/ernie-char-8k",
+	"Embedding-V1":       "embeddings/embedding-v1",
+	"bge-large-zh":       "embeddings/bge_large_zh",
+	"bge-large-en":       "embeddings/bge_large_en",
+	"tao-8k":             "embeddings/tao_8k",
+}
+
+func BaiduModelEndpoints2JSONString() string {
+	jsonBytes, err := json.Marshal(BaiduModelEndpoints)
+	if err != nil {
+		SysError("error marshalling baidu model endpoints: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateBaiduModelEndpointsByJSONString(jsonStr string) error {
+	BaiduModelEndpoints = make(map[string]string)
+	return json.Unmarshal([]byte(jsonStr), &BaiduModelEndpoints)
+}
+
+// GetBaiduModelEndpoint returns the full url of the model, or false if the model is not configured
+func GetBaiduModelEndpoint(name string) (string, bool) {
+	endpoint, ok := BaiduModelEndpoints[name]
+	if !ok || endpoint == "" {
+		return "", false
+	}
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint, true
+	}
+	return BaiduWenxinworkshopURL + "/" + strings.TrimPrefix(endpoint, "/"), true
+}
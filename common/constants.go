@@ -18,6 +18,7 @@ var Logo = ""
 var TopUpLink = ""
 var ChatLink = ""
 var QuotaPerUnit = 500 * 1000.0 // $0.002 / 1K tokens
+var USD2RMB = 7.0               // CNY per USD, used to convert the balances of channels in CNY
 var DisplayInCurrencyEnabled = true
 var DisplayTokenStatEnabled = true
 
@@ -73,10 +74,20 @@ var WeChatAccountQRCodeImageURL = ""
 var TurnstileSiteKey = ""
 var TurnstileSecretKey = ""
 
+var StripeSecretKey = ""
+var StripeWebhookSecret = ""
+var PaymentCurrency = "usd"
+var PaymentPrice = 1.0  // price of QuotaPerUnit quota in PaymentCurrency
+var PaymentMinTopUp = 1 // minimal units of quota per order
+
+// PaymentFakeEnabled enables a local payment provider which marks any order as paid, only for development!
+var PaymentFakeEnabled = os.Getenv("PAYMENT_FAKE_ENABLED") == "true"
+
 var QuotaForNewUser = 0
 var QuotaForInviter = 0
 var QuotaForInvitee = 0
 var ChannelDisableThreshold = 5.0
+var ChannelExhaustionWarningHours = 24.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
 var QuotaRemindThreshold = 1000
@@ -98,6 +109,15 @@ var BatchUpdateInterval = GetOrDefault("BATCH_UPDATE_INTERVAL", 5)
 
 var RelayTimeout = GetOrDefault("RELAY_TIMEOUT", 0) // unit is second
 
+// the quota reserved by a request is released after this time if the request is never settled
+var QuotaReservationTimeout = GetOrDefault("QUOTA_RESERVATION_TIMEOUT", 30*60) // unit is second
+
+// the maximum number of requests a realtime connection can run at the same time
+var RealtimeMaxConcurrentRequests = GetOrDefault("REALTIME_MAX_CONCURRENT_REQUESTS", 8)
+
+var MaxImageSize = GetOrDefault("MAX_IMAGE_SIZE", 20)           // unit is MB
+var ImageFetchTimeout = GetOrDefault("IMAGE_FETCH_TIMEOUT", 30) // unit is second
+
 const (
 	RequestIdKey = "X-Request-Trace"
 )
@@ -162,6 +182,22 @@ const (
 	ChannelStatusAutoDisabled     = 3
 )
 
+const (
+	WebhookStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	WebhookStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	PlanStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	PlanStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	TopUpOrderStatusPending = 1 // don't use 0, 0 is the default value!
+	TopUpOrderStatusPaid    = 2 // also don't use 0
+	TopUpOrderStatusFailed  = 3
+)
+
 const (
 	ChannelTypeUnknown        = 0
 	ChannelTypeOpenAI         = 1
@@ -188,6 +224,15 @@ const (
 	ChannelTypeFastGPT        = 22
 	ChannelTypeTencent        = 23
 	ChannelTypeGemini         = 24
+	ChannelTypeAwsBedrock     = 25
+	ChannelTypeVertexAI       = 26
+	ChannelTypeOllama         = 27
+	ChannelTypeCohere         = 28
+	ChannelTypeMistral        = 29
+	ChannelTypeDeepSeek       = 30
+	ChannelTypeMoonshot       = 31
+	ChannelTypeGroq           = 32
+	ChannelTypeSiliconFlow    = 33
 )
 
 var ChannelBaseURLs = []string{
@@ -216,4 +261,13 @@ var ChannelBaseURLs = []string{
 	"https://fastgpt.run/api/openapi",   // 22
 	"https://hunyuan.cloud.tencent.com", //23
 	"",                                  //24
+	"",                                  //25
+	"",                                  //26
+	"http://localhost:11434",            //27
+	"https://api.cohere.ai",             //28
+	"https://api.mistral.ai",            //29
+	"https://api.deepseek.com",          //30
+	"https://api.moonshot.cn",           //31
+	"https://api.groq.com/openai",       //32
+	"https://api.siliconflow.cn",        //33
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"io"
+	"mime/multipart"
 	"strings"
 )
 
@@ -20,9 +21,22 @@ func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	contentType := c.Request.Header.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/json") {
 		err = json.Unmarshal(requestBody, &v)
-	} else {
-		// skip for now
-		// TODO: someday non json request have variant model, we will need to implementation this
+	} else if strings.HasPrefix(contentType, "multipart/form-data") {
+		// only string fields can be read from a form, e.g. the model of audio requests
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		var form *multipart.Form
+		form, err = c.MultipartForm()
+		if err == nil {
+			values := make(map[string]string)
+			for key, value := range form.Value {
+				values[key] = value[0]
+			}
+			var data []byte
+			data, err = json.Marshal(values)
+			if err == nil {
+				err = json.Unmarshal(data, &v)
+			}
+		}
 	}
 	if err != nil {
 		return err
@@ -42,19 +56,42 @@ func UnmarshalBodyIsVersionModel(c *gin.Context) bool {
 		return false
 	}
 
+	// Reset request body
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+
 	v := struct {
-		Model string `json:"model"`
+		Model    string `json:"model"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
 	}{}
+	type contentPart struct {
+		Type string `json:"type"`
+	}
 
 	err = json.Unmarshal(requestBody, &v)
 	if err != nil {
 		return false
 	}
-	// Reset request body
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
 	if strings.Index(v.Model, "vision") > -1 {
 		return true
 	}
+	// array content may be text only, the request is only a vision request if it carries images
+	for _, message := range v.Messages {
+		content := bytes.TrimSpace(message.Content)
+		if len(content) == 0 || content[0] != '[' {
+			continue
+		}
+		var parts []contentPart
+		if json.Unmarshal(content, &parts) != nil {
+			continue
+		}
+		for _, part := range parts {
+			if part.Type == "image_url" {
+				return true
+			}
+		}
+	}
 	return false
 }
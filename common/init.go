@@ -13,16 +13,20 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+	Reconcile    = flag.Bool("reconcile", false, "check that the quota of every user matches the quota ledger and exit")
+	ReconcileFix = flag.Bool("reconcile-fix", false, "with --reconcile, record the differences in the quota ledger")
 )
 
 func printHelp() {
 	fmt.Println("One API " + Version + " - All in one API service for OpenAI API.")
 	fmt.Println("Copyright (C) 2023 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/songquanpeng/one-api")
-	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--reconcile [--reconcile-fix]] [--version] [--help]")
 }
 
-func init() {
+// Init parses the command line flags and creates the log directory, it is called by main
+// rather than in init, so test binaries keep their own flags
+func Init() {
 	flag.Parse()
 
 	if *PrintVersion {
@@ -35,16 +39,6 @@ func init() {
 		os.Exit(0)
 	}
 
-	if os.Getenv("SESSION_SECRET") != "" {
-		if os.Getenv("SESSION_SECRET") == "random_string" {
-			SysError("SESSION_SECRET is set to an example value, please change it to a random string.")
-		} else {
-			SessionSecret = os.Getenv("SESSION_SECRET")
-		}
-	}
-	if os.Getenv("SQLITE_PATH") != "" {
-		SQLitePath = os.Getenv("SQLITE_PATH")
-	}
 	if *LogDir != "" {
 		var err error
 		*LogDir, err = filepath.Abs(*LogDir)
@@ -59,3 +53,16 @@ func init() {
 		}
 	}
 }
+
+func init() {
+	if os.Getenv("SESSION_SECRET") != "" {
+		if os.Getenv("SESSION_SECRET") == "random_string" {
+			SysError("SESSION_SECRET is set to an example value, please change it to a random string.")
+		} else {
+			SessionSecret = os.Getenv("SESSION_SECRET")
+		}
+	}
+	if os.Getenv("SQLITE_PATH") != "" {
+		SQLitePath = os.Getenv("SQLITE_PATH")
+	}
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// ModelPrice is the price of a model in ModelPriceCurrency, the token prices are per
+// 1M tokens, a model with a price is billed by the price instead of ModelRatio and
+// CompletionRatio
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"` // 0 means the input price
+	PerRequest  float64 `json:"per_request,omitempty"`  // the fixed fee of a request, or of an image
+}
+
+var ModelPrices = map[string]ModelPrice{}
+
+var ModelPriceCurrency = "USD"
+
+// ModelPriceExchangeRate is the amount of ModelPriceCurrency per USD, QuotaPerUnit is the quota of 1 USD
+var ModelPriceExchangeRate = 1.0
+
+func ModelPrices2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelPrices)
+	if err != nil {
+		SysError("error marshalling model prices: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelPricesByJSONString(jsonStr string) error {
+	ModelPrices = make(map[string]ModelPrice)
+	return json.Unmarshal([]byte(jsonStr), &ModelPrices)
+}
+
+// getModelPriceQuota returns the quota per token of a price of 1 per 1M tokens
+func getModelPriceQuota() float64 {
+	if ModelPriceExchangeRate <= 0 {
+		return QuotaPerUnit / 1000000
+	}
+	return QuotaPerUnit / ModelPriceExchangeRate / 1000000
+}
+
+// ModelBilling is the quota of a model per token and per request, without a group ratio applied
+type ModelBilling struct {
+	InputRatio       float64
+	OutputRatio      float64
+	CachedInputRatio float64
+	RequestQuota     float64
+}
+
+func GetModelBilling(name string) ModelBilling {
+	price, ok := ModelPrices[name]
+	if !ok {
+		modelRatio := GetModelRatio(name)
+		return ModelBilling{
+			InputRatio:       modelRatio,
+			OutputRatio:      modelRatio * GetCompletionRatio(name),
+			CachedInputRatio: modelRatio,
+		}
+	}
+	return price.Billing()
+}
+
+func (price ModelPrice) Billing() ModelBilling {
+	quota := getModelPriceQuota()
+	billing := ModelBilling{
+		InputRatio:       price.Input * quota,
+		OutputRatio:      price.Output * quota,
+		CachedInputRatio: price.Input * quota,
+		RequestQuota:     price.PerRequest * quota * 1000000,
+	}
+	if price.CachedInput > 0 {
+		billing.CachedInputRatio = price.CachedInput * quota
+	}
+	return billing
+}
+
+// Quota returns the quota of a request, cachedTokens are part of promptTokens
+func (billing ModelBilling) Quota(promptTokens int, cachedTokens int, completionTokens int, groupRatio float64) int {
+	if cachedTokens > promptTokens {
+		cachedTokens = promptTokens
+	}
+	quota := float64(promptTokens-cachedTokens)*billing.InputRatio +
+		float64(cachedTokens)*billing.CachedInputRatio +
+		float64(completionTokens)*billing.OutputRatio +
+		billing.RequestQuota
+	// round off the floating point error first, e.g. 1000.0000000001 should not become 1001
+	return int(math.Ceil(math.Round(quota*groupRatio*1000000) / 1000000))
+}
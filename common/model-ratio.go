@@ -3,7 +3,6 @@ package common
 import (
 	"encoding/json"
 	"strings"
-	"time"
 )
 
 var DalleSizeRatios = map[string]map[string]float64{
@@ -78,27 +77,108 @@ var ModelRatio = map[string]float64{
 	"claude-2":                  5.51,   // $11.02 / 1M tokens
 	"claude-2.0":                5.51,   // $11.02 / 1M tokens
 	"claude-2.1":                5.51,   // $11.02 / 1M tokens
+	"claude-3-haiku-20240307":   0.125,  // $0.25 / 1M tokens
+	"claude-3-sonnet-20240229":  1.5,    // $3 / 1M tokens
+	"claude-3-opus-20240229":    7.5,    // $15 / 1M tokens
+	"llama2-13b-chat":           0.375,  // $0.75 / 1M tokens
+	"llama2-70b-chat":           0.975,  // $1.95 / 1M tokens
+	"mistral-7b-instruct":       0.075,  // $0.15 / 1M tokens
+	"mixtral-8x7b-instruct":     0.225,  // $0.45 / 1M tokens
+	"mistral-large":             4,      // $8 / 1M tokens
+	"titan-text-lite":           0.075,  // $0.15 / 1M tokens
+	"titan-text-express":        0.1,    // $0.2 / 1M tokens
 	"ERNIE-Bot":                 0.8572, // ￥0.012 / 1k tokens
 	"ERNIE-Bot-turbo":           0.5715, // ￥0.008 / 1k tokens
 	"ERNIE-Bot-4":               8.572,  // ￥0.12 / 1k tokens
 	"Embedding-V1":              0.1429, // ￥0.002 / 1k tokens
+	"ERNIE-4.0-8K":              8.572,  // ￥0.12 / 1k tokens
+	"ERNIE-4.0-Turbo-8K":        2.143,  // ￥0.03 / 1k tokens
+	"ERNIE-3.5-8K":              0.8572, // ￥0.012 / 1k tokens
+	"ERNIE-Speed-8K":            0,      // free
+	"ERNIE-Speed-128K":          0,      // free
+	"ERNIE-Lite-8K":             0,      // free
+	"ERNIE-Tiny-8K":             0,      // free
+	"ERNIE-Character-8K":        0.2857, // ￥0.004 / 1k tokens
+	"bge-large-zh":              0.0357, // ￥0.0005 / 1k tokens
+	"bge-large-en":              0.0357, // ￥0.0005 / 1k tokens
+	"tao-8k":                    0.0357, // ￥0.0005 / 1k tokens
 	"PaLM-2":                    1,
-	"gemini-pro":                1,      // $0.00025 / 1k characters -> $0.001 / 1k tokens
+	"gemini-pro":                1, // $0.00025 / 1k characters -> $0.001 / 1k tokens
+	"gemini-pro-vision":         1, // $0.00025 / 1k characters -> $0.001 / 1k tokens
+	"embedding-001":             0.05,
+	"text-embedding-004":        0.05,
 	"chatglm_turbo":             0.3572, // ￥0.005 / 1k tokens
 	"chatglm_pro":               0.7143, // ￥0.01 / 1k tokens
 	"chatglm_std":               0.3572, // ￥0.005 / 1k tokens
 	"chatglm_lite":              0.1429, // ￥0.002 / 1k tokens
+	"glm-4v":                    7.143,  // ￥0.1 / 1k tokens
+	"glm-4":                     7.143,  // ￥0.1 / 1k tokens
+	"glm-3-turbo":               0.3572, // ￥0.005 / 1k tokens
+	"embedding-2":               0.0357, // ￥0.0005 / 1k tokens
+	"text_embedding":            0.0357, // ￥0.0005 / 1k tokens
 	"qwen-turbo":                0.5715, // ￥0.008 / 1k tokens  // https://help.aliyun.com/zh/dashscope/developer-reference/tongyi-thousand-questions-metering-and-billing
 	"qwen-plus":                 1.4286, // ￥0.02 / 1k tokens
 	"qwen-max":                  1.4286, // ￥0.02 / 1k tokens
 	"qwen-max-longcontext":      1.4286, // ￥0.02 / 1k tokens
+	"qwen-vl-plus":              0.5715, // ￥0.008 / 1k tokens
+	"qwen-vl-max":               1.4286, // ￥0.02 / 1k tokens
 	"text-embedding-v1":         0.05,   // ￥0.0007 / 1k tokens
+	"text-embedding-v2":         0.05,   // ￥0.0007 / 1k tokens
+	"gte-rerank":                0.0572, // ￥0.0008 / 1k tokens
 	"SparkDesk":                 1.2858, // ￥0.018 / 1k tokens
+	"SparkDesk-v1.1":            1.2858, // ￥0.018 / 1k tokens
+	"SparkDesk-v2.1":            1.2858, // ￥0.018 / 1k tokens
+	"SparkDesk-v3.1":            1.2858, // ￥0.018 / 1k tokens
+	"SparkDesk-pro-128k":        1.2858, // ￥0.018 / 1k tokens
+	"SparkDesk-v3.5":            1.2858, // ￥0.018 / 1k tokens
+	"SparkDesk-v4.0":            1.2858, // ￥0.018 / 1k tokens
+	"xunfei-embedding":          0.0715,
 	"360GPT_S2_V9":              0.8572, // ¥0.012 / 1k tokens
 	"embedding-bert-512-v1":     0.0715, // ¥0.001 / 1k tokens
 	"embedding_s1_v1":           0.0715, // ¥0.001 / 1k tokens
 	"semantic_similarity_s1_v1": 0.0715, // ¥0.001 / 1k tokens
 	"hunyuan":                   7.143,  // ¥0.1 / 1k tokens  // https://cloud.tencent.com/document/product/1729/97731#e0e6be58-60c8-469f-bdeb-6c264ce3b4d0
+	"hunyuan-embedding":         0.05,   // ¥0.0007 / 1k tokens
+	"hunyuan-lite":              0,      // free
+	"hunyuan-standard":          0.3214, // ¥0.0045 / 1k tokens
+	"hunyuan-standard-256K":     1.0714, // ¥0.015 / 1k tokens
+	"hunyuan-pro":               2.1429, // ¥0.03 / 1k tokens
+	"tencent-tts":               14.286, // ¥0.0002 / character
+	"tencent-asr":               1.143,  // ¥0.0032 / minute -> ¥0.0032 / 200 tokens
+	"jina-reranker-v1-base-en":  0.01,   // $0.02 / 1M tokens
+	"jina-reranker-v1-turbo-en": 0.01,   // $0.02 / 1M tokens
+	"bge-reranker-v2-m3":        0.01,
+	"command":                   0.5,  // $1 / 1M tokens  // https://cohere.com/pricing
+	"command-light":             0.15, // $0.3 / 1M tokens
+	"command-r":                 0.25, // $0.5 / 1M tokens
+	"command-r-plus":            1.5,  // $3 / 1M tokens
+	"embed-english-v3.0":        0.05, // $0.1 / 1M tokens
+	"embed-multilingual-v3.0":   0.05, // $0.1 / 1M tokens
+	"rerank-english-v3.0":       1000, // $2 / 1k search units, billed per search unit
+	"rerank-multilingual-v3.0":  1000, // $2 / 1k search units, billed per search unit
+	// https://mistral.ai/technology/#pricing
+	"open-mistral-7b":       0.125, // $0.25 / 1M tokens
+	"open-mixtral-8x7b":     0.35,  // $0.7 / 1M tokens
+	"open-mixtral-8x22b":    1,     // $2 / 1M tokens
+	"mistral-small-latest":  1,     // $2 / 1M tokens
+	"mistral-medium-latest": 1.35,  // $2.7 / 1M tokens
+	"mistral-large-latest":  4,     // $8 / 1M tokens
+	"mistral-embed":         0.05,  // $0.1 / 1M tokens
+	// https://platform.deepseek.com/api-docs/pricing
+	"deepseek-chat":  0.0715, // ￥1 / 1M tokens
+	"deepseek-coder": 0.0715, // ￥1 / 1M tokens
+	// https://platform.moonshot.cn/pricing
+	"moonshot-v1-8k":   0.8572, // ￥0.012 / 1k tokens
+	"moonshot-v1-32k":  1.7143, // ￥0.024 / 1k tokens
+	"moonshot-v1-128k": 4.2857, // ￥0.06 / 1k tokens
+	// https://wow.groq.com/
+	"llama3-8b-8192":     0.025, // $0.05 / 1M tokens
+	"llama3-70b-8192":    0.295, // $0.59 / 1M tokens
+	"mixtral-8x7b-32768": 0.12,  // $0.24 / 1M tokens
+	"gemma-7b-it":        0.035, // $0.07 / 1M tokens
+	// https://siliconflow.cn/pricing
+	"deepseek-ai/DeepSeek-V2-Chat": 0.095, // ￥1.33 / 1M tokens
+	"Qwen/Qwen2-72B-Instruct":      0.295, // ￥4.13 / 1M tokens
 }
 
 func ModelRatio2JSONString() string {
@@ -115,6 +195,9 @@ func UpdateModelRatioByJSONString(jsonStr string) error {
 }
 
 func GetModelRatio(name string) float64 {
+	if price, ok := ModelPrices[name]; ok {
+		return price.Input * getModelPriceQuota()
+	}
 	ratio, ok := ModelRatio[name]
 	if !ok {
 		SysError("model ratio not found: " + name)
@@ -123,33 +206,100 @@ func GetModelRatio(name string) float64 {
 	return ratio
 }
 
+// CompletionRatio is the price of completion tokens relative to prompt tokens, a key
+// with a * matches any model with the text before and after it, the longest matching
+// key is used for models not listed by name, other models use 1
+var CompletionRatio = map[string]float64{
+	"ERNIE-4.0-Turbo-8K":       2,
+	"ERNIE-Character-8K":       2,
+	"claude-2":                 2.965517,
+	"claude-2*":                2.965517,
+	"claude-2.0":               2.965517,
+	"claude-2.1":               2.965517,
+	"claude-3*":                5,
+	"claude-3-haiku-20240307":  5,
+	"claude-3-opus-20240229":   5,
+	"claude-3-sonnet-20240229": 5,
+	"claude-instant-1":         3.38,
+	"claude-instant-1*":        3.38,
+	"command":                  2,
+	"command-light":            2,
+	"command-r":                3,
+	"command-r-plus":           5,
+	"deepseek-chat":            2,
+	"deepseek-coder":           2,
+	"gpt-3.5*":                 1.333333,
+	"gpt-3.5*1106":             2,
+	"gpt-3.5-turbo":            2,
+	"gpt-3.5-turbo-0301":       1.333333,
+	"gpt-3.5-turbo-0613":       1.333333,
+	"gpt-3.5-turbo-1106":       2,
+	"gpt-3.5-turbo-16k":        2,
+	"gpt-3.5-turbo-16k-0613":   1.333333,
+	"gpt-3.5-turbo-instruct":   1.333333,
+	"gpt-4":                    2,
+	"gpt-4*":                   2,
+	"gpt-4*preview":            3,
+	"gpt-4-0314":               2,
+	"gpt-4-0613":               2,
+	"gpt-4-1106-preview":       3,
+	"gpt-4-32k":                2,
+	"gpt-4-32k-0314":           2,
+	"gpt-4-32k-0613":           2,
+	"gpt-4-vision-preview":     3,
+	"hunyuan-pro":              3.333333,
+	"hunyuan-standard":         1.111111,
+	"hunyuan-standard-256K":    4,
+	"llama2-13b-chat":          1.333333,
+	"llama2-70b-chat":          1.312821,
+	"llama3-70b-8192":          1.338983,
+	"llama3-8b-8192":           1.6,
+	"mistral-7b-instruct":      1.333333,
+	"mistral-large":            3,
+	"mistral-large-latest":     3,
+	"mistral-medium-latest":    3,
+	"mistral-small-latest":     3,
+	"mixtral-8x7b-instruct":    1.555556,
+	"open-mixtral-8x22b":       3,
+	"titan-text-express":       3,
+	"titan-text-lite":          1.333333,
+}
+
+func CompletionRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(CompletionRatio)
+	if err != nil {
+		SysError("error marshalling completion ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCompletionRatioByJSONString(jsonStr string) error {
+	CompletionRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &CompletionRatio)
+}
+
 func GetCompletionRatio(name string) float64 {
-	if strings.HasPrefix(name, "gpt-3.5") {
-		if strings.HasSuffix(name, "1106") {
-			return 2
+	if price, ok := ModelPrices[name]; ok && price.Input > 0 {
+		return price.Output / price.Input
+	}
+	if ratio, ok := CompletionRatio[name]; ok {
+		return ratio
+	}
+	ratio := 1.0
+	matched := ""
+	for key, value := range CompletionRatio {
+		prefix, suffix, ok := strings.Cut(key, "*")
+		if !ok || len(name) < len(prefix)+len(suffix) {
+			continue
 		}
-		if name == "gpt-3.5-turbo" || name == "gpt-3.5-turbo-16k" {
-			// TODO: clear this after 2023-12-11
-			now := time.Now()
-			// https://platform.openai.com/docs/models/continuous-model-upgrades
-			// if after 2023-12-11, use 2
-			if now.After(time.Date(2023, 12, 11, 0, 0, 0, 0, time.UTC)) {
-				return 2
-			}
+		// keys of the same length are compared so the result does not depend on the map order
+		if len(key) < len(matched) || len(key) == len(matched) && key > matched {
+			continue
 		}
-		return 1.333333
-	}
-	if strings.HasPrefix(name, "gpt-4") {
-		if strings.HasSuffix(name, "preview") {
-			return 3
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+			ratio = value
+			matched = key
 		}
-		return 2
-	}
-	if strings.HasPrefix(name, "claude-instant-1") {
-		return 3.38
 	}
-	if strings.HasPrefix(name, "claude-2") {
-		return 2.965517
-	}
-	return 1
+	return ratio
 }
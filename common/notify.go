@@ -0,0 +1,454 @@
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// notification events
+const (
+	NotifyEventChannelDisabled     = "channel_disabled"
+	NotifyEventChannelEnabled      = "channel_enabled"
+	NotifyEventChannelTestFinished = "channel_test_finished"
+	NotifyEventChannelBalanceLow   = "channel_balance_low"
+	NotifyEventQuotaLow            = "quota_low"
+	NotifyEventQuotaExhausted      = "quota_exhausted"
+)
+
+// notifier names, also used as the notify channel of users
+const (
+	NotifierEmail    = "email"
+	NotifierWebhook  = "webhook"
+	NotifierSlack    = "slack"
+	NotifierTelegram = "telegram"
+	NotifierDingTalk = "dingtalk"
+	NotifierFeishu   = "feishu"
+	NotifierWeCom    = "wecom"
+	NotifierNone     = "none"
+)
+
+var NotifyWebhookURL = ""
+var NotifyWebhookSecret = ""
+var NotifySlackWebhookURL = ""
+var NotifyTelegramBotToken = ""
+var NotifyTelegramChatId = ""
+var NotifyDingTalkWebhookURL = ""
+var NotifyDingTalkSecret = ""
+var NotifyFeishuWebhookURL = ""
+var NotifyFeishuSecret = ""
+var NotifyWeComWebhookURL = ""
+
+// NotificationRouting maps the event to the notifiers used to notify the root user
+var NotificationRouting = map[string][]string{
+	NotifyEventChannelDisabled:     {NotifierEmail},
+	NotifyEventChannelEnabled:      {NotifierEmail},
+	NotifyEventChannelTestFinished: {NotifierEmail},
+	NotifyEventChannelBalanceLow:   {NotifierEmail},
+	NotifyEventQuotaLow:            {},
+	NotifyEventQuotaExhausted:      {},
+}
+
+func NotificationRouting2JSONString() string {
+	jsonBytes, err := json.Marshal(NotificationRouting)
+	if err != nil {
+		SysError("error marshalling notification routing: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateNotificationRoutingByJSONString(jsonStr string) error {
+	NotificationRouting = make(map[string][]string)
+	return json.Unmarshal([]byte(jsonStr), &NotificationRouting)
+}
+
+type Notification struct {
+	Event   string `json:"event"`
+	Subject string `json:"subject"`
+	Content string `json:"content"`
+}
+
+type Notifier interface {
+	Send(notification *Notification) error
+}
+
+var notifyHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// userNotifyHTTPClient is used for the urls set by users, it refuses to connect to internal
+// addresses, the check is done on the resolved address so it also covers redirects and dns rebinding,
+// no proxy is used since the proxy would be the address checked
+var userNotifyHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network string, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !isPublicIP(net.ParseIP(host)) {
+					return fmt.Errorf("address %s is not allowed", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !carrierGradeNAT.Contains(ip)
+}
+
+// validateUserNotifyURL only accepts https urls whose host resolves to public addresses
+func validateUserNotifyURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return errors.New("notify target must be an https url")
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve notify target: %s", err.Error())
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return errors.New("notify target must not point to an internal address")
+		}
+	}
+	return nil
+}
+
+func getNotifyHTTPClient(client *http.Client) *http.Client {
+	if client == nil {
+		return notifyHTTPClient
+	}
+	return client
+}
+
+func postNotification(client *http.Client, url string, headers map[string]string, data any) ([]byte, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := getNotifyHTTPClient(client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("status code: %d, body: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+type EmailNotifier struct {
+	Receiver string
+}
+
+func (n *EmailNotifier) Send(notification *Notification) error {
+	if n.Receiver == "" {
+		return errors.New("email receiver is empty")
+	}
+	return SendEmail(notification.Subject, n.Receiver, notification.Content)
+}
+
+// WebhookNotifier posts the notification as JSON, the body is signed with HMAC-SHA256
+// and the hex encoded signature is sent in the X-One-API-Signature header
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	client *http.Client
+}
+
+type webhookNotification struct {
+	Notification
+	Timestamp int64 `json:"timestamp"`
+}
+
+func (n *WebhookNotifier) Send(notification *Notification) error {
+	data := webhookNotification{
+		Notification: *notification,
+		Timestamp:    GetTimestamp(),
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if n.Secret != "" {
+		headers["X-One-API-Signature"] = HmacSHA256Hex(n.Secret, jsonData)
+	}
+	_, err = postNotification(n.client, n.URL, headers, json.RawMessage(jsonData))
+	return err
+}
+
+func HmacSHA256Hex(secret string, data []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SlackNotifier docs: https://api.slack.com/messaging/webhooks
+type SlackNotifier struct {
+	WebhookURL string
+	client     *http.Client
+}
+
+func (n *SlackNotifier) Send(notification *Notification) error {
+	_, err := postNotification(n.client, n.WebhookURL, nil, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", notification.Subject, notification.Content),
+	})
+	return err
+}
+
+// TelegramNotifier docs: https://core.telegram.org/bots/api#sendmessage
+type TelegramNotifier struct {
+	BotToken string
+	ChatId   string
+}
+
+func (n *TelegramNotifier) Send(notification *Notification) error {
+	requestURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.BotToken)
+	body, err := postNotification(nil, requestURL, nil, map[string]string{
+		"chat_id": n.ChatId,
+		"text":    fmt.Sprintf("%s\n%s", notification.Subject, notification.Content),
+	})
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return err
+	}
+	if !response.Ok {
+		return errors.New(response.Description)
+	}
+	return nil
+}
+
+type robotResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+}
+
+func (r *robotResponse) Error() error {
+	if r.ErrCode != 0 {
+		return fmt.Errorf("code: %d, message: %s", r.ErrCode, r.ErrMsg)
+	}
+	if r.Code != 0 {
+		return fmt.Errorf("code: %d, message: %s", r.Code, r.Msg)
+	}
+	return nil
+}
+
+func postRobotNotification(client *http.Client, url string, data any) error {
+	body, err := postNotification(client, url, nil, data)
+	if err != nil {
+		return err
+	}
+	var response robotResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return err
+	}
+	return response.Error()
+}
+
+// DingTalkNotifier docs: https://open.dingtalk.com/document/orgapp/custom-robots-send-group-messages
+type DingTalkNotifier struct {
+	WebhookURL string
+	Secret     string
+	client     *http.Client
+}
+
+func (n *DingTalkNotifier) Send(notification *Notification) error {
+	requestURL := n.WebhookURL
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		h := hmac.New(sha256.New, []byte(n.Secret))
+		h.Write([]byte(timestamp + "\n" + n.Secret))
+		sign := url.QueryEscape(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+		requestURL = fmt.Sprintf("%s&timestamp=%s&sign=%s", requestURL, timestamp, sign)
+	}
+	return postRobotNotification(n.client, requestURL, map[string]any{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": fmt.Sprintf("%s\n%s", notification.Subject, notification.Content),
+		},
+	})
+}
+
+// FeishuNotifier docs: https://open.feishu.cn/document/client-docs/bot-v3/add-custom-bot
+type FeishuNotifier struct {
+	WebhookURL string
+	Secret     string
+	client     *http.Client
+}
+
+func (n *FeishuNotifier) Send(notification *Notification) error {
+	data := map[string]any{
+		"msg_type": "text",
+		"content": map[string]string{
+			"text": fmt.Sprintf("%s\n%s", notification.Subject, notification.Content),
+		},
+	}
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		h := hmac.New(sha256.New, []byte(timestamp+"\n"+n.Secret))
+		data["timestamp"] = timestamp
+		data["sign"] = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+	return postRobotNotification(n.client, n.WebhookURL, data)
+}
+
+// WeComNotifier docs: https://developer.work.weixin.qq.com/document/path/91770
+type WeComNotifier struct {
+	WebhookURL string
+	client     *http.Client
+}
+
+func (n *WeComNotifier) Send(notification *Notification) error {
+	return postRobotNotification(n.client, n.WebhookURL, map[string]any{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": fmt.Sprintf("%s\n%s", notification.Subject, notification.Content),
+		},
+	})
+}
+
+// GetSystemNotifier returns the notifier configured in options, email is sent to the root user
+func GetSystemNotifier(name string) (Notifier, error) {
+	switch name {
+	case NotifierEmail:
+		return &EmailNotifier{Receiver: RootUserEmail}, nil
+	case NotifierWebhook:
+		if NotifyWebhookURL == "" {
+			break
+		}
+		return &WebhookNotifier{URL: NotifyWebhookURL, Secret: NotifyWebhookSecret}, nil
+	case NotifierSlack:
+		if NotifySlackWebhookURL == "" {
+			break
+		}
+		return &SlackNotifier{WebhookURL: NotifySlackWebhookURL}, nil
+	case NotifierTelegram:
+		if NotifyTelegramBotToken == "" || NotifyTelegramChatId == "" {
+			break
+		}
+		return &TelegramNotifier{BotToken: NotifyTelegramBotToken, ChatId: NotifyTelegramChatId}, nil
+	case NotifierDingTalk:
+		if NotifyDingTalkWebhookURL == "" {
+			break
+		}
+		return &DingTalkNotifier{WebhookURL: NotifyDingTalkWebhookURL, Secret: NotifyDingTalkSecret}, nil
+	case NotifierFeishu:
+		if NotifyFeishuWebhookURL == "" {
+			break
+		}
+		return &FeishuNotifier{WebhookURL: NotifyFeishuWebhookURL, Secret: NotifyFeishuSecret}, nil
+	case NotifierWeCom:
+		if NotifyWeComWebhookURL == "" {
+			break
+		}
+		return &WeComNotifier{WebhookURL: NotifyWeComWebhookURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier: %s", name)
+	}
+	return nil, fmt.Errorf("notifier %s is not configured", name)
+}
+
+// GetUserNotifier returns the notifier chosen by the user, the target is the webhook url or
+// the telegram chat id, email is sent to the email address of the user, webhook urls must be
+// https urls of public hosts, since the requests are sent from the server
+func GetUserNotifier(name string, target string, secret string, email string) (Notifier, error) {
+	switch name {
+	case "", NotifierEmail:
+		return &EmailNotifier{Receiver: email}, nil
+	case NotifierNone:
+		return nil, nil
+	}
+	if target == "" {
+		return nil, fmt.Errorf("notify target of %s is empty", name)
+	}
+	switch name {
+	case NotifierWebhook, NotifierSlack, NotifierDingTalk, NotifierFeishu, NotifierWeCom:
+		if err := validateUserNotifyURL(target); err != nil {
+			return nil, err
+		}
+	}
+	switch name {
+	case NotifierWebhook:
+		return &WebhookNotifier{URL: target, Secret: secret, client: userNotifyHTTPClient}, nil
+	case NotifierSlack:
+		return &SlackNotifier{WebhookURL: target, client: userNotifyHTTPClient}, nil
+	case NotifierTelegram:
+		if NotifyTelegramBotToken == "" {
+			return nil, errors.New("telegram bot is not configured")
+		}
+		return &TelegramNotifier{BotToken: NotifyTelegramBotToken, ChatId: target}, nil
+	case NotifierDingTalk:
+		return &DingTalkNotifier{WebhookURL: target, Secret: secret, client: userNotifyHTTPClient}, nil
+	case NotifierFeishu:
+		return &FeishuNotifier{WebhookURL: target, Secret: secret, client: userNotifyHTTPClient}, nil
+	case NotifierWeCom:
+		return &WeComNotifier{WebhookURL: target, client: userNotifyHTTPClient}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier: %s", name)
+}
+
+// NotifyRoot sends the notification through the notifiers routed for the event
+func NotifyRoot(event string, subject string, content string) {
+	notification := &Notification{
+		Event:   event,
+		Subject: subject,
+		Content: content,
+	}
+	for _, name := range NotificationRouting[event] {
+		notifier, err := GetSystemNotifier(name)
+		if err != nil {
+			SysError(fmt.Sprintf("failed to get notifier for event %s: %s", event, err.Error()))
+			continue
+		}
+		err = notifier.Send(notification)
+		if err != nil {
+			SysError(fmt.Sprintf("failed to send %s notification via %s: %s", event, name, err.Error()))
+		}
+	}
+}
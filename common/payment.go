@@ -0,0 +1,33 @@
+package common
+
+import (
+	"math"
+	"strings"
+)
+
+// zero-decimal and three-decimal currencies, the others have two decimal places
+// https://stripe.com/docs/currencies#zero-decimal
+var currencyMinorUnitExponents = map[string]int{
+	"bif": 0, "clp": 0, "djf": 0, "gnf": 0, "jpy": 0, "kmf": 0, "krw": 0, "mga": 0,
+	"pyg": 0, "rwf": 0, "ugx": 0, "vnd": 0, "vuv": 0, "xaf": 0, "xof": 0, "xpf": 0,
+	"bhd": 3, "jod": 3, "kwd": 3, "omr": 3, "tnd": 3,
+}
+
+// GetCurrencyMinorUnitExponent returns the number of decimal places of the currency,
+// amounts sent to payment providers are in the minor unit, e.g. cents for usd
+func GetCurrencyMinorUnitExponent(currency string) int {
+	if exponent, ok := currencyMinorUnitExponents[strings.ToLower(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// PaymentAmount2MinorUnit converts an amount in the currency to its minor unit
+func PaymentAmount2MinorUnit(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(GetCurrencyMinorUnitExponent(currency))))
+}
+
+// PaymentMinorUnit2Amount converts an amount in the minor unit back to the currency
+func PaymentMinorUnit2Amount(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(GetCurrencyMinorUnitExponent(currency))
+}
@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 func OpenBrowser(url string) {
@@ -196,6 +197,17 @@ func GetOrDefault(env string, defaultValue int) int {
 	return num
 }
 
+// TruncateString cuts s to at most maxBytes bytes without splitting a multi-byte character
+func TruncateString(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
+
 func MessageWithRequestId(message string, id string) string {
 	return fmt.Sprintf("%s (request id: %s)", message, id)
 }
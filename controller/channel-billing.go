@@ -9,6 +9,7 @@ import (
 	"one-api/common"
 	"one-api/model"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -77,6 +78,40 @@ type APGC2DGPTUsageResponse struct {
 	TotalUsed      float64 `json:"total_used"`
 }
 
+type OpenRouterCreditsResponse struct {
+	Data struct {
+		TotalCredits float64 `json:"total_credits"`
+		TotalUsage   float64 `json:"total_usage"`
+	} `json:"data"`
+}
+
+// DeepSeekUserBalanceResponse docs: https://platform.deepseek.com/api-docs/zh-cn/api/get-user-balance
+type DeepSeekUserBalanceResponse struct {
+	IsAvailable  bool `json:"is_available"`
+	BalanceInfos []struct {
+		Currency     string `json:"currency"`
+		TotalBalance string `json:"total_balance"`
+	} `json:"balance_infos"`
+}
+
+type MoonshotUserBalanceResponse struct {
+	Code   int    `json:"code"`
+	Error  string `json:"error"`
+	Status bool   `json:"status"`
+	Data   struct {
+		AvailableBalance float64 `json:"available_balance"`
+	} `json:"data"`
+}
+
+type SiliconFlowUserInfoResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  bool   `json:"status"`
+	Data    struct {
+		TotalBalance string `json:"totalBalance"`
+	} `json:"data"`
+}
+
 // GetAuthHeader get auth header
 func GetAuthHeader(token string) http.Header {
 	h := http.Header{}
@@ -199,33 +234,95 @@ func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
 	return response.TotalAvailable, nil
 }
 
-func updateChannelBalance(channel *model.Channel) (float64, error) {
-	baseURL := common.ChannelBaseURLs[channel.Type]
-	if channel.GetBaseURL() == "" {
-		channel.BaseURL = &baseURL
+// updateChannelOpenRouterBalance returns the remaining credits in USD
+func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/v1/credits", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := OpenRouterCreditsResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+	balance := response.Data.TotalCredits - response.Data.TotalUsage
+	channel.UpdateBalance(balance)
+	return balance, nil
+}
+
+// updateChannelDeepSeekBalance returns the balance in CNY
+func updateChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/user/balance", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := DeepSeekUserBalanceResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
 	}
-	switch channel.Type {
-	case common.ChannelTypeOpenAI:
-		if channel.GetBaseURL() != "" {
-			baseURL = channel.GetBaseURL()
+	for _, info := range response.BalanceInfos {
+		if info.Currency != "CNY" {
+			continue
 		}
-	case common.ChannelTypeAzure:
-		return 0, errors.New("尚未实现")
-	case common.ChannelTypeCustom:
-		baseURL = channel.GetBaseURL()
-	case common.ChannelTypeCloseAI:
-		return updateChannelCloseAIBalance(channel)
-	case common.ChannelTypeOpenAISB:
-		return updateChannelOpenAISBBalance(channel)
-	case common.ChannelTypeAIProxy:
-		return updateChannelAIProxyBalance(channel)
-	case common.ChannelTypeAPI2GPT:
-		return updateChannelAPI2GPTBalance(channel)
-	case common.ChannelTypeAIGC2D:
-		return updateChannelAIGC2DBalance(channel)
-	default:
-		return 0, errors.New("尚未实现")
+		balance, err := strconv.ParseFloat(info.TotalBalance, 64)
+		if err != nil {
+			return 0, err
+		}
+		channel.UpdateBalance(balance)
+		return balance, nil
+	}
+	return 0, errors.New("no CNY balance found")
+}
+
+// updateChannelMoonshotBalance returns the balance in CNY
+func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/v1/users/me/balance", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := MoonshotUserBalanceResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+	if !response.Status {
+		return 0, fmt.Errorf("code: %d, message: %s", response.Code, response.Error)
+	}
+	balance := response.Data.AvailableBalance
+	channel.UpdateBalance(balance)
+	return balance, nil
+}
+
+// updateChannelSiliconFlowBalance returns the balance in CNY
+func updateChannelSiliconFlowBalance(channel *model.Channel) (float64, error) {
+	url := fmt.Sprintf("%s/v1/user/info", channel.GetBaseURL())
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	if err != nil {
+		return 0, err
+	}
+	response := SiliconFlowUserInfoResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return 0, err
+	}
+	if !response.Status {
+		return 0, fmt.Errorf("code: %d, message: %s", response.Code, response.Message)
 	}
+	balance, err := strconv.ParseFloat(response.Data.TotalBalance, 64)
+	if err != nil {
+		return 0, err
+	}
+	channel.UpdateBalance(balance)
+	return balance, nil
+}
+
+// updateChannelOpenAIBalance works for OpenAI and the OpenAI compatible dashboard billing APIs
+func updateChannelOpenAIBalance(channel *model.Channel) (float64, error) {
+	baseURL := channel.GetBaseURL()
 	url := fmt.Sprintf("%s/v1/dashboard/billing/subscription", baseURL)
 
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
@@ -258,6 +355,99 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 	return balance, nil
 }
 
+// channelBalanceUpdaters maps the channel type to its balance adapter,
+// the balance is stored in the currency of the upstream
+var channelBalanceUpdaters = map[int]func(channel *model.Channel) (float64, error){
+	common.ChannelTypeOpenAI:      updateChannelOpenAIBalance,
+	common.ChannelTypeCustom:      updateChannelOpenAIBalance,
+	common.ChannelTypeCloseAI:     updateChannelCloseAIBalance,
+	common.ChannelTypeOpenAISB:    updateChannelOpenAISBBalance,
+	common.ChannelTypeAIProxy:     updateChannelAIProxyBalance,
+	common.ChannelTypeAPI2GPT:     updateChannelAPI2GPTBalance,
+	common.ChannelTypeAIGC2D:      updateChannelAIGC2DBalance,
+	common.ChannelTypeOpenRouter:  updateChannelOpenRouterBalance,
+	common.ChannelTypeDeepSeek:    updateChannelDeepSeekBalance,
+	common.ChannelTypeMoonshot:    updateChannelMoonshotBalance,
+	common.ChannelTypeSiliconFlow: updateChannelSiliconFlowBalance,
+}
+
+func updateChannelBalance(channel *model.Channel) (float64, error) {
+	updater, ok := channelBalanceUpdaters[channel.Type]
+	if !ok {
+		return 0, errors.New("尚未实现")
+	}
+	if channel.GetBaseURL() == "" {
+		baseURL := common.ChannelBaseURLs[channel.Type]
+		channel.BaseURL = &baseURL
+	}
+	balance, err := updater(channel)
+	if err != nil {
+		return 0, err
+	}
+	updateChannelBalanceForecast(channel, balance)
+	return balance, nil
+}
+
+// getChannelBalanceUnitsPerUSD returns how many balance units one USD is worth, 0 means unknown
+func getChannelBalanceUnitsPerUSD(channelType int) float64 {
+	switch channelType {
+	case common.ChannelTypeOpenAI, common.ChannelTypeCustom, common.ChannelTypeOpenRouter:
+		return 1
+	case common.ChannelTypeCloseAI, common.ChannelTypeAPI2GPT, common.ChannelTypeDeepSeek, common.ChannelTypeMoonshot, common.ChannelTypeSiliconFlow:
+		return common.USD2RMB
+	case common.ChannelTypeOpenAISB:
+		return common.USD2RMB * 10000
+	default:
+		return 0
+	}
+}
+
+// updateChannelBalanceForecast estimates the burn rate from the used quota of the channel,
+// predicts when the balance runs out and sends an alert before that happens
+func updateChannelBalanceForecast(channel *model.Channel, balance float64) {
+	now := common.GetTimestamp()
+	unitsPerUSD := getChannelBalanceUnitsPerUSD(channel.Type)
+	elapsed := now - channel.BurnRateUpdatedTime
+	if channel.BurnRateUpdatedTime == 0 || channel.UsedQuota < channel.BurnRateUsedQuota {
+		channel.BurnRateUsedQuota = channel.UsedQuota
+		channel.BurnRateUpdatedTime = now
+	} else if elapsed >= 60 && unitsPerUSD > 0 {
+		usedBalance := float64(channel.UsedQuota-channel.BurnRateUsedQuota) / common.QuotaPerUnit * unitsPerUSD
+		burnRate := usedBalance / (float64(elapsed) / 3600)
+		if channel.BurnRate > 0 {
+			// smooth the estimate to avoid alerting on a short burst
+			burnRate = (channel.BurnRate + burnRate) / 2
+		}
+		channel.BurnRate = burnRate
+		channel.BurnRateUsedQuota = channel.UsedQuota
+		channel.BurnRateUpdatedTime = now
+	}
+	channel.ExhaustionTime = 0
+	if balance <= 0 {
+		channel.ExhaustionTime = now
+	} else if channel.BurnRate > 0 {
+		channel.ExhaustionTime = now + int64(balance/channel.BurnRate*3600)
+	}
+
+	reason := ""
+	threshold := channel.GetBalanceThreshold()
+	if balance > 0 && threshold > 0 && balance < threshold {
+		reason = fmt.Sprintf("余额 %.2f 低于预警阈值 %.2f", balance, threshold)
+	} else if balance > 0 && channel.IsRunningDry() {
+		reason = fmt.Sprintf("余额 %.2f，按当前消耗速度预计将于 %s 耗尽", balance, time.Unix(channel.ExhaustionTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	if reason == "" {
+		channel.BalanceAlertTime = 0
+	} else if now-channel.BalanceAlertTime > 24*3600 {
+		// alert at most once a day while the channel stays low
+		subject := fmt.Sprintf("通道「%s」（#%d）余额不足", channel.Name, channel.Id)
+		content := fmt.Sprintf("通道「%s」（#%d）%s，请及时充值", channel.Name, channel.Id, reason)
+		notifyRootUser(common.NotifyEventChannelBalanceLow, subject, content)
+		channel.BalanceAlertTime = now
+	}
+	channel.UpdateBalanceForecast()
+}
+
 func UpdateChannelBalance(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -291,22 +481,67 @@ func UpdateChannelBalance(c *gin.Context) {
 	return
 }
 
-func updateAllChannelsBalance() error {
-	channels, err := model.GetAllChannels(0, 0, true)
+type ChannelBalanceUpdateProgress struct {
+	Running   bool  `json:"running"`
+	Total     int   `json:"total"`
+	Finished  int   `json:"finished"`
+	Succeeded int   `json:"succeeded"`
+	Failed    int   `json:"failed"`
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+}
+
+var updateAllChannelsBalanceLock sync.Mutex
+var updateAllChannelsBalanceProgress ChannelBalanceUpdateProgress
+
+func getChannelBalanceUpdateProgress() ChannelBalanceUpdateProgress {
+	updateAllChannelsBalanceLock.Lock()
+	defer updateAllChannelsBalanceLock.Unlock()
+	return updateAllChannelsBalanceProgress
+}
+
+// prepareAllChannelsBalanceUpdate marks the update as running and returns the channels to update
+func prepareAllChannelsBalanceUpdate() ([]*model.Channel, error) {
+	updateAllChannelsBalanceLock.Lock()
+	defer updateAllChannelsBalanceLock.Unlock()
+	if updateAllChannelsBalanceProgress.Running {
+		return nil, errors.New("余额更新已在运行中")
+	}
+	allChannels, err := model.GetAllChannels(0, 0, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, channel := range channels {
+	var channels []*model.Channel
+	for _, channel := range allChannels {
 		if channel.Status != common.ChannelStatusEnabled {
 			continue
 		}
-		// TODO: support Azure
-		if channel.Type != common.ChannelTypeOpenAI && channel.Type != common.ChannelTypeCustom {
+		if _, ok := channelBalanceUpdaters[channel.Type]; !ok {
 			continue
 		}
+		channels = append(channels, channel)
+	}
+	updateAllChannelsBalanceProgress = ChannelBalanceUpdateProgress{
+		Running:   true,
+		Total:     len(channels),
+		StartTime: common.GetTimestamp(),
+	}
+	return channels, nil
+}
+
+func updateChannelsBalance(channels []*model.Channel) {
+	for _, channel := range channels {
 		balance, err := updateChannelBalance(channel)
+		updateAllChannelsBalanceLock.Lock()
+		updateAllChannelsBalanceProgress.Finished++
 		if err != nil {
-			continue
+			updateAllChannelsBalanceProgress.Failed++
+		} else {
+			updateAllChannelsBalanceProgress.Succeeded++
+		}
+		updateAllChannelsBalanceLock.Unlock()
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update balance of channel #%d: %s", channel.Id, err.Error()))
 		} else {
 			// err is nil & balance <= 0 means quota is used up
 			if balance <= 0 {
@@ -315,22 +550,45 @@ func updateAllChannelsBalance() error {
 		}
 		time.Sleep(common.RequestInterval)
 	}
+	updateAllChannelsBalanceLock.Lock()
+	updateAllChannelsBalanceProgress.Running = false
+	updateAllChannelsBalanceProgress.EndTime = common.GetTimestamp()
+	updateAllChannelsBalanceLock.Unlock()
+}
+
+func updateAllChannelsBalance() error {
+	channels, err := prepareAllChannelsBalanceUpdate()
+	if err != nil {
+		return err
+	}
+	updateChannelsBalance(channels)
 	return nil
 }
 
 func UpdateAllChannelsBalance(c *gin.Context) {
-	// TODO: make it async
-	err := updateAllChannelsBalance()
+	channels, err := prepareAllChannelsBalanceUpdate()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
+			"data":    getChannelBalanceUpdateProgress(),
 		})
 		return
 	}
+	go updateChannelsBalance(channels)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    getChannelBalanceUpdateProgress(),
+	})
+	return
+}
+
+func GetAllChannelsBalanceUpdateProgress(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    getChannelBalanceUpdateProgress(),
 	})
 	return
 }
@@ -5,9 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/http/httptest"
 	"one-api/common"
+	"one-api/middleware"
 	"one-api/model"
 	"strconv"
 	"strings"
@@ -17,97 +18,154 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func testChannel(channel *model.Channel, request ChatRequest) (err error, openaiErr *OpenAIError) {
-	switch channel.Type {
-	case common.ChannelTypePaLM:
-		fallthrough
-	case common.ChannelTypeGemini:
-		fallthrough
-	case common.ChannelTypeAnthropic:
-		fallthrough
-	case common.ChannelTypeBaidu:
-		fallthrough
-	case common.ChannelTypeZhipu:
-		fallthrough
-	case common.ChannelTypeAli:
-		fallthrough
-	case common.ChannelType360:
-		fallthrough
-	case common.ChannelTypeXunfei:
-		return errors.New("该渠道类型当前版本不支持测试，请手动测试"), nil
-	case common.ChannelTypeAzure:
-		request.Model = "gpt-35-turbo"
-		defer func() {
-			if err != nil {
-				err = errors.New("请确保已在 Azure 上创建了 gpt-35-turbo 模型，并且 apiVersion 已正确填写！")
-			}
-		}()
-	default:
-		request.Model = "gpt-3.5-turbo"
+// channelTestRecorder records the time the first byte of the response is written
+type channelTestRecorder struct {
+	*httptest.ResponseRecorder
+	firstWriteTime time.Time
+}
+
+func (r *channelTestRecorder) Write(b []byte) (int, error) {
+	if r.firstWriteTime.IsZero() && len(b) > 0 {
+		r.firstWriteTime = time.Now()
 	}
-	requestURL := common.ChannelBaseURLs[channel.Type]
-	if channel.Type == common.ChannelTypeAzure {
-		requestURL = getFullRequestURL(channel.GetBaseURL(), fmt.Sprintf("/openai/deployments/%s/chat/completions?api-version=2023-03-15-preview", request.Model), channel.Type)
-	} else {
-		if baseURL := channel.GetBaseURL(); len(baseURL) > 0 {
-			requestURL = baseURL
+	return r.ResponseRecorder.Write(b)
+}
+
+func (r *channelTestRecorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+func (r *channelTestRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// keywords of models which can not be tested with a chat request
+var nonChatModelKeywords = []string{"embed", "bge-", "tao-", "rerank", "tts", "whisper", "dall-e", "moderation", "asr"}
+
+func isEmbeddingModel(modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	return strings.Contains(modelName, "embed") || strings.HasPrefix(modelName, "bge-") || strings.HasPrefix(modelName, "tao-")
+}
+
+func isChatModel(modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	for _, keyword := range nonChatModelKeywords {
+		if strings.Contains(modelName, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// getTestModel picks the model used to test the channel: the one chosen by the admin,
+// then the test model of the channel, then the first chat model of the channel
+func getTestModel(channel *model.Channel, modelName string) string {
+	if modelName != "" {
+		return modelName
+	}
+	if testModel := channel.GetTestModel(); testModel != "" {
+		return testModel
+	}
+	var models []string
+	for _, m := range strings.Split(channel.Models, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	for _, m := range models {
+		if isChatModel(m) {
+			return m
 		}
+	}
+	if len(models) > 0 {
+		return models[0]
+	}
+	return "gpt-3.5-turbo"
+}
 
-		requestURL = getFullRequestURL(requestURL, "/v1/chat/completions", channel.Type)
+// testChannel sends a minimal request through the same relay path as real traffic,
+// so the provider specific conversion is tested as well
+func testChannel(channel *model.Channel, modelName string) (err error, openaiErr *OpenAIErrorWithStatusCode, firstTokenTime int64) {
+	relayMode := RelayModeChatCompletions
+	requestPath := "/v1/chat/completions"
+	var request any = ChatRequest{
+		Model:     modelName,
+		Messages:  []Message{{Role: "user", Content: "hi"}},
+		MaxTokens: 1,
+		Stream:    true,
+	}
+	if isEmbeddingModel(modelName) {
+		relayMode = RelayModeEmbeddings
+		requestPath = "/v1/embeddings"
+		request = GeneralOpenAIRequest{
+			Model: modelName,
+			Input: "hi",
+		}
 	}
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return err, nil
+		return err, nil, 0
 	}
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(jsonData))
+	recorder := &channelTestRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request, err = http.NewRequest(http.MethodPost, requestPath, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return err, nil
+		return err, nil, 0
 	}
-	if channel.Type == common.ChannelTypeAzure {
-		req.Header.Set("api-key", channel.Key)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("channel_test", true)
+	c.Set("consume_quota", true)
+	c.Set("group", channel.Group)
+	middleware.SetupContextForSelectedChannel(c, channel)
+	tik := time.Now()
+	if relayMode == RelayModeChatCompletions && isVisionRequest(c) {
+		openaiErr = relayVisionHelper(c, relayMode)
 	} else {
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
+		openaiErr = relayTextHelper(c, relayMode)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return err, nil
+	if openaiErr != nil {
+		return fmt.Errorf("type %s, code %v, message %s", openaiErr.Type, openaiErr.Code, openaiErr.Message), openaiErr, 0
 	}
-	defer resp.Body.Close()
-	var response TextResponse
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err, nil
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("bad response status code %d: %s", recorder.Code, recorder.Body.String()), nil, 0
 	}
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		if resp.StatusCode == http.StatusOK {
-			if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") || resp.Header.Get("Transfer-Encoding") == "chunked" {
-				return nil, nil
-			}
-		}
-		return fmt.Errorf("Error: %s\nResp body: %s", err, body), nil
-	}
-	if response.Usage.CompletionTokens == 0 {
-		if response.Error.Message == "" {
-			response.Error.Message = "补全 tokens 非预期返回 0"
-		}
-		return errors.New(fmt.Sprintf("type %s, code %v, message %s", response.Error.Type, response.Error.Code, response.Error.Message)), &response.Error
+	if recorder.Body.Len() == 0 {
+		return errors.New("empty response"), nil, 0
 	}
-	return nil, nil
+	return nil, nil, recorder.firstWriteTime.Sub(tik).Milliseconds()
 }
 
-func buildTestRequest() *ChatRequest {
-	testRequest := &ChatRequest{
-		Model:     "", // this will be set later
-		MaxTokens: 1,
+// processChannelTestResult records the test result and disables or enables the channel if needed
+func processChannelTestResult(channel *model.Channel, milliseconds int64, firstTokenTime int64, err error, openaiErr *OpenAIErrorWithStatusCode) {
+	isChannelEnabled := channel.Status == common.ChannelStatusEnabled
+	var disableThreshold = int64(common.ChannelDisableThreshold * 1000)
+	if disableThreshold == 0 {
+		disableThreshold = 10000000 // a impossible value
+	}
+	if err == nil && milliseconds > disableThreshold {
+		err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0))
+		if isChannelEnabled {
+			disableChannel(channel.Id, channel.Name, err.Error())
+		}
 	}
-	testMessage := Message{
-		Role:    "user",
-		Content: "hi",
+	var openAIError *OpenAIError
+	statusCode := -1
+	if openaiErr != nil {
+		openAIError = &openaiErr.OpenAIError
+		statusCode = openaiErr.StatusCode
 	}
-	testRequest.Messages = append(testRequest.Messages, testMessage)
-	return testRequest
+	if isChannelEnabled && shouldDisableChannel(openAIError, statusCode) {
+		disableChannel(channel.Id, channel.Name, err.Error())
+	}
+	// channels disabled by the admin stay disabled
+	if channel.Status == common.ChannelStatusAutoDisabled && shouldEnableChannel(err, openAIError) {
+		enableChannel(channel.Id, channel.Name)
+	}
+	testError := ""
+	if err != nil {
+		testError = err.Error()
+	}
+	channel.UpdateTestResult(milliseconds, firstTokenTime, testError)
 }
 
 func TestChannel(c *gin.Context) {
@@ -127,25 +185,28 @@ func TestChannel(c *gin.Context) {
 		})
 		return
 	}
-	testRequest := buildTestRequest()
+	testModel := getTestModel(channel, c.Query("model"))
 	tik := time.Now()
-	err, _ = testChannel(channel, *testRequest)
+	err, openaiErr, firstTokenTime := testChannel(channel, testModel)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
-	go channel.UpdateResponseTime(milliseconds)
+	go processChannelTestResult(channel, milliseconds, firstTokenTime, err, openaiErr)
 	consumedTime := float64(milliseconds) / 1000.0
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
 			"time":    consumedTime,
+			"model":   testModel,
 		})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"time":    consumedTime,
+		"success":          true,
+		"message":          "",
+		"time":             consumedTime,
+		"first_token_time": float64(firstTokenTime) / 1000.0,
+		"model":            testModel,
 	})
 	return
 }
@@ -153,14 +214,12 @@ func TestChannel(c *gin.Context) {
 var testAllChannelsLock sync.Mutex
 var testAllChannelsRunning bool = false
 
-func notifyRootUser(subject string, content string) {
+// notifyRootUser sends the notification through the notifiers routed for the event
+func notifyRootUser(event string, subject string, content string) {
 	if common.RootUserEmail == "" {
 		common.RootUserEmail = model.GetRootUserEmail()
 	}
-	err := common.SendEmail(subject, common.RootUserEmail, content)
-	if err != nil {
-		common.SysError(fmt.Sprintf("failed to send email: %s", err.Error()))
-	}
+	common.NotifyRoot(event, subject, content)
 }
 
 // disable & notify
@@ -168,7 +227,7 @@ func disableChannel(channelId int, channelName string, reason string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusAutoDisabled)
 	subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelName, channelId)
 	content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelName, channelId, reason)
-	notifyRootUser(subject, content)
+	notifyRootUser(common.NotifyEventChannelDisabled, subject, content)
 }
 
 // enable & notify
@@ -176,7 +235,7 @@ func enableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled)
 	subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 	content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
-	notifyRootUser(subject, content)
+	notifyRootUser(common.NotifyEventChannelEnabled, subject, content)
 }
 
 func testAllChannels(notify bool) error {
@@ -194,39 +253,20 @@ func testAllChannels(notify bool) error {
 	if err != nil {
 		return err
 	}
-	testRequest := buildTestRequest()
-	var disableThreshold = int64(common.ChannelDisableThreshold * 1000)
-	if disableThreshold == 0 {
-		disableThreshold = 10000000 // a impossible value
-	}
 	go func() {
 		for _, channel := range channels {
-			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
 			tik := time.Now()
-			err, openaiErr := testChannel(channel, *testRequest)
+			err, openaiErr, firstTokenTime := testChannel(channel, getTestModel(channel, ""))
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
-			if isChannelEnabled && milliseconds > disableThreshold {
-				err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0))
-				disableChannel(channel.Id, channel.Name, err.Error())
-			}
-			if isChannelEnabled && shouldDisableChannel(openaiErr, -1) {
-				disableChannel(channel.Id, channel.Name, err.Error())
-			}
-			if !isChannelEnabled && shouldEnableChannel(err, openaiErr) {
-				enableChannel(channel.Id, channel.Name)
-			}
-			channel.UpdateResponseTime(milliseconds)
+			processChannelTestResult(channel, milliseconds, firstTokenTime, err, openaiErr)
 			time.Sleep(common.RequestInterval)
 		}
 		testAllChannelsLock.Lock()
 		testAllChannelsRunning = false
 		testAllChannelsLock.Unlock()
 		if notify {
-			err := common.SendEmail("通道测试完成", common.RootUserEmail, "通道测试完成，如果没有收到禁用通知，说明所有通道都正常")
-			if err != nil {
-				common.SysError(fmt.Sprintf("failed to send email: %s", err.Error()))
-			}
+			notifyRootUser(common.NotifyEventChannelTestFinished, "通道测试完成", "通道测试完成，如果没有收到禁用通知，说明所有通道都正常")
 		}
 	}()
 	return nil
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
@@ -169,3 +171,93 @@ func UpdateChannel(c *gin.Context) {
 	})
 	return
 }
+
+// fetchChannelModels lists the models served by the upstream, ollama uses /api/tags,
+// while other channels are treated as OpenAI compatible servers providing /v1/models
+func fetchChannelModels(channel *model.Channel) ([]string, error) {
+	baseURL := common.ChannelBaseURLs[channel.Type]
+	if channel.GetBaseURL() != "" {
+		baseURL = channel.GetBaseURL()
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if baseURL == "" {
+		return nil, errors.New("base url of the channel is empty")
+	}
+	models := make([]string, 0)
+	if channel.Type == common.ChannelTypeOllama {
+		body, err := GetResponseBody("GET", baseURL+"/api/tags", channel, http.Header{})
+		if err != nil {
+			return nil, err
+		}
+		var response OllamaTagsResponse
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, model_ := range response.Models {
+			models = append(models, model_.Name)
+		}
+	} else {
+		body, err := GetResponseBody("GET", baseURL+"/v1/models", channel, GetAuthHeader(channel.Key))
+		if err != nil {
+			return nil, err
+		}
+		var response struct {
+			Data []OpenAIModels `json:"data"`
+		}
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, model_ := range response.Data {
+			models = append(models, model_.Id)
+		}
+	}
+	if len(models) == 0 {
+		return nil, errors.New("no model found")
+	}
+	return models, nil
+}
+
+func FetchChannelModels(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	models, err := fetchChannelModels(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// the abilities are rebuilt with the fetched models
+	channel.Models = strings.Join(models, ",")
+	err = channel.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    models,
+	})
+	return
+}
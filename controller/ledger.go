@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getQuotaStatement returns the ledger entries of the user in the time range, with the
+// balances at the start and the end of the range
+func getQuotaStatement(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if endTimestamp == 0 {
+		endTimestamp = common.GetTimestamp()
+	}
+	entries, err := model.GetQuotaLedgerEntries(userId, startTimestamp, endTimestamp, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err == nil {
+		var openingBalance, closingBalance int
+		openingBalance, err = model.GetQuotaBalanceAt(userId, startTimestamp-1)
+		if err == nil {
+			closingBalance, err = model.GetQuotaBalanceAt(userId, endTimestamp)
+		}
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": "",
+				"data": gin.H{
+					"entries":         entries,
+					"opening_balance": openingBalance,
+					"closing_balance": closingBalance,
+				},
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+func GetSelfQuotaStatement(c *gin.Context) {
+	getQuotaStatement(c, c.GetInt("id"))
+}
+
+// GetUserQuotaStatement is only mounted under the admin routes, and like GetUser
+// admins can only read the statements of users with a lower role
+func GetUserQuotaStatement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权获取同级或更高等级用户的信息",
+		})
+		return
+	}
+	getQuotaStatement(c, id)
+}
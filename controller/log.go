@@ -121,6 +121,28 @@ func GetLogsStat(c *gin.Context) {
 	return
 }
 
+// GetMarginReport reports the revenue and the upstream cost of the consume logs in a time range,
+// grouped by channel, model or group
+func GetMarginReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	groupBy := c.DefaultQuery("group_by", "channel")
+	reports, err := model.GetMarginReport(groupBy, startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    reports,
+	})
+	return
+}
+
 func GetLogsSelfStat(c *gin.Context) {
 	username := c.GetString("username")
 	logType, _ := strconv.Atoi(c.Query("type"))
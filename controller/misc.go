@@ -30,6 +30,10 @@ func GetStatus(c *gin.Context) {
 			"turnstile_check":     common.TurnstileCheckEnabled,
 			"turnstile_site_key":  common.TurnstileSiteKey,
 			"top_up_link":         common.TopUpLink,
+			"payment_providers":   getEnabledPaymentProviders(),
+			"payment_price":       common.PaymentPrice,
+			"payment_currency":    common.PaymentCurrency,
+			"payment_min_top_up":  common.PaymentMinTopUp,
 			"chat_link":           common.ChatLink,
 			"quota_per_unit":      common.QuotaPerUnit,
 			"display_in_currency": common.DisplayInCurrencyEnabled,
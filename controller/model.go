@@ -387,6 +387,96 @@ func init() {
 			Root:       "claude-2.0",
 			Parent:     nil,
 		},
+		{
+			Id:         "claude-3-haiku-20240307",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "anthropic",
+			Permission: permission,
+			Root:       "claude-3-haiku-20240307",
+			Parent:     nil,
+		},
+		{
+			Id:         "claude-3-sonnet-20240229",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "anthropic",
+			Permission: permission,
+			Root:       "claude-3-sonnet-20240229",
+			Parent:     nil,
+		},
+		{
+			Id:         "claude-3-opus-20240229",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "anthropic",
+			Permission: permission,
+			Root:       "claude-3-opus-20240229",
+			Parent:     nil,
+		},
+		{
+			Id:         "llama2-13b-chat",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "meta",
+			Permission: permission,
+			Root:       "llama2-13b-chat",
+			Parent:     nil,
+		},
+		{
+			Id:         "llama2-70b-chat",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "meta",
+			Permission: permission,
+			Root:       "llama2-70b-chat",
+			Parent:     nil,
+		},
+		{
+			Id:         "mistral-7b-instruct",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mistral-7b-instruct",
+			Parent:     nil,
+		},
+		{
+			Id:         "mixtral-8x7b-instruct",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mixtral-8x7b-instruct",
+			Parent:     nil,
+		},
+		{
+			Id:         "mistral-large",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mistral-large",
+			Parent:     nil,
+		},
+		{
+			Id:         "titan-text-lite",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "amazon",
+			Permission: permission,
+			Root:       "titan-text-lite",
+			Parent:     nil,
+		},
+		{
+			Id:         "titan-text-express",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "amazon",
+			Permission: permission,
+			Root:       "titan-text-express",
+			Parent:     nil,
+		},
 		{
 			Id:         "ERNIE-Bot",
 			Object:     "model",
@@ -423,6 +513,105 @@ func init() {
 			Root:       "Embedding-V1",
 			Parent:     nil,
 		},
+		{
+			Id:         "ERNIE-4.0-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-4.0-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-4.0-Turbo-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-4.0-Turbo-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-3.5-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-3.5-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-Speed-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-Speed-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-Speed-128K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-Speed-128K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-Lite-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-Lite-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-Tiny-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-Tiny-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "ERNIE-Character-8K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "ERNIE-Character-8K",
+			Parent:     nil,
+		},
+		{
+			Id:         "bge-large-zh",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "bge-large-zh",
+			Parent:     nil,
+		},
+		{
+			Id:         "bge-large-en",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "bge-large-en",
+			Parent:     nil,
+		},
+		{
+			Id:         "tao-8k",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baidu",
+			Permission: permission,
+			Root:       "tao-8k",
+			Parent:     nil,
+		},
 		{
 			Id:         "PaLM-2",
 			Object:     "model",
@@ -441,6 +630,33 @@ func init() {
 			Root:       "gemini-pro",
 			Parent:     nil,
 		},
+		{
+			Id:         "gemini-pro-vision",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "google",
+			Permission: permission,
+			Root:       "gemini-pro-vision",
+			Parent:     nil,
+		},
+		{
+			Id:         "embedding-001",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "google",
+			Permission: permission,
+			Root:       "embedding-001",
+			Parent:     nil,
+		},
+		{
+			Id:         "text-embedding-004",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "google",
+			Permission: permission,
+			Root:       "text-embedding-004",
+			Parent:     nil,
+		},
 		{
 			Id:         "chatglm_turbo",
 			Object:     "model",
@@ -477,6 +693,51 @@ func init() {
 			Root:       "chatglm_lite",
 			Parent:     nil,
 		},
+		{
+			Id:         "glm-4v",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "zhipu",
+			Permission: permission,
+			Root:       "glm-4v",
+			Parent:     nil,
+		},
+		{
+			Id:         "glm-4",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "zhipu",
+			Permission: permission,
+			Root:       "glm-4",
+			Parent:     nil,
+		},
+		{
+			Id:         "glm-3-turbo",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "zhipu",
+			Permission: permission,
+			Root:       "glm-3-turbo",
+			Parent:     nil,
+		},
+		{
+			Id:         "embedding-2",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "zhipu",
+			Permission: permission,
+			Root:       "embedding-2",
+			Parent:     nil,
+		},
+		{
+			Id:         "text_embedding",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "zhipu",
+			Permission: permission,
+			Root:       "text_embedding",
+			Parent:     nil,
+		},
 		{
 			Id:         "qwen-turbo",
 			Object:     "model",
@@ -513,6 +774,24 @@ func init() {
 			Root:       "qwen-max-longcontext",
 			Parent:     nil,
 		},
+		{
+			Id:         "qwen-vl-plus",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "ali",
+			Permission: permission,
+			Root:       "qwen-vl-plus",
+			Parent:     nil,
+		},
+		{
+			Id:         "qwen-vl-max",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "ali",
+			Permission: permission,
+			Root:       "qwen-vl-max",
+			Parent:     nil,
+		},
 		{
 			Id:         "text-embedding-v1",
 			Object:     "model",
@@ -522,6 +801,24 @@ func init() {
 			Root:       "text-embedding-v1",
 			Parent:     nil,
 		},
+		{
+			Id:         "text-embedding-v2",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "ali",
+			Permission: permission,
+			Root:       "text-embedding-v2",
+			Parent:     nil,
+		},
+		{
+			Id:         "gte-rerank",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "ali",
+			Permission: permission,
+			Root:       "gte-rerank",
+			Parent:     nil,
+		},
 		{
 			Id:         "SparkDesk",
 			Object:     "model",
@@ -531,6 +828,69 @@ func init() {
 			Root:       "SparkDesk",
 			Parent:     nil,
 		},
+		{
+			Id:         "SparkDesk-v1.1",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "SparkDesk-v1.1",
+			Parent:     nil,
+		},
+		{
+			Id:         "SparkDesk-v2.1",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "SparkDesk-v2.1",
+			Parent:     nil,
+		},
+		{
+			Id:         "SparkDesk-v3.1",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "SparkDesk-v3.1",
+			Parent:     nil,
+		},
+		{
+			Id:         "SparkDesk-pro-128k",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "SparkDesk-pro-128k",
+			Parent:     nil,
+		},
+		{
+			Id:         "SparkDesk-v3.5",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "SparkDesk-v3.5",
+			Parent:     nil,
+		},
+		{
+			Id:         "SparkDesk-v4.0",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "SparkDesk-v4.0",
+			Parent:     nil,
+		},
+		{
+			Id:         "xunfei-embedding",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "xunfei",
+			Permission: permission,
+			Root:       "xunfei-embedding",
+			Parent:     nil,
+		},
 		{
 			Id:         "360GPT_S2_V9",
 			Object:     "model",
@@ -576,6 +936,330 @@ func init() {
 			Root:       "hunyuan",
 			Parent:     nil,
 		},
+		{
+			Id:         "hunyuan-lite",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "hunyuan-lite",
+			Parent:     nil,
+		},
+		{
+			Id:         "hunyuan-standard",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "hunyuan-standard",
+			Parent:     nil,
+		},
+		{
+			Id:         "hunyuan-standard-256K",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "hunyuan-standard-256K",
+			Parent:     nil,
+		},
+		{
+			Id:         "hunyuan-pro",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "hunyuan-pro",
+			Parent:     nil,
+		},
+		{
+			Id:         "hunyuan-embedding",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "hunyuan-embedding",
+			Parent:     nil,
+		},
+		{
+			Id:         "tencent-tts",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "tencent-tts",
+			Parent:     nil,
+		},
+		{
+			Id:         "tencent-asr",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "tencent",
+			Permission: permission,
+			Root:       "tencent-asr",
+			Parent:     nil,
+		},
+		{
+			Id:         "jina-reranker-v1-base-en",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "jina",
+			Permission: permission,
+			Root:       "jina-reranker-v1-base-en",
+			Parent:     nil,
+		},
+		{
+			Id:         "jina-reranker-v1-turbo-en",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "jina",
+			Permission: permission,
+			Root:       "jina-reranker-v1-turbo-en",
+			Parent:     nil,
+		},
+		{
+			Id:         "bge-reranker-v2-m3",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "baai",
+			Permission: permission,
+			Root:       "bge-reranker-v2-m3",
+			Parent:     nil,
+		},
+		{
+			Id:         "command",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "command",
+			Parent:     nil,
+		},
+		{
+			Id:         "command-light",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "command-light",
+			Parent:     nil,
+		},
+		{
+			Id:         "command-r",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "command-r",
+			Parent:     nil,
+		},
+		{
+			Id:         "command-r-plus",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "command-r-plus",
+			Parent:     nil,
+		},
+		{
+			Id:         "embed-english-v3.0",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "embed-english-v3.0",
+			Parent:     nil,
+		},
+		{
+			Id:         "embed-multilingual-v3.0",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "embed-multilingual-v3.0",
+			Parent:     nil,
+		},
+		{
+			Id:         "rerank-english-v3.0",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "rerank-english-v3.0",
+			Parent:     nil,
+		},
+		{
+			Id:         "rerank-multilingual-v3.0",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "cohere",
+			Permission: permission,
+			Root:       "rerank-multilingual-v3.0",
+			Parent:     nil,
+		},
+		{
+			Id:         "open-mistral-7b",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "open-mistral-7b",
+			Parent:     nil,
+		},
+		{
+			Id:         "open-mixtral-8x7b",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "open-mixtral-8x7b",
+			Parent:     nil,
+		},
+		{
+			Id:         "open-mixtral-8x22b",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "open-mixtral-8x22b",
+			Parent:     nil,
+		},
+		{
+			Id:         "mistral-small-latest",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mistral-small-latest",
+			Parent:     nil,
+		},
+		{
+			Id:         "mistral-medium-latest",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mistral-medium-latest",
+			Parent:     nil,
+		},
+		{
+			Id:         "mistral-large-latest",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mistral-large-latest",
+			Parent:     nil,
+		},
+		{
+			Id:         "mistral-embed",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "mistralai",
+			Permission: permission,
+			Root:       "mistral-embed",
+			Parent:     nil,
+		},
+		{
+			Id:         "deepseek-chat",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "deepseek",
+			Permission: permission,
+			Root:       "deepseek-chat",
+			Parent:     nil,
+		},
+		{
+			Id:         "deepseek-coder",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "deepseek",
+			Permission: permission,
+			Root:       "deepseek-coder",
+			Parent:     nil,
+		},
+		{
+			Id:         "moonshot-v1-8k",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "moonshot",
+			Permission: permission,
+			Root:       "moonshot-v1-8k",
+			Parent:     nil,
+		},
+		{
+			Id:         "moonshot-v1-32k",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "moonshot",
+			Permission: permission,
+			Root:       "moonshot-v1-32k",
+			Parent:     nil,
+		},
+		{
+			Id:         "moonshot-v1-128k",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "moonshot",
+			Permission: permission,
+			Root:       "moonshot-v1-128k",
+			Parent:     nil,
+		},
+		{
+			Id:         "llama3-8b-8192",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "groq",
+			Permission: permission,
+			Root:       "llama3-8b-8192",
+			Parent:     nil,
+		},
+		{
+			Id:         "llama3-70b-8192",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "groq",
+			Permission: permission,
+			Root:       "llama3-70b-8192",
+			Parent:     nil,
+		},
+		{
+			Id:         "mixtral-8x7b-32768",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "groq",
+			Permission: permission,
+			Root:       "mixtral-8x7b-32768",
+			Parent:     nil,
+		},
+		{
+			Id:         "gemma-7b-it",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "groq",
+			Permission: permission,
+			Root:       "gemma-7b-it",
+			Parent:     nil,
+		},
+		{
+			Id:         "deepseek-ai/DeepSeek-V2-Chat",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "siliconflow",
+			Permission: permission,
+			Root:       "deepseek-ai/DeepSeek-V2-Chat",
+			Parent:     nil,
+		},
+		{
+			Id:         "Qwen/Qwen2-72B-Instruct",
+			Object:     "model",
+			Created:    1677649963,
+			OwnedBy:    "siliconflow",
+			Permission: permission,
+			Root:       "Qwen/Qwen2-72B-Instruct",
+			Parent:     nil,
+		},
 	}
 	openAIModelsMap = make(map[string]OpenAIModels)
 	for _, model := range openAIModels {
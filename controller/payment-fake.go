@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FakePaymentProvider is a local payment provider for development, it sends the
+// signed webhook a real provider would send once an admin visits the checkout url
+type FakePaymentProvider struct{}
+
+// the secret is derived from the session secret, so every node accepts the webhook
+var fakePaymentSecret = common.HmacSHA256Hex(common.SessionSecret, []byte("fake payment"))
+
+type FakePaymentNotification struct {
+	TradeNo  string `json:"trade_no"`
+	Status   int    `json:"status"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (provider *FakePaymentProvider) Enabled() bool {
+	return common.PaymentFakeEnabled
+}
+
+func (provider *FakePaymentProvider) CreateCheckout(order *model.TopUpOrder) (string, string, error) {
+	return fmt.Sprintf("%s/api/payment/fake/pay?trade_no=%s", common.ServerAddress, order.TradeNo), "", nil
+}
+
+func (provider *FakePaymentProvider) VerifyNotification(header http.Header, body []byte) (*PaymentNotification, error) {
+	err := verifyPaymentSignature(header.Get("X-Fake-Signature"), fakePaymentSecret, body)
+	if err != nil {
+		return nil, err
+	}
+	var notification FakePaymentNotification
+	err = json.Unmarshal(body, &notification)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentNotification{
+		TradeNo:  notification.TradeNo,
+		Status:   notification.Status,
+		Amount:   notification.Amount,
+		Currency: notification.Currency,
+	}, nil
+}
+
+func sendFakePaymentNotification(notification *FakePaymentNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/payment/webhook/%s", common.ServerAddress, PaymentProviderFake), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Fake-Signature", signPaymentPayload(fakePaymentSecret, body))
+	resp, err := paymentHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code: %d, body: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// FakePay is the checkout page of the fake payment provider, it pays the order at once,
+// only admins can use it since it credits quota without any payment
+func FakePay(c *gin.Context) {
+	if !common.PaymentFakeEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未启用模拟支付",
+		})
+		return
+	}
+	order, err := model.GetTopUpOrderByTradeNo(c.Query("trade_no"))
+	if err != nil || order.UserId != c.GetInt("id") || order.Provider != PaymentProviderFake {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的订单",
+		})
+		return
+	}
+	err = sendFakePaymentNotification(&FakePaymentNotification{
+		TradeNo:  order.TradeNo,
+		Status:   common.TopUpOrderStatusPaid,
+		Amount:   order.Amount,
+		Currency: order.Currency,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模拟支付回调失败：" + err.Error(),
+		})
+		return
+	}
+	c.Redirect(http.StatusFound, getPaymentReturnURL(order))
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+)
+
+// https://stripe.com/docs/api/checkout/sessions/create
+
+type StripeError struct {
+	Message string `json:"message"`
+}
+
+type StripeCheckoutSession struct {
+	Id                string       `json:"id"`
+	URL               string       `json:"url"`
+	ClientReferenceId string       `json:"client_reference_id"`
+	PaymentStatus     string       `json:"payment_status"`
+	AmountTotal       int64        `json:"amount_total"`
+	Currency          string       `json:"currency"`
+	Error             *StripeError `json:"error,omitempty"`
+}
+
+type StripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object StripeCheckoutSession `json:"object"`
+	} `json:"data"`
+}
+
+type StripePaymentProvider struct{}
+
+// the webhook secret is required, otherwise anyone could sign a notification for their own order
+func (provider *StripePaymentProvider) Enabled() bool {
+	return common.StripeSecretKey != "" && common.StripeWebhookSecret != ""
+}
+
+func (provider *StripePaymentProvider) CreateCheckout(order *model.TopUpOrder) (string, string, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("client_reference_id", order.TradeNo)
+	form.Set("success_url", getPaymentReturnURL(order))
+	form.Set("cancel_url", getPaymentReturnURL(order))
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", order.Currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(order.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", fmt.Sprintf("%s %s", common.SystemName, common.LogQuota(order.Quota)))
+	form.Set("metadata[trade_no]", order.TradeNo)
+	req, err := http.NewRequest(http.MethodPost, "https://api.stripe.com/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+common.StripeSecretKey)
+	resp, err := paymentHTTPClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	var session StripeCheckoutSession
+	err = json.NewDecoder(resp.Body).Decode(&session)
+	if err != nil {
+		return "", "", err
+	}
+	if session.Error != nil {
+		return "", "", errors.New(session.Error.Message)
+	}
+	return session.URL, session.Id, nil
+}
+
+func (provider *StripePaymentProvider) VerifyNotification(header http.Header, body []byte) (*PaymentNotification, error) {
+	if common.StripeWebhookSecret == "" {
+		return nil, errors.New("stripe webhook secret is not set")
+	}
+	err := verifyPaymentSignature(header.Get("Stripe-Signature"), common.StripeWebhookSecret, body)
+	if err != nil {
+		return nil, err
+	}
+	var event StripeEvent
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		return nil, err
+	}
+	session := event.Data.Object
+	notification := &PaymentNotification{
+		TradeNo:  session.ClientReferenceId,
+		Amount:   session.AmountTotal,
+		Currency: session.Currency,
+	}
+	switch event.Type {
+	case "checkout.session.completed":
+		// delayed payment methods are notified by checkout.session.async_payment_succeeded
+		if session.PaymentStatus != "paid" {
+			return nil, nil
+		}
+		notification.Status = common.TopUpOrderStatusPaid
+	case "checkout.session.async_payment_succeeded":
+		notification.Status = common.TopUpOrderStatusPaid
+	case "checkout.session.async_payment_failed", "checkout.session.expired":
+		notification.Status = common.TopUpOrderStatusFailed
+	default:
+		return nil, nil
+	}
+	return notification, nil
+}
@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PaymentProviderStripe = "stripe"
+	PaymentProviderFake   = "fake"
+)
+
+const paymentSignatureTolerance = 5 * 60 // in seconds
+
+var paymentHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// PaymentNotification is a verified webhook event of a payment provider
+type PaymentNotification struct {
+	TradeNo  string
+	Status   int // one of the top up order status
+	Amount   int64
+	Currency string
+}
+
+type PaymentProvider interface {
+	Enabled() bool
+	// CreateCheckout returns the url the user is redirected to for paying, and the id of the order at the provider
+	CreateCheckout(order *model.TopUpOrder) (checkoutURL string, providerOrderId string, err error)
+	// VerifyNotification checks the signature of the webhook and parses it, nil means the event can be ignored
+	VerifyNotification(header http.Header, body []byte) (*PaymentNotification, error)
+}
+
+var paymentProviders = map[string]PaymentProvider{
+	PaymentProviderStripe: &StripePaymentProvider{},
+	PaymentProviderFake:   &FakePaymentProvider{},
+}
+
+func getEnabledPaymentProviders() []string {
+	providers := make([]string, 0)
+	for name, provider := range paymentProviders {
+		if provider.Enabled() {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+func getPaymentReturnURL(order *model.TopUpOrder) string {
+	return fmt.Sprintf("%s/topup?trade_no=%s", common.ServerAddress, order.TradeNo)
+}
+
+// signPaymentPayload signs in the format of Stripe: "t=timestamp,v1=signature",
+// the signature is the hex encoded HMAC-SHA256 of "timestamp.body"
+func signPaymentPayload(secret string, body []byte) string {
+	timestamp := strconv.FormatInt(common.GetTimestamp(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, common.HmacSHA256Hex(secret, []byte(timestamp+"."+string(body))))
+}
+
+func verifyPaymentSignature(header string, secret string, body []byte) error {
+	if secret == "" {
+		return errors.New("signing secret is not set")
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("invalid signature header")
+	}
+	if math.Abs(float64(common.GetTimestamp()-t)) > paymentSignatureTolerance {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+	expected := common.HmacSHA256Hex(secret, []byte(timestamp+"."+string(body)))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+type TopUpOrderRequest struct {
+	Provider string `json:"provider"`
+	Amount   int    `json:"amount"` // units of quota, a unit is QuotaPerUnit quota
+}
+
+func CreateTopUpOrder(c *gin.Context) {
+	req := TopUpOrderRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	provider, ok := paymentProviders[req.Provider]
+	if !ok || !provider.Enabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的支付方式",
+		})
+		return
+	}
+	if req.Provider == PaymentProviderFake && c.GetInt("role") < common.RoleAdminUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模拟支付仅限管理员使用",
+		})
+		return
+	}
+	if req.Amount < common.PaymentMinTopUp || req.Amount <= 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("充值数量不能小于 %d", common.PaymentMinTopUp),
+		})
+		return
+	}
+	if common.PaymentPrice <= 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未设置充值价格",
+		})
+		return
+	}
+	order := &model.TopUpOrder{
+		UserId:      c.GetInt("id"),
+		TradeNo:     common.GetUUID(),
+		Provider:    req.Provider,
+		Quota:       int(float64(req.Amount) * common.QuotaPerUnit),
+		Amount:      common.PaymentAmount2MinorUnit(float64(req.Amount)*common.PaymentPrice, common.PaymentCurrency),
+		Currency:    common.PaymentCurrency,
+		Status:      common.TopUpOrderStatusPending,
+		CreatedTime: common.GetTimestamp(),
+	}
+	err = order.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	checkoutURL, providerOrderId, err := provider.CreateCheckout(order)
+	if err != nil {
+		_ = model.FailTopUpOrder(order.Provider, order.TradeNo)
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "创建支付订单失败：" + err.Error(),
+		})
+		return
+	}
+	if providerOrderId != "" {
+		err = order.UpdateProviderOrderId(providerOrderId)
+		if err != nil {
+			common.SysError("failed to update provider order id: " + err.Error())
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"trade_no": order.TradeNo,
+			"url":      checkoutURL,
+		},
+	})
+	return
+}
+
+func GetSelfTopUpOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orders, err := model.GetUserTopUpOrders(c.GetInt("id"), p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+	})
+	return
+}
+
+func GetAllTopUpOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orders, err := model.GetAllTopUpOrders(p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+	})
+	return
+}
+
+// PaymentWebhook handles the notifications of the payment providers, a non 2xx
+// response makes the provider retry the notification later
+func PaymentWebhook(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := paymentProviders[name]
+	if !ok || !provider.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "不支持的支付方式",
+		})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		var notification *PaymentNotification
+		notification, err = provider.VerifyNotification(c.Request.Header, body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		if notification != nil {
+			switch notification.Status {
+			case common.TopUpOrderStatusPaid:
+				_, err = model.CompleteTopUpOrder(name, notification.TradeNo, notification.Amount, notification.Currency)
+			case common.TopUpOrderStatusFailed:
+				err = model.FailTopUpOrder(name, notification.TradeNo)
+			}
+		}
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to handle %s payment notification: %s", name, err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
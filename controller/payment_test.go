@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupPaymentTest(t *testing.T) *model.User {
+	gin.SetMode(gin.TestMode)
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	common.RedisEnabled = false
+	err := model.InitDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+	user := &model.User{Username: "payer", Password: "12345678", DisplayName: "payer"}
+	err = user.Insert(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createTestTopUpOrder(t *testing.T, userId int, amount int) string {
+	body, _ := json.Marshal(TopUpOrderRequest{Provider: PaymentProviderFake, Amount: amount})
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/user/topup/order", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("id", userId)
+	c.Set("role", common.RoleAdminUser)
+	CreateTopUpOrder(c)
+	var response struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    struct {
+			TradeNo string `json:"trade_no"`
+		} `json:"data"`
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil || !response.Success {
+		t.Fatalf("failed to create order: %v %s", err, response.Message)
+	}
+	return response.Data.TradeNo
+}
+
+func sendTestPaymentWebhook(provider string, header string, signature string, notification any) int {
+	body, _ := json.Marshal(notification)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/payment/webhook/"+provider, bytes.NewReader(body))
+	c.Request.Header.Set(header, signature)
+	c.Params = gin.Params{{Key: "provider", Value: provider}}
+	PaymentWebhook(c)
+	return recorder.Code
+}
+
+func signTestPayment(notification any) string {
+	body, _ := json.Marshal(notification)
+	return signPaymentPayload(fakePaymentSecret, body)
+}
+
+func TestPaymentWebhookFakeProvider(t *testing.T) {
+	user := setupPaymentTest(t)
+	common.PaymentFakeEnabled = true
+	common.PaymentPrice = 7
+	common.PaymentCurrency = "jpy"
+	defer func() {
+		common.PaymentFakeEnabled = false
+		common.PaymentPrice = 1
+		common.PaymentCurrency = "usd"
+	}()
+
+	tradeNo := createTestTopUpOrder(t, user.Id, 10)
+	order, err := model.GetTopUpOrderByTradeNo(tradeNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// jpy has no minor unit, so the amount is not multiplied by 100
+	if order.Amount != 70 {
+		t.Errorf("got order amount %d, want 70", order.Amount)
+	}
+	notification := &FakePaymentNotification{
+		TradeNo:  tradeNo,
+		Status:   common.TopUpOrderStatusPaid,
+		Amount:   order.Amount,
+		Currency: order.Currency,
+	}
+
+	if code := sendTestPaymentWebhook(PaymentProviderFake, "X-Fake-Signature", "t=1,v1=00", notification); code != http.StatusBadRequest {
+		t.Errorf("invalid signature: got status %d, want %d", code, http.StatusBadRequest)
+	}
+	underpaid := *notification
+	underpaid.Amount--
+	if code := sendTestPaymentWebhook(PaymentProviderFake, "X-Fake-Signature", signTestPayment(&underpaid), &underpaid); code != http.StatusInternalServerError {
+		t.Errorf("underpaid: got status %d, want %d", code, http.StatusInternalServerError)
+	}
+	quota, _ := model.GetUserQuota(user.Id)
+	if quota != 0 {
+		t.Fatalf("got quota %d before the order is paid, want 0", quota)
+	}
+
+	// providers retry notifications, the quota must only be credited once
+	for i := 0; i < 2; i++ {
+		if code := sendTestPaymentWebhook(PaymentProviderFake, "X-Fake-Signature", signTestPayment(notification), notification); code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", code, http.StatusOK)
+		}
+	}
+	quota, _ = model.GetUserQuota(user.Id)
+	if want := int(10 * common.QuotaPerUnit); quota != want {
+		t.Errorf("got quota %d, want %d", quota, want)
+	}
+	order, _ = model.GetTopUpOrderByTradeNo(tradeNo)
+	if order.Status != common.TopUpOrderStatusPaid {
+		t.Errorf("got order status %d, want %d", order.Status, common.TopUpOrderStatusPaid)
+	}
+}
+
+func TestPaymentWebhookStripeRequiresWebhookSecret(t *testing.T) {
+	user := setupPaymentTest(t)
+	common.StripeSecretKey = "sk_test"
+	common.StripeWebhookSecret = ""
+	defer func() {
+		common.StripeSecretKey = ""
+	}()
+
+	order := &model.TopUpOrder{
+		UserId:   user.Id,
+		TradeNo:  common.GetUUID(),
+		Provider: PaymentProviderStripe,
+		Quota:    1000,
+		Amount:   100,
+		Currency: "usd",
+		Status:   common.TopUpOrderStatusPending,
+	}
+	if err := order.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	var event StripeEvent
+	event.Type = "checkout.session.completed"
+	event.Data.Object = StripeCheckoutSession{
+		ClientReferenceId: order.TradeNo,
+		PaymentStatus:     "paid",
+		AmountTotal:       order.Amount,
+		Currency:          order.Currency,
+	}
+	body, _ := json.Marshal(&event)
+	// signed with the empty secret, as anyone could do
+	signature := signPaymentPayload("", body)
+	if code := sendTestPaymentWebhook(PaymentProviderStripe, "Stripe-Signature", signature, &event); code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", code, http.StatusNotFound)
+	}
+	if _, err := (&StripePaymentProvider{}).VerifyNotification(http.Header{"Stripe-Signature": {signature}}, body); err == nil {
+		t.Error("notification signed with an empty secret is accepted")
+	}
+	quota, _ := model.GetUserQuota(user.Id)
+	if quota != 0 {
+		t.Errorf("got quota %d, want 0", quota)
+	}
+}
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AutomaticallyRefreshUserPlans(frequency int) {
+	for {
+		model.RefreshDueUserPlans()
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
+
+func validatePlan(plan *model.Plan) error {
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if plan.Quota < 0 || plan.Price < 0 {
+		return errors.New("套餐额度和价格不能为负数")
+	}
+	if plan.Period != model.PlanPeriodDay && plan.Period != model.PlanPeriodMonth {
+		return errors.New("无效的套餐周期")
+	}
+	if plan.ResetMode != model.PlanResetModeReset && plan.ResetMode != model.PlanResetModeRefill {
+		return errors.New("无效的额度重置方式")
+	}
+	for _, group := range plan.GetAllowedGroups() {
+		if _, ok := common.GroupRatio[group]; !ok {
+			return fmt.Errorf("未知的分组：%s", group)
+		}
+	}
+	if plan.Status == 0 {
+		plan.Status = common.PlanStatusEnabled
+	}
+	return nil
+}
+
+func GetAllPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+	return
+}
+
+func AddPlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err == nil {
+		err = validatePlan(&plan)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	plan.Id = 0
+	plan.CreatedTime = common.GetTimestamp()
+	err = plan.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+	return
+}
+
+func UpdatePlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err == nil {
+		err = validatePlan(&plan)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = plan.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+	return
+}
+
+func DeletePlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeletePlanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func getUserPlanData(userId int) gin.H {
+	userPlan, err := model.GetUserPlanByUserId(userId)
+	if err != nil {
+		return nil
+	}
+	plan, err := model.GetPlanById(userPlan.PlanId)
+	if err != nil {
+		return nil
+	}
+	return gin.H{
+		"plan":            plan,
+		"start_time":      userPlan.StartTime,
+		"end_time":        userPlan.EndTime,
+		"next_reset_time": userPlan.NextResetTime,
+	}
+}
+
+func GetUserPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    getUserPlanData(id),
+	})
+	return
+}
+
+func GetSelfPlan(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    getUserPlanData(c.GetInt("id")),
+	})
+	return
+}
+
+type AssignPlanRequest struct {
+	UserId    int   `json:"user_id"`
+	PlanId    int   `json:"plan_id"` // 0 cancels the plan of the user
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+}
+
+func AssignUserPlan(c *gin.Context) {
+	req := AssignPlanRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.UserId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权更新同权限等级或更高权限等级的用户信息",
+		})
+		return
+	}
+	if req.PlanId == 0 {
+		err = model.CancelUserPlan(user.Id)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+		})
+		return
+	}
+	err = model.AssignUserPlan(user.Id, req.PlanId, req.StartTime, req.EndTime)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    getUserPlanData(user.Id),
+	})
+	return
+}
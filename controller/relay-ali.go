@@ -58,6 +58,28 @@ type AliEmbeddingResponse struct {
 	AliError
 }
 
+// https://help.aliyun.com/zh/model-studio/developer-reference/text-rerank-api
+
+type AliRerankRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+	} `json:"input"`
+	Parameters struct {
+		TopN            int  `json:"top_n,omitempty"`
+		ReturnDocuments bool `json:"return_documents"`
+	} `json:"parameters"`
+}
+
+type AliRerankResponse struct {
+	Output struct {
+		Results []RerankResult `json:"results"`
+	} `json:"output"`
+	Usage AliUsage `json:"usage"`
+	AliError
+}
+
 type AliError struct {
 	Code      string `json:"code"`
 	Message   string `json:"message"`
@@ -106,7 +128,7 @@ func requestOpenAI2Ali(request GeneralOpenAIRequest) *AliChatRequest {
 
 func embeddingRequestOpenAI2Ali(request GeneralOpenAIRequest) *AliEmbeddingRequest {
 	return &AliEmbeddingRequest{
-		Model: "text-embedding-v1",
+		Model: request.Model,
 		Input: struct {
 			Texts []string `json:"texts"`
 		}{
@@ -115,7 +137,49 @@ func embeddingRequestOpenAI2Ali(request GeneralOpenAIRequest) *AliEmbeddingReque
 	}
 }
 
-func aliEmbeddingHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+func rerankRequestOpenAI2Ali(request RerankRequest, documents []string) *AliRerankRequest {
+	aliRequest := AliRerankRequest{
+		Model: request.Model,
+	}
+	aliRequest.Input.Query = request.Query
+	aliRequest.Input.Documents = documents
+	aliRequest.Parameters.TopN = request.TopN
+	aliRequest.Parameters.ReturnDocuments = request.ReturnDocuments == nil || *request.ReturnDocuments
+	return &aliRequest
+}
+
+func aliRerankHandler(resp *http.Response) (*OpenAIErrorWithStatusCode, *RerankResponse) {
+	var aliResponse AliRerankResponse
+	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if aliResponse.Code != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: aliResponse.Message,
+				Type:    aliResponse.Code,
+				Param:   aliResponse.RequestId,
+				Code:    aliResponse.Code,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	return nil, &RerankResponse{
+		Id:      aliResponse.RequestId,
+		Results: aliResponse.Output.Results,
+		Usage: Usage{
+			PromptTokens: aliResponse.Usage.TotalTokens,
+			TotalTokens:  aliResponse.Usage.TotalTokens,
+		},
+	}
+}
+
+func aliEmbeddingHandler(c *gin.Context, resp *http.Response, textRequest GeneralOpenAIRequest) (*OpenAIErrorWithStatusCode, *Usage) {
 	var aliResponse AliEmbeddingResponse
 	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
 	if err != nil {
@@ -140,6 +204,8 @@ func aliEmbeddingHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithS
 	}
 
 	fullTextResponse := embeddingResponseAli2OpenAI(&aliResponse)
+	fullTextResponse.Model = textRequest.Model
+	encodeEmbeddingResponse(fullTextResponse, textRequest.EncodingFormat)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -155,7 +221,7 @@ func embeddingResponseAli2OpenAI(response *AliEmbeddingResponse) *OpenAIEmbeddin
 		Object: "list",
 		Data:   make([]OpenAIEmbeddingResponseItem, 0, len(response.Output.Embeddings)),
 		Model:  "text-embedding-v1",
-		Usage:  Usage{TotalTokens: response.Usage.TotalTokens},
+		Usage:  Usage{PromptTokens: response.Usage.TotalTokens, TotalTokens: response.Usage.TotalTokens},
 	}
 
 	for _, item := range response.Output.Embeddings {
@@ -312,3 +378,176 @@ func aliHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &fullTextResponse.Usage
 }
+
+// https://help.aliyun.com/zh/dashscope/developer-reference/tongyi-qianwen-vl-plus-api
+
+type AliVLContent struct {
+	Image string `json:"image,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+type AliVLMessage struct {
+	Role    string         `json:"role"`
+	Content []AliVLContent `json:"content"`
+}
+
+type AliVLRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Messages []AliVLMessage `json:"messages"`
+	} `json:"input"`
+	Parameters struct {
+		TopP              float64 `json:"top_p,omitempty"`
+		IncrementalOutput bool    `json:"incremental_output,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
+type AliVLResponse struct {
+	Output struct {
+		Choices []struct {
+			FinishReason string       `json:"finish_reason"`
+			Message      AliVLMessage `json:"message"`
+		} `json:"choices"`
+	} `json:"output"`
+	Usage AliUsage `json:"usage"`
+	AliError
+}
+
+func visionRequestOpenAI2Ali(textRequest VisionOpenAIRequest) *AliVLRequest {
+	aliRequest := AliVLRequest{
+		Model: textRequest.Model,
+	}
+	aliRequest.Parameters.TopP = textRequest.TopP
+	aliRequest.Parameters.IncrementalOutput = textRequest.Stream
+	for _, message := range textRequest.Messages {
+		aliMessage := AliVLMessage{
+			Role: strings.ToLower(message.Role),
+		}
+		for _, content := range message.ParseContent() {
+			if content.ImageURL.URL != "" {
+				// dashscope accepts both image urls and data uris
+				aliMessage.Content = append(aliMessage.Content, AliVLContent{Image: content.ImageURL.URL})
+			} else {
+				aliMessage.Content = append(aliMessage.Content, AliVLContent{Text: content.Text})
+			}
+		}
+		aliRequest.Input.Messages = append(aliRequest.Input.Messages, aliMessage)
+	}
+	return &aliRequest
+}
+
+// aliVLResponse2AliChat flattens the multimodal response so that the text converters can be reused
+func aliVLResponse2AliChat(response *AliVLResponse) *AliChatResponse {
+	aliResponse := AliChatResponse{
+		Usage:    response.Usage,
+		AliError: response.AliError,
+	}
+	if len(response.Output.Choices) > 0 {
+		choice := response.Output.Choices[0]
+		aliResponse.Output.FinishReason = choice.FinishReason
+		for _, content := range choice.Message.Content {
+			aliResponse.Output.Text += content.Text
+		}
+	}
+	return &aliResponse
+}
+
+func aliVLStreamHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := strings.Index(string(data), "\n"); i >= 0 {
+			return i + 1, data[0:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	dataChan := make(chan string)
+	stopChan := make(chan bool)
+	go func() {
+		for scanner.Scan() {
+			data := scanner.Text()
+			if len(data) < 5 { // ignore blank line or wrong format
+				continue
+			}
+			if data[:5] != "data:" {
+				continue
+			}
+			data = data[5:]
+			dataChan <- data
+		}
+		stopChan <- true
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			var aliVLResponse AliVLResponse
+			err := json.Unmarshal([]byte(data), &aliVLResponse)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				return true
+			}
+			aliResponse := aliVLResponse2AliChat(&aliVLResponse)
+			if aliResponse.Usage.OutputTokens != 0 {
+				usage.PromptTokens = aliResponse.Usage.InputTokens
+				usage.CompletionTokens = aliResponse.Usage.OutputTokens
+				usage.TotalTokens = aliResponse.Usage.InputTokens + aliResponse.Usage.OutputTokens
+			}
+			response := streamResponseAli2OpenAI(aliResponse)
+			response.Model = "qwen-vl"
+			jsonResponse, err := json.Marshal(response)
+			if err != nil {
+				common.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+			return true
+		case <-stopChan:
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+	})
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &usage
+}
+
+func aliVLHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	var aliVLResponse AliVLResponse
+	err := json.NewDecoder(resp.Body).Decode(&aliVLResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if aliVLResponse.Code != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: aliVLResponse.Message,
+				Type:    aliVLResponse.Code,
+				Param:   aliVLResponse.RequestId,
+				Code:    aliVLResponse.Code,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := responseAli2OpenAI(aliVLResponse2AliChat(&aliVLResponse))
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
@@ -9,12 +9,16 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
+	"math"
 	"net/http"
 	"one-api/common"
-	"one-api/model"
 	"strings"
+	"unicode/utf8"
 )
 
+// whisper-1 is priced per minute, its model ratio assumes one minute of audio equals 200 tokens
+const audioTokensPerSecond = 200.0 / 60
+
 func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	audioModel := "whisper-1"
 
@@ -26,6 +30,9 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	tokenName := c.GetString("token_name")
 
 	var ttsRequest TextToSpeechRequest
+	var audioData []byte
+	var audioFileName string
+	var audioDuration float64
 	if relayMode == RelayModeAudioSpeech {
 		// Read JSON
 		err := common.UnmarshalBodyReusable(c, &ttsRequest)
@@ -35,9 +42,23 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 		}
 		audioModel = ttsRequest.Model
 		// Check if text is too long 4096
-		if len(ttsRequest.Input) > 4096 {
+		if utf8.RuneCountInString(ttsRequest.Input) > 4096 {
 			return errorWrapper(errors.New("input is too long (over 4096 characters)"), "text_too_long", http.StatusBadRequest)
 		}
+	} else {
+		var err error
+		audioFileName, audioData, err = getAudioFile(c)
+		if err != nil {
+			return errorWrapper(err, "invalid_audio_file", http.StatusBadRequest)
+		}
+		if c.PostForm("model") != "" {
+			audioModel = c.PostForm("model")
+		}
+		audioDuration, err = common.GetAudioDuration(audioData)
+		if err != nil {
+			// fall back to billing by the tokens of the transcription
+			common.LogWarn(c.Request.Context(), fmt.Sprintf("failed to get duration of audio %s: %s", audioFileName, err.Error()))
+		}
 	}
 
 	modelRatio := common.GetModelRatio(audioModel)
@@ -45,37 +66,30 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	ratio := modelRatio * groupRatio
 	var quota int
 	var preConsumedQuota int
-	switch relayMode {
-	case RelayModeAudioSpeech:
-		preConsumedQuota = int(float64(len(ttsRequest.Input)) * ratio)
+	switch {
+	case relayMode == RelayModeAudioSpeech:
+		// tts is billed per character
+		preConsumedQuota = int(math.Ceil(float64(utf8.RuneCountInString(ttsRequest.Input)) * ratio))
+		quota = preConsumedQuota
+	case audioDuration > 0:
+		// stt is billed per second of the uploaded audio
+		preConsumedQuota = int(math.Ceil(audioDuration * audioTokensPerSecond * ratio))
 		quota = preConsumedQuota
 	default:
 		preConsumedQuota = int(float64(common.PreConsumedQuota) * ratio)
 	}
-	userQuota, err := model.CacheGetUserQuota(userId)
-	if err != nil {
-		return errorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
-	}
-
-	// Check if user quota is enough
-	if userQuota-preConsumedQuota < 0 {
-		return errorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
-	}
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
-	if err != nil {
-		return errorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+	channelCost := getChannelCost(c)
+	reservation, openAIErr := reserveQuota(userId, tokenId, preConsumedQuota)
+	if openAIErr != nil {
+		return openAIErr
 	}
-	if userQuota > 100*preConsumedQuota {
-		// in this case, we do not pre-consume quota
-		// because the user has enough quota
-		preConsumedQuota = 0
-	}
-	if preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
-		if err != nil {
-			return errorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	// the reservation is released on every return before the response is billed below
+	settling := false
+	defer func() {
+		if !settling {
+			go releaseQuota(c.Request.Context(), reservation)
 		}
-	}
+	}()
 
 	// map model name
 	modelMapping := c.GetString("model_mapping")
@@ -90,6 +104,23 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 		}
 	}
 
+	if channelType == common.ChannelTypeTencent {
+		openAIErr, text, duration := relayTencentAudio(c, relayMode, ttsRequest, audioData, audioFileName)
+		if openAIErr != nil {
+			return openAIErr
+		}
+		if relayMode != RelayModeAudioSpeech && audioDuration <= 0 {
+			if duration > 0 {
+				quota = int(math.Ceil(duration * audioTokensPerSecond * ratio))
+			} else {
+				quota = int(math.Ceil(float64(countTokenText(text, audioModel)) * ratio))
+			}
+		}
+		settling = true
+		go postConsumeQuota(c.Request.Context(), reservation, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName, group, channelCost)
+		return nil
+	}
+
 	baseURL := common.ChannelBaseURLs[channelType]
 	requestURL := c.Request.URL.String()
 	if c.GetString("base_url") != "" {
@@ -97,14 +128,16 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	}
 
 	fullRequestURL := getFullRequestURL(baseURL, requestURL, channelType)
-	if relayMode == RelayModeAudioTranscription && channelType == common.ChannelTypeAzure {
+	if channelType == common.ChannelTypeAzure {
 		// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/text-to-speech-quickstart?tabs=command-line#rest-api
 		apiVersion := GetAPIVersion(c)
-		fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/audio/transcriptions?api-version=%s", baseURL, audioModel, apiVersion)
+		task := strings.TrimPrefix(c.Request.URL.Path, "/v1/")
+		fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s", baseURL, audioModel, task, apiVersion)
 	}
 
 	requestBody := &bytes.Buffer{}
-	_, err = io.Copy(requestBody, c.Request.Body)
+	_, err := io.Copy(requestBody, c.Request.Body)
 	if err != nil {
 		return errorWrapper(err, "new_request_body_failed", http.StatusInternalServerError)
 	}
@@ -116,8 +149,7 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 		return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
 	}
 
-	if relayMode == RelayModeAudioTranscription && channelType == common.ChannelTypeAzure {
-		// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
+	if channelType == common.ChannelTypeAzure {
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 		req.Header.Set("api-key", apiKey)
@@ -159,45 +191,35 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 			}
 		}
 
-		var text string
-		switch responseFormat {
-		case "json":
-			text, err = getTextFromJSON(responseBody)
-		case "text":
-			text, err = getTextFromText(responseBody)
-		case "srt":
-			text, err = getTextFromSRT(responseBody)
-		case "verbose_json":
-			text, err = getTextFromVerboseJSON(responseBody)
-		case "vtt":
-			text, err = getTextFromVTT(responseBody)
-		default:
-			return errorWrapper(errors.New("unexpected_response_format"), "unexpected_response_format", http.StatusInternalServerError)
-		}
-		if err != nil {
-			return errorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
+		if audioDuration <= 0 {
+			var text string
+			switch responseFormat {
+			case "json":
+				text, err = getTextFromJSON(responseBody)
+			case "text":
+				text, err = getTextFromText(responseBody)
+			case "srt":
+				text, err = getTextFromSRT(responseBody)
+			case "verbose_json":
+				text, err = getTextFromVerboseJSON(responseBody)
+			case "vtt":
+				text, err = getTextFromVTT(responseBody)
+			default:
+				return errorWrapper(errors.New("unexpected_response_format"), "unexpected_response_format", http.StatusInternalServerError)
+			}
+			if err != nil {
+				return errorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
+			}
+			quota = int(math.Ceil(float64(countTokenText(text, audioModel)) * ratio))
 		}
-		quota = countTokenText(text, audioModel)
 		resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 	}
 	if resp.StatusCode != http.StatusOK {
-		if preConsumedQuota > 0 {
-			// we need to roll back the pre-consumed quota
-			defer func(ctx context.Context) {
-				go func() {
-					// negative means add quota back for token & user
-					err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
-					if err != nil {
-						common.LogError(ctx, fmt.Sprintf("error rollback pre-consumed quota: %s", err.Error()))
-					}
-				}()
-			}(c.Request.Context())
-		}
 		return relayErrorHandler(resp)
 	}
-	quotaDelta := quota - preConsumedQuota
+	settling = true
 	defer func(ctx context.Context) {
-		go postConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+		go postConsumeQuota(ctx, reservation, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName, group, channelCost)
 	}(c.Request.Context())
 
 	for k, v := range resp.Header {
@@ -216,6 +238,74 @@ func relayAudioHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	return nil
 }
 
+// relayTencentAudio serves tts with TextToVoice and transcriptions with SentenceRecognition,
+// for transcriptions it returns the text and the duration reported by tencent
+func relayTencentAudio(c *gin.Context, relayMode int, ttsRequest TextToSpeechRequest, audioData []byte, audioFileName string) (*OpenAIErrorWithStatusCode, string, float64) {
+	apiKey := c.Request.Header.Get("Authorization")
+	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+	_, secretId, secretKey, err := parseTencentConfig(apiKey)
+	if err != nil {
+		return errorWrapper(err, "invalid_tencent_config", http.StatusInternalServerError), "", 0
+	}
+	switch relayMode {
+	case RelayModeAudioSpeech:
+		return tencentTTSHandler(c, ttsRequest, secretId, secretKey), "", 0
+	case RelayModeAudioTranscription:
+		return tencentASRHandler(c, audioData, audioFileName, c.DefaultPostForm("response_format", "json"), secretId, secretKey)
+	}
+	return errorWrapper(errors.New("audio translation is not supported by this channel"), "unsupported_relay_mode", http.StatusBadRequest), "", 0
+}
+
+// getAudioFile reads the uploaded audio while keeping the request body reusable
+func getAudioFile(c *gin.Context) (string, []byte, error) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	file, header, err := c.Request.FormFile("file")
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", nil, err
+	}
+	return header.Filename, data, nil
+}
+
+// formatTranscription renders a transcription from vendors without native openai response formats
+func formatTranscription(text string, duration float64, responseFormat string) ([]byte, string, error) {
+	formatTimestamp := func(seconds float64, separator string) string {
+		milliseconds := int64(seconds * 1000)
+		return fmt.Sprintf("%02d:%02d:%02d%s%03d", milliseconds/3600000, milliseconds/60000%60, milliseconds/1000%60, separator, milliseconds%1000)
+	}
+	switch responseFormat {
+	case "", "json":
+		body, err := json.Marshal(WhisperJSONResponse{Text: text})
+		return body, "application/json", err
+	case "verbose_json":
+		body, err := json.Marshal(WhisperVerboseJSONResponse{
+			Task:     "transcribe",
+			Duration: duration,
+			Text:     text,
+			Segments: []Segment{{Id: 0, Start: 0, End: duration, Text: text}},
+		})
+		return body, "application/json", err
+	case "text":
+		return []byte(text + "\n"), "text/plain; charset=utf-8", nil
+	case "srt":
+		body := fmt.Sprintf("1\n%s --> %s\n%s\n\n", formatTimestamp(0, ","), formatTimestamp(duration, ","), text)
+		return []byte(body), "text/plain; charset=utf-8", nil
+	case "vtt":
+		body := fmt.Sprintf("WEBVTT\n\n%s --> %s\n%s\n\n", formatTimestamp(0, "."), formatTimestamp(duration, "."), text)
+		return []byte(body), "text/vtt; charset=utf-8", nil
+	}
+	return nil, "", fmt.Errorf("unexpected response format %s", responseFormat)
+}
+
 func getTextFromVTT(body []byte) (string, error) {
 	return getTextFromSRT(body)
 }
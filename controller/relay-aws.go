@@ -0,0 +1,758 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters.html
+// the channel key is AccessKeyId|SecretAccessKey|Region, and the base url can point to a local stub
+
+const awsBedrockService = "bedrock"
+
+// awsModelIds maps the model names used by one api to bedrock model ids, other names are passed through
+var awsModelIds = map[string]string{
+	"claude-instant-1":         "anthropic.claude-instant-v1",
+	"claude-2":                 "anthropic.claude-v2",
+	"claude-2.0":               "anthropic.claude-v2",
+	"claude-2.1":               "anthropic.claude-v2:1",
+	"claude-3-haiku-20240307":  "anthropic.claude-3-haiku-20240307-v1:0",
+	"claude-3-sonnet-20240229": "anthropic.claude-3-sonnet-20240229-v1:0",
+	"claude-3-opus-20240229":   "anthropic.claude-3-opus-20240229-v1:0",
+	"llama2-13b-chat":          "meta.llama2-13b-chat-v1",
+	"llama2-70b-chat":          "meta.llama2-70b-chat-v1",
+	"mistral-7b-instruct":      "mistral.mistral-7b-instruct-v0:2",
+	"mixtral-8x7b-instruct":    "mistral.mixtral-8x7b-instruct-v0:1",
+	"mistral-large":            "mistral.mistral-large-2402-v1:0",
+	"titan-text-lite":          "amazon.titan-text-lite-v1",
+	"titan-text-express":       "amazon.titan-text-express-v1",
+}
+
+func getAwsModelId(model string) string {
+	if modelId, ok := awsModelIds[model]; ok {
+		return modelId
+	}
+	return model
+}
+
+// the provider is the prefix of the model id, e.g. anthropic, meta, mistral and amazon
+func getAwsModelProvider(modelId string) string {
+	// cross region inference profiles are prefixed with the geography, e.g. us.anthropic.claude...
+	parts := strings.Split(modelId, ".")
+	for _, part := range parts {
+		switch part {
+		case "anthropic", "meta", "mistral", "amazon":
+			return part
+		}
+	}
+	return parts[0]
+}
+
+type AwsConfig struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Region          string
+}
+
+func parseAwsConfig(config string) (*AwsConfig, error) {
+	parts := strings.Split(config, "|")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid aws config, the format should be AccessKeyId|SecretAccessKey|Region")
+	}
+	return &AwsConfig{
+		AccessKeyId:     parts[0],
+		SecretAccessKey: parts[1],
+		Region:          parts[2],
+	}, nil
+}
+
+// Signature Version 4
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+
+func awsEscape(s string, encodeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return builder.String()
+}
+
+func getAwsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// signAwsRequest signs the request in place, all headers already set on the request are signed
+func signAwsRequest(req *http.Request, body []byte, config *AwsConfig, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(string(body))
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	// every path segment is encoded twice except for s3
+	canonicalURI := awsEscape(req.URL.EscapedPath(), false)
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		getAwsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", date, config.Region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		credentialScope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	secretDate := hmacSha256(date, "AWS4"+config.SecretAccessKey)
+	secretRegion := hmacSha256(config.Region, secretDate)
+	secretService := hmacSha256(service, secretRegion)
+	secretSigning := hmacSha256("aws4_request", secretService)
+	signature := hex.EncodeToString([]byte(hmacSha256(stringToSign, secretSigning)))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKeyId, credentialScope, signedHeaders, signature))
+}
+
+// Event stream encoding
+// https://docs.aws.amazon.com/transcribe/latest/dg/event-stream.html
+
+type AwsEventStreamMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+type awsEventStreamDecoder struct {
+	reader *bufio.Reader
+}
+
+func newAwsEventStreamDecoder(reader io.Reader) *awsEventStreamDecoder {
+	return &awsEventStreamDecoder{reader: bufio.NewReader(reader)}
+}
+
+// Next reads one message, it returns io.EOF after the last message
+func (d *awsEventStreamDecoder) Next() (*AwsEventStreamMessage, error) {
+	prelude := make([]byte, 12)
+	_, err := io.ReadFull(d.reader, prelude)
+	if err != nil {
+		return nil, err
+	}
+	totalLength := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, errors.New("event stream prelude checksum mismatch")
+	}
+	if totalLength < 16+headersLength || totalLength > 16<<20 {
+		return nil, errors.New("invalid event stream message length")
+	}
+	message := make([]byte, totalLength)
+	copy(message, prelude)
+	_, err = io.ReadFull(d.reader, message[12:])
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(message[:totalLength-4]) != binary.BigEndian.Uint32(message[totalLength-4:]) {
+		return nil, errors.New("event stream message checksum mismatch")
+	}
+	headers, err := decodeAwsEventStreamHeaders(message[12 : 12+headersLength])
+	if err != nil {
+		return nil, err
+	}
+	return &AwsEventStreamMessage{
+		Headers: headers,
+		Payload: message[12+headersLength : totalLength-4],
+	}, nil
+}
+
+// only string headers are kept, which is all bedrock sends
+func decodeAwsEventStreamHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(data) > 0 {
+		nameLength := int(data[0])
+		if len(data) < 1+nameLength+1 {
+			return nil, errors.New("invalid event stream header")
+		}
+		name := string(data[1 : 1+nameLength])
+		valueType := data[1+nameLength]
+		data = data[2+nameLength:]
+		var valueLength int
+		switch valueType {
+		case 0, 1: // bool true & false
+			valueLength = 0
+		case 2: // byte
+			valueLength = 1
+		case 3: // short
+			valueLength = 2
+		case 4: // integer
+			valueLength = 4
+		case 5, 8: // long & timestamp
+			valueLength = 8
+		case 9: // uuid
+			valueLength = 16
+		case 6, 7: // byte array & string
+			if len(data) < 2 {
+				return nil, errors.New("invalid event stream header")
+			}
+			valueLength = int(binary.BigEndian.Uint16(data[0:2]))
+			data = data[2:]
+		default:
+			return nil, fmt.Errorf("unknown event stream header type %d", valueType)
+		}
+		if len(data) < valueLength {
+			return nil, errors.New("invalid event stream header")
+		}
+		if valueType == 7 {
+			headers[name] = string(data[:valueLength])
+		}
+		data = data[valueLength:]
+	}
+	return headers, nil
+}
+
+// Request & response bodies of each provider
+
+type AwsLlamaRequest struct {
+	Prompt      string  `json:"prompt"`
+	MaxGenLen   int     `json:"max_gen_len,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+	TopP        float64 `json:"top_p,omitempty"`
+}
+
+type AwsMistralRequest struct {
+	Prompt      string  `json:"prompt"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+	TopP        float64 `json:"top_p,omitempty"`
+}
+
+type AwsTitanRequest struct {
+	InputText            string `json:"inputText"`
+	TextGenerationConfig struct {
+		MaxTokenCount int     `json:"maxTokenCount,omitempty"`
+		Temperature   float64 `json:"temperature,omitempty"`
+		TopP          float64 `json:"topP,omitempty"`
+	} `json:"textGenerationConfig"`
+}
+
+type AwsInvocationMetrics struct {
+	InputTokenCount  int `json:"inputTokenCount"`
+	OutputTokenCount int `json:"outputTokenCount"`
+}
+
+// AwsResponse covers the non-claude response bodies and stream chunks
+type AwsResponse struct {
+	// llama
+	Generation           string  `json:"generation"`
+	PromptTokenCount     int     `json:"prompt_token_count"`
+	GenerationTokenCount int     `json:"generation_token_count"`
+	StopReason           *string `json:"stop_reason"`
+	// mistral
+	Outputs []struct {
+		Text       string  `json:"text"`
+		StopReason *string `json:"stop_reason"`
+	} `json:"outputs"`
+	// titan
+	InputTextTokenCount int `json:"inputTextTokenCount"`
+	Results             []struct {
+		TokenCount       int    `json:"tokenCount"`
+		OutputText       string `json:"outputText"`
+		CompletionReason string `json:"completionReason"`
+	} `json:"results"`
+	OutputText                string  `json:"outputText"`
+	TotalOutputTextTokenCount int     `json:"totalOutputTextTokenCount"`
+	CompletionReason          *string `json:"completionReason"`
+
+	InvocationMetrics *AwsInvocationMetrics `json:"amazon-bedrock-invocationMetrics,omitempty"`
+}
+
+type AwsErrorResponse struct {
+	Message string `json:"message"`
+}
+
+func stopReasonAws2OpenAI(reason string) string {
+	switch strings.ToLower(reason) {
+	case "stop", "end_turn", "stop_sequence", "finish":
+		return "stop"
+	case "length", "max_tokens", "length_limit":
+		return "length"
+	case "content_filtered":
+		return "content_filter"
+	default:
+		return reason
+	}
+}
+
+// buildAwsInstPrompt renders messages with the [INST] template used by llama 2 and mistral
+func buildAwsInstPrompt(messages []Message, llama bool) string {
+	system := ""
+	var builder strings.Builder
+	inInstruction := false
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			system += message.Content
+		case "assistant":
+			if inInstruction {
+				builder.WriteString(" [/INST]")
+				inInstruction = false
+			}
+			builder.WriteString(" " + message.Content + " </s>")
+		default:
+			if !inInstruction {
+				builder.WriteString("<s>[INST] ")
+				if system != "" {
+					if llama {
+						builder.WriteString("<<SYS>>\n" + system + "\n<</SYS>>\n\n")
+					} else {
+						builder.WriteString(system + "\n\n")
+					}
+					system = ""
+				}
+				inInstruction = true
+			} else {
+				builder.WriteString("\n")
+			}
+			builder.WriteString(message.Content)
+		}
+	}
+	if inInstruction {
+		builder.WriteString(" [/INST]")
+	}
+	return builder.String()
+}
+
+func buildAwsTitanPrompt(messages []Message) string {
+	var builder strings.Builder
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			builder.WriteString(message.Content + "\n")
+		case "assistant":
+			builder.WriteString("Bot: " + message.Content + "\n")
+		default:
+			builder.WriteString("User: " + message.Content + "\n")
+		}
+	}
+	builder.WriteString("Bot:")
+	return builder.String()
+}
+
+func requestOpenAI2Aws(textRequest GeneralOpenAIRequest, modelId string) (any, error) {
+	switch getAwsModelProvider(modelId) {
+	case "anthropic":
+		claudeRequest := requestOpenAI2ClaudeMessages(textRequest)
+		// the model is part of the url and streaming is chosen by the action
+		claudeRequest.Model = ""
+		claudeRequest.Stream = false
+		claudeRequest.AnthropicVersion = "bedrock-2023-05-31"
+		return claudeRequest, nil
+	case "meta":
+		return AwsLlamaRequest{
+			Prompt:      buildAwsInstPrompt(textRequest.Messages, true),
+			MaxGenLen:   textRequest.MaxTokens,
+			Temperature: textRequest.Temperature,
+			TopP:        textRequest.TopP,
+		}, nil
+	case "mistral":
+		return AwsMistralRequest{
+			Prompt:      buildAwsInstPrompt(textRequest.Messages, false),
+			MaxTokens:   textRequest.MaxTokens,
+			Temperature: textRequest.Temperature,
+			TopP:        textRequest.TopP,
+		}, nil
+	case "amazon":
+		titanRequest := AwsTitanRequest{
+			InputText: buildAwsTitanPrompt(textRequest.Messages),
+		}
+		titanRequest.TextGenerationConfig.MaxTokenCount = textRequest.MaxTokens
+		titanRequest.TextGenerationConfig.Temperature = textRequest.Temperature
+		titanRequest.TextGenerationConfig.TopP = textRequest.TopP
+		return titanRequest, nil
+	}
+	return nil, fmt.Errorf("model %s is not supported by aws bedrock channel", modelId)
+}
+
+// getAwsResponseText returns the generated text, the finish reason and the usage reported in the body
+func (r *AwsResponse) getAwsResponseText() (string, string, Usage) {
+	var usage Usage
+	text := r.Generation + r.OutputText
+	finishReason := ""
+	if r.StopReason != nil {
+		finishReason = *r.StopReason
+	}
+	if r.CompletionReason != nil {
+		finishReason = *r.CompletionReason
+	}
+	for _, output := range r.Outputs {
+		text += output.Text
+		if output.StopReason != nil {
+			finishReason = *output.StopReason
+		}
+	}
+	for _, result := range r.Results {
+		text += result.OutputText
+		finishReason = result.CompletionReason
+		usage.CompletionTokens += result.TokenCount
+	}
+	usage.PromptTokens = r.PromptTokenCount + r.InputTextTokenCount
+	usage.CompletionTokens += r.GenerationTokenCount + r.TotalOutputTextTokenCount
+	if r.InvocationMetrics != nil {
+		usage.PromptTokens = r.InvocationMetrics.InputTokenCount
+		usage.CompletionTokens = r.InvocationMetrics.OutputTokenCount
+	}
+	return text, finishReason, usage
+}
+
+func doAwsRequest(c *gin.Context, modelId string, awsRequest any, stream bool) (*http.Response, *OpenAIErrorWithStatusCode) {
+	apiKey := c.Request.Header.Get("Authorization")
+	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+	config, err := parseAwsConfig(apiKey)
+	if err != nil {
+		return nil, errorWrapper(err, "invalid_aws_config", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(awsRequest)
+	if err != nil {
+		return nil, errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+	}
+	baseURL := fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", config.Region)
+	if c.GetString("base_url") != "" {
+		baseURL = strings.TrimSuffix(c.GetString("base_url"), "/")
+	}
+	action := "invoke"
+	if stream {
+		action = "invoke-with-response-stream"
+	}
+	// the colon in model ids has to be escaped in the path
+	fullRequestURL := fmt.Sprintf("%s/model/%s/%s", baseURL, strings.ReplaceAll(url.PathEscape(modelId), ":", "%3A"), action)
+	req, err := http.NewRequest(http.MethodPost, fullRequestURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+	signAwsRequest(req, jsonData, config, awsBedrockService, time.Now())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, awsErrorHandler(resp)
+	}
+	return resp, nil
+}
+
+func awsErrorHandler(resp *http.Response) *OpenAIErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	errorType := strings.Split(resp.Header.Get("X-Amzn-ErrorType"), ":")[0]
+	if errorType == "" {
+		errorType = "aws_error"
+	}
+	var awsError AwsErrorResponse
+	_ = json.Unmarshal(responseBody, &awsError)
+	if awsError.Message == "" {
+		awsError.Message = fmt.Sprintf("bad response status code %d", resp.StatusCode)
+	}
+	return &OpenAIErrorWithStatusCode{
+		OpenAIError: OpenAIError{
+			Message: awsError.Message,
+			Type:    errorType,
+			Param:   resp.Header.Get("X-Amzn-RequestId"),
+			Code:    errorType,
+		},
+		StatusCode: resp.StatusCode,
+	}
+}
+
+// getAwsHeaderUsage reads the token counts bedrock reports in the response headers
+func getAwsHeaderUsage(header http.Header) (Usage, bool) {
+	inputTokens, err1 := strconv.Atoi(header.Get("X-Amzn-Bedrock-Input-Token-Count"))
+	outputTokens, err2 := strconv.Atoi(header.Get("X-Amzn-Bedrock-Output-Token-Count"))
+	if err1 != nil || err2 != nil {
+		return Usage{}, false
+	}
+	return Usage{
+		PromptTokens:     inputTokens,
+		CompletionTokens: outputTokens,
+		TotalTokens:      inputTokens + outputTokens,
+	}, true
+}
+
+func awsHandler(c *gin.Context, modelName string, awsRequest any, promptTokens int) (*OpenAIErrorWithStatusCode, *Usage) {
+	modelId := getAwsModelId(modelName)
+	resp, openAIErr := doAwsRequest(c, modelId, awsRequest, false)
+	if openAIErr != nil {
+		return openAIErr, nil
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var fullTextResponse *OpenAITextResponse
+	if getAwsModelProvider(modelId) == "anthropic" {
+		var claudeResponse ClaudeMessagesResponse
+		err = json.Unmarshal(responseBody, &claudeResponse)
+		if err != nil {
+			return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		fullTextResponse = responseClaudeMessages2OpenAI(&claudeResponse)
+	} else {
+		var awsResponse AwsResponse
+		err = json.Unmarshal(responseBody, &awsResponse)
+		if err != nil {
+			return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		text, finishReason, usage := awsResponse.getAwsResponseText()
+		fullTextResponse = &OpenAITextResponse{
+			Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
+			Object:  "chat.completion",
+			Created: common.GetTimestamp(),
+			Choices: []OpenAITextResponseChoice{
+				{
+					Index: 0,
+					Message: Message{
+						Role:    "assistant",
+						Content: strings.TrimSpace(text),
+					},
+					FinishReason: stopReasonAws2OpenAI(finishReason),
+				},
+			},
+			Usage: usage,
+		}
+	}
+	if usage, ok := getAwsHeaderUsage(resp.Header); ok {
+		fullTextResponse.Usage = usage
+	}
+	if fullTextResponse.Usage.PromptTokens == 0 {
+		fullTextResponse.Usage.PromptTokens = promptTokens
+	}
+	if fullTextResponse.Usage.CompletionTokens == 0 && len(fullTextResponse.Choices) > 0 {
+		fullTextResponse.Usage.CompletionTokens = countTokenText(fullTextResponse.Choices[0].Message.Content, modelName)
+	}
+	fullTextResponse.Usage.TotalTokens = fullTextResponse.Usage.PromptTokens + fullTextResponse.Usage.CompletionTokens
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+func awsStreamHandler(c *gin.Context, modelName string, awsRequest any, promptTokens int) (*OpenAIErrorWithStatusCode, *Usage) {
+	modelId := getAwsModelId(modelName)
+	resp, openAIErr := doAwsRequest(c, modelId, awsRequest, true)
+	if openAIErr != nil {
+		return openAIErr, nil
+	}
+	var usage Usage
+	responseText := ""
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdTime := common.GetTimestamp()
+	isClaude := getAwsModelProvider(modelId) == "anthropic"
+	decoder := newAwsEventStreamDecoder(resp.Body)
+	dataChan := make(chan []byte)
+	stopChan := make(chan bool)
+	errorChan := make(chan OpenAIError)
+	// closed once the stream is over, so the reader does not block forever after the client is gone
+	done := make(chan struct{})
+	go func() {
+		for {
+			message, err := decoder.Next()
+			if err != nil {
+				if err != io.EOF {
+					common.SysError("error decoding aws event stream: " + err.Error())
+				}
+				break
+			}
+			if message.Headers[":message-type"] != "event" {
+				common.SysError(fmt.Sprintf("error in aws stream response: %s %s", message.Headers[":exception-type"], string(message.Payload)))
+				// exceptions like throttlingException come as {"message": "..."}
+				var exception struct {
+					Message string `json:"message"`
+				}
+				_ = json.Unmarshal(message.Payload, &exception)
+				if exception.Message == "" {
+					exception.Message = string(message.Payload)
+				}
+				select {
+				case errorChan <- OpenAIError{
+					Message: exception.Message,
+					Type:    "aws_error",
+					Code:    message.Headers[":exception-type"],
+				}:
+				case <-done:
+				}
+				return
+			}
+			if message.Headers[":event-type"] != "chunk" {
+				continue
+			}
+			var chunk struct {
+				Bytes []byte `json:"bytes"` // base64 encoded model response
+			}
+			err = json.Unmarshal(message.Payload, &chunk)
+			if err != nil {
+				common.SysError("error unmarshalling aws stream chunk: " + err.Error())
+				continue
+			}
+			select {
+			case dataChan <- chunk.Bytes:
+			case <-done:
+				return
+			}
+		}
+		select {
+		case stopChan <- true:
+		case <-done:
+		}
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			var awsResponse AwsResponse
+			err := json.Unmarshal(data, &awsResponse)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				return true
+			}
+			var response *ChatCompletionsStreamResponse
+			if isClaude {
+				var claudeResponse ClaudeMessagesStreamResponse
+				err = json.Unmarshal(data, &claudeResponse)
+				if err != nil {
+					common.SysError("error unmarshalling stream response: " + err.Error())
+					return true
+				}
+				model := modelName
+				response = streamResponseClaudeMessages2OpenAI(&claudeResponse, &model, &usage)
+			} else {
+				text, finishReason, chunkUsage := awsResponse.getAwsResponseText()
+				if chunkUsage.PromptTokens != 0 {
+					usage.PromptTokens = chunkUsage.PromptTokens
+				}
+				usage.CompletionTokens = chunkUsage.CompletionTokens
+				var choice ChatCompletionsStreamResponseChoice
+				choice.Delta.Content = text
+				if finishReason != "" {
+					finishReason = stopReasonAws2OpenAI(finishReason)
+					choice.FinishReason = &finishReason
+				}
+				response = &ChatCompletionsStreamResponse{
+					Object:  "chat.completion.chunk",
+					Choices: []ChatCompletionsStreamResponseChoice{choice},
+				}
+			}
+			// the last chunk of every provider carries the invocation metrics
+			if awsResponse.InvocationMetrics != nil {
+				usage.PromptTokens = awsResponse.InvocationMetrics.InputTokenCount
+				usage.CompletionTokens = awsResponse.InvocationMetrics.OutputTokenCount
+			}
+			if response == nil {
+				return true
+			}
+			responseText += response.Choices[0].Delta.Content
+			response.Id = responseId
+			response.Created = createdTime
+			response.Model = modelName
+			jsonStr, err := json.Marshal(response)
+			if err != nil {
+				common.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonStr)})
+			return true
+		case openAIError := <-errorChan:
+			renderStreamError(c, openAIError)
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		case <-stopChan:
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+	})
+	close(done)
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = promptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens = countTokenText(responseText, modelName)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return nil, &usage
+}
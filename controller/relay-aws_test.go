@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the get-vanilla, post-vanilla and get-vanilla-query-order-key-case cases of the AWS Signature Version 4 test suite
+func TestSignAwsRequest(t *testing.T) {
+	config := &AwsConfig{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		method    string
+		url       string
+		signature string
+	}{
+		{http.MethodGet, "https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{http.MethodPost, "https://example.amazonaws.com/", "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{http.MethodGet, "https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signAwsRequest(req, nil, config, "service", now)
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + test.signature
+		if authorization := req.Header.Get("Authorization"); authorization != expected {
+			t.Errorf("%s %s: got %s, want %s", test.method, test.url, authorization, expected)
+		}
+		if amzDate := req.Header.Get("X-Amz-Date"); amzDate != "20150830T123600Z" {
+			t.Errorf("%s %s: got X-Amz-Date %s", test.method, test.url, amzDate)
+		}
+	}
+}
+
+func encodeAwsEventStreamMessage(headers map[string]string, payload []byte) []byte {
+	var headerBytes bytes.Buffer
+	for name, value := range headers {
+		headerBytes.WriteByte(byte(len(name)))
+		headerBytes.WriteString(name)
+		headerBytes.WriteByte(7)
+		_ = binary.Write(&headerBytes, binary.BigEndian, uint16(len(value)))
+		headerBytes.WriteString(value)
+	}
+	var message bytes.Buffer
+	_ = binary.Write(&message, binary.BigEndian, uint32(16+headerBytes.Len()+len(payload)))
+	_ = binary.Write(&message, binary.BigEndian, uint32(headerBytes.Len()))
+	_ = binary.Write(&message, binary.BigEndian, crc32.ChecksumIEEE(message.Bytes()))
+	message.Write(headerBytes.Bytes())
+	message.Write(payload)
+	_ = binary.Write(&message, binary.BigEndian, crc32.ChecksumIEEE(message.Bytes()))
+	return message.Bytes()
+}
+
+func TestAwsEventStreamDecoder(t *testing.T) {
+	headers := map[string]string{
+		":message-type": "event",
+		":event-type":   "chunk",
+		":content-type": "application/json",
+	}
+	payload := []byte(`{"bytes":"eyJ0eXBlIjoibWVzc2FnZV9zdG9wIn0="}`)
+	stream := append(encodeAwsEventStreamMessage(headers, payload), encodeAwsEventStreamMessage(headers, nil)...)
+
+	decoder := newAwsEventStreamDecoder(bytes.NewReader(stream))
+	message, err := decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range headers {
+		if message.Headers[name] != value {
+			t.Errorf("header %s: got %q, want %q", name, message.Headers[name], value)
+		}
+	}
+	if !bytes.Equal(message.Payload, payload) {
+		t.Errorf("got payload %s, want %s", message.Payload, payload)
+	}
+	message, err = decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Payload) != 0 {
+		t.Errorf("got payload %s, want an empty payload", message.Payload)
+	}
+	if _, err = decoder.Next(); err != io.EOF {
+		t.Errorf("got %v after the last message, want io.EOF", err)
+	}
+}
+
+func TestAwsEventStreamDecoderChecksumMismatch(t *testing.T) {
+	message := encodeAwsEventStreamMessage(map[string]string{":message-type": "event"}, []byte(`{}`))
+
+	corrupted := append([]byte(nil), message...)
+	corrupted[len(corrupted)-6] ^= 0xff // a byte of the payload
+	if _, err := newAwsEventStreamDecoder(bytes.NewReader(corrupted)).Next(); err == nil || err.Error() != "event stream message checksum mismatch" {
+		t.Errorf("corrupted payload: got %v, want a message checksum mismatch", err)
+	}
+
+	corrupted = append([]byte(nil), message...)
+	corrupted[3] ^= 0x01 // the total length in the prelude
+	if _, err := newAwsEventStreamDecoder(bytes.NewReader(corrupted)).Next(); err == nil || err.Error() != "event stream prelude checksum mismatch" {
+		t.Errorf("corrupted prelude: got %v, want a prelude checksum mismatch", err)
+	}
+}
+
+func TestAwsStreamHandlerForwardsException(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	delta := base64.StdEncoding.EncodeToString([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"},"amazon-bedrock-invocationMetrics":{"inputTokenCount":10,"outputTokenCount":1}}`))
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		_, _ = w.Write(encodeAwsEventStreamMessage(map[string]string{
+			":message-type": "event",
+			":event-type":   "chunk",
+		}, []byte(`{"bytes":"`+delta+`"}`)))
+		_, _ = w.Write(encodeAwsEventStreamMessage(map[string]string{
+			":message-type":   "exception",
+			":exception-type": "throttlingException",
+		}, []byte(`{"message":"Too many requests, please wait before trying again."}`)))
+	}))
+	defer upstream.Close()
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set("base_url", upstream.URL)
+		c.Request.Header.Set("Authorization", "Bearer AKIDEXAMPLE|secret|us-east-1")
+		openAIErr, usage := awsStreamHandler(c, "claude-3-haiku-20240307", map[string]any{}, 10)
+		if openAIErr != nil {
+			t.Errorf("got error %s", openAIErr.Message)
+		} else if usage.CompletionTokens != 1 {
+			t.Errorf("got %d completion tokens, want the 1 of the invocation metrics", usage.CompletionTokens)
+		}
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	response := string(body)
+	hello := strings.Index(response, `"content":"Hello"`)
+	exception := strings.Index(response, `"code":"throttlingException"`)
+	done := strings.Index(response, "data: [DONE]")
+	if hello < 0 || exception < hello || done < exception {
+		t.Errorf("want the chunk, the exception and [DONE] in order, got %s", response)
+	}
+	if !strings.Contains(response, "Too many requests, please wait before trying again.") {
+		t.Errorf("the exception message is missing: %s", response)
+	}
+}
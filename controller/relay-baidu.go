@@ -29,6 +29,7 @@ type BaiduMessage struct {
 type BaiduChatRequest struct {
 	Messages []BaiduMessage `json:"messages"`
 	Stream   bool           `json:"stream"`
+	System   string         `json:"system,omitempty"`
 	UserId   string         `json:"user_id,omitempty"`
 }
 
@@ -81,30 +82,36 @@ type BaiduAccessToken struct {
 	ExpiresAt        time.Time `json:"-"`
 }
 
+// BaiduAccessTokenError is returned when baidu rejects the api key and secret key of the channel
+type BaiduAccessTokenError struct {
+	Message string
+}
+
+func (e *BaiduAccessTokenError) Error() string {
+	return e.Message
+}
+
 var baiduTokenStore sync.Map
 
+// requestOpenAI2Baidu sends the system messages in the system field, since baidu only accepts user and assistant messages
 func requestOpenAI2Baidu(request GeneralOpenAIRequest) *BaiduChatRequest {
 	messages := make([]BaiduMessage, 0, len(request.Messages))
+	var system []string
 	for _, message := range request.Messages {
 		if message.Role == "system" {
-			messages = append(messages, BaiduMessage{
-				Role:    "user",
-				Content: message.Content,
-			})
-			messages = append(messages, BaiduMessage{
-				Role:    "assistant",
-				Content: "Okay",
-			})
-		} else {
-			messages = append(messages, BaiduMessage{
-				Role:    message.Role,
-				Content: message.Content,
-			})
+			system = append(system, message.Content)
+			continue
 		}
+		messages = append(messages, BaiduMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
 	}
 	return &BaiduChatRequest{
 		Messages: messages,
 		Stream:   request.Stream,
+		System:   strings.Join(system, "\n"),
+		UserId:   request.User,
 	}
 }
 
@@ -265,7 +272,7 @@ func baiduHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCo
 	return nil, &fullTextResponse.Usage
 }
 
-func baiduEmbeddingHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+func baiduEmbeddingHandler(c *gin.Context, resp *http.Response, textRequest GeneralOpenAIRequest) (*OpenAIErrorWithStatusCode, *Usage) {
 	var baiduResponse BaiduEmbeddingResponse
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -291,6 +298,8 @@ func baiduEmbeddingHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWit
 		}, nil
 	}
 	fullTextResponse := embeddingResponseBaidu2OpenAI(&baiduResponse)
+	fullTextResponse.Model = textRequest.Model
+	encodeEmbeddingResponse(fullTextResponse, textRequest.EncodingFormat)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -327,7 +336,7 @@ func getBaiduAccessToken(apiKey string) (string, error) {
 func getBaiduAccessTokenHelper(apiKey string) (*BaiduAccessToken, error) {
 	parts := strings.Split(apiKey, "|")
 	if len(parts) != 2 {
-		return nil, errors.New("invalid baidu apikey")
+		return nil, &BaiduAccessTokenError{Message: "invalid baidu apikey"}
 	}
 	req, err := http.NewRequest("POST", fmt.Sprintf("https://aip.baidubce.com/oauth/2.0/token?grant_type=client_credentials&client_id=%s&client_secret=%s",
 		parts[0], parts[1]), nil)
@@ -348,7 +357,7 @@ func getBaiduAccessTokenHelper(apiKey string) (*BaiduAccessToken, error) {
 		return nil, err
 	}
 	if accessToken.Error != "" {
-		return nil, errors.New(accessToken.Error + ": " + accessToken.ErrorDescription)
+		return nil, &BaiduAccessTokenError{Message: accessToken.Error + ": " + accessToken.ErrorDescription}
 	}
 	if accessToken.AccessToken == "" {
 		return nil, errors.New("getBaiduAccessTokenHelper get empty access token")
@@ -357,3 +366,13 @@ func getBaiduAccessTokenHelper(apiKey string) (*BaiduAccessToken, error) {
 	baiduTokenStore.Store(apiKey, accessToken)
 	return &accessToken, nil
 }
+
+// baiduAccessTokenErrorWrapper reports rejected keys as invalid_api_key, so that the channel can be disabled automatically,
+// other errors like timeouts are reported as is
+func baiduAccessTokenErrorWrapper(err error) *OpenAIErrorWithStatusCode {
+	var tokenErr *BaiduAccessTokenError
+	if errors.As(err, &tokenErr) {
+		return errorWrapper(err, "invalid_api_key", http.StatusUnauthorized)
+	}
+	return errorWrapper(err, "get_baidu_access_token_failed", http.StatusInternalServerError)
+}
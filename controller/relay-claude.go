@@ -2,6 +2,7 @@ package controller
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -220,3 +221,329 @@ func claudeHandler(c *gin.Context, resp *http.Response, promptTokens int, model
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &usage
 }
+
+// https://docs.anthropic.com/claude/reference/messages_post
+// the messages API is required for image input
+
+type ClaudeMessagesImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type ClaudeMessagesContent struct {
+	Type   string                     `json:"type"`
+	Text   string                     `json:"text,omitempty"`
+	Source *ClaudeMessagesImageSource `json:"source,omitempty"`
+}
+
+type ClaudeMessagesMessage struct {
+	Role    string                  `json:"role"`
+	Content []ClaudeMessagesContent `json:"content"`
+}
+
+type ClaudeMessagesRequest struct {
+	Model            string                  `json:"model,omitempty"`
+	AnthropicVersion string                  `json:"anthropic_version,omitempty"` // required by aws bedrock and vertex ai
+	Messages         []ClaudeMessagesMessage `json:"messages"`
+	System           string                  `json:"system,omitempty"`
+	MaxTokens        int                     `json:"max_tokens"`
+	Temperature      float64                 `json:"temperature,omitempty"`
+	TopP             float64                 `json:"top_p,omitempty"`
+	Stream           bool                    `json:"stream,omitempty"`
+}
+
+type ClaudeMessagesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type ClaudeMessagesResponse struct {
+	Id         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []ClaudeMessagesContent `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      ClaudeMessagesUsage     `json:"usage"`
+	Error      ClaudeError             `json:"error"`
+}
+
+type ClaudeMessagesStreamResponse struct {
+	Type    string                  `json:"type"`
+	Message *ClaudeMessagesResponse `json:"message,omitempty"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *ClaudeMessagesUsage `json:"usage,omitempty"`
+	Error *ClaudeError         `json:"error,omitempty"`
+}
+
+func stopReasonClaudeMessages2OpenAI(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	default:
+		return reason
+	}
+}
+
+func visionRequestOpenAI2Claude(textRequest VisionOpenAIRequest, images map[string]*imageContent) (*ClaudeMessagesRequest, error) {
+	claudeRequest := ClaudeMessagesRequest{
+		Model:       textRequest.Model,
+		MaxTokens:   textRequest.MaxTokens,
+		Temperature: textRequest.Temperature,
+		TopP:        textRequest.TopP,
+		Stream:      textRequest.Stream,
+	}
+	if claudeRequest.MaxTokens == 0 {
+		claudeRequest.MaxTokens = 4096
+	}
+	for _, message := range textRequest.Messages {
+		contents := message.ParseContent()
+		if message.Role == "system" {
+			for _, content := range contents {
+				claudeRequest.System += content.Text
+			}
+			continue
+		}
+		claudeMessage := ClaudeMessagesMessage{
+			Role:    message.Role,
+			Content: make([]ClaudeMessagesContent, 0, len(contents)),
+		}
+		if claudeMessage.Role != "assistant" {
+			claudeMessage.Role = "user"
+		}
+		for _, content := range contents {
+			if content.ImageURL.URL == "" {
+				claudeMessage.Content = append(claudeMessage.Content, ClaudeMessagesContent{
+					Type: "text",
+					Text: content.Text,
+				})
+				continue
+			}
+			image, err := getImageContent(content.ImageURL.URL, images)
+			if err != nil {
+				return nil, err
+			}
+			claudeMessage.Content = append(claudeMessage.Content, ClaudeMessagesContent{
+				Type: "image",
+				Source: &ClaudeMessagesImageSource{
+					Type:      "base64",
+					MediaType: image.mimeType,
+					Data:      base64.StdEncoding.EncodeToString(image.data),
+				},
+			})
+		}
+		// claude requires the roles to alternate, so merge consecutive messages of the same role
+		last := len(claudeRequest.Messages) - 1
+		if last >= 0 && claudeRequest.Messages[last].Role == claudeMessage.Role {
+			claudeRequest.Messages[last].Content = append(claudeRequest.Messages[last].Content, claudeMessage.Content...)
+			continue
+		}
+		claudeRequest.Messages = append(claudeRequest.Messages, claudeMessage)
+	}
+	return &claudeRequest, nil
+}
+
+func requestOpenAI2ClaudeMessages(textRequest GeneralOpenAIRequest) *ClaudeMessagesRequest {
+	claudeRequest := ClaudeMessagesRequest{
+		Model:       textRequest.Model,
+		MaxTokens:   textRequest.MaxTokens,
+		Temperature: textRequest.Temperature,
+		TopP:        textRequest.TopP,
+		Stream:      textRequest.Stream,
+	}
+	if claudeRequest.MaxTokens == 0 {
+		claudeRequest.MaxTokens = 4096
+	}
+	for _, message := range textRequest.Messages {
+		if message.Role == "system" {
+			claudeRequest.System += message.Content
+			continue
+		}
+		role := "user"
+		if message.Role == "assistant" {
+			role = "assistant"
+		}
+		content := ClaudeMessagesContent{
+			Type: "text",
+			Text: message.Content,
+		}
+		last := len(claudeRequest.Messages) - 1
+		if last >= 0 && claudeRequest.Messages[last].Role == role {
+			claudeRequest.Messages[last].Content = append(claudeRequest.Messages[last].Content, content)
+			continue
+		}
+		claudeRequest.Messages = append(claudeRequest.Messages, ClaudeMessagesMessage{
+			Role:    role,
+			Content: []ClaudeMessagesContent{content},
+		})
+	}
+	return &claudeRequest
+}
+
+func responseClaudeMessages2OpenAI(claudeResponse *ClaudeMessagesResponse) *OpenAITextResponse {
+	content := ""
+	for _, item := range claudeResponse.Content {
+		content += item.Text
+	}
+	choice := OpenAITextResponseChoice{
+		Index: 0,
+		Message: Message{
+			Role:    "assistant",
+			Content: content,
+		},
+		FinishReason: stopReasonClaudeMessages2OpenAI(claudeResponse.StopReason),
+	}
+	fullTextResponse := OpenAITextResponse{
+		Id:      claudeResponse.Id,
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []OpenAITextResponseChoice{choice},
+		Usage: Usage{
+			PromptTokens:     claudeResponse.Usage.InputTokens,
+			CompletionTokens: claudeResponse.Usage.OutputTokens,
+			TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
+		},
+	}
+	return &fullTextResponse
+}
+
+// streamResponseClaudeMessages2OpenAI converts one stream event, the model and usage are tracked across events,
+// it returns nil for events without content
+func streamResponseClaudeMessages2OpenAI(claudeResponse *ClaudeMessagesStreamResponse, model *string, usage *Usage) *ChatCompletionsStreamResponse {
+	var choice ChatCompletionsStreamResponseChoice
+	switch claudeResponse.Type {
+	case "message_start":
+		if claudeResponse.Message != nil {
+			*model = claudeResponse.Message.Model
+			usage.PromptTokens = claudeResponse.Message.Usage.InputTokens
+		}
+		return nil
+	case "content_block_delta":
+		choice.Delta.Content = claudeResponse.Delta.Text
+	case "message_delta":
+		if claudeResponse.Usage != nil {
+			usage.CompletionTokens = claudeResponse.Usage.OutputTokens
+		}
+		finishReason := stopReasonClaudeMessages2OpenAI(claudeResponse.Delta.StopReason)
+		choice.FinishReason = &finishReason
+	case "error":
+		if claudeResponse.Error != nil {
+			common.SysError("error in claude stream response: " + claudeResponse.Error.Message)
+		}
+		return nil
+	default:
+		return nil
+	}
+	return &ChatCompletionsStreamResponse{
+		Object:  "chat.completion.chunk",
+		Model:   *model,
+		Choices: []ChatCompletionsStreamResponseChoice{choice},
+	}
+}
+
+func claudeMessagesStreamHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	var usage Usage
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdTime := common.GetTimestamp()
+	model := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := strings.Index(string(data), "\n"); i >= 0 {
+			return i + 1, data[0:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	dataChan := make(chan string)
+	stopChan := make(chan bool)
+	go func() {
+		for scanner.Scan() {
+			data := strings.TrimSuffix(scanner.Text(), "\r")
+			if !strings.HasPrefix(data, "data:") {
+				continue
+			}
+			dataChan <- strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		}
+		stopChan <- true
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			var claudeResponse ClaudeMessagesStreamResponse
+			err := json.Unmarshal([]byte(data), &claudeResponse)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				return true
+			}
+			response := streamResponseClaudeMessages2OpenAI(&claudeResponse, &model, &usage)
+			if response == nil {
+				return true
+			}
+			response.Id = responseId
+			response.Created = createdTime
+			jsonStr, err := json.Marshal(response)
+			if err != nil {
+				common.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonStr)})
+			return true
+		case <-stopChan:
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+	})
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return nil, &usage
+}
+
+func claudeMessagesHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var claudeResponse ClaudeMessagesResponse
+	err = json.Unmarshal(responseBody, &claudeResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if claudeResponse.Error.Type != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: claudeResponse.Error.Message,
+				Type:    claudeResponse.Error.Type,
+				Param:   "",
+				Code:    claudeResponse.Error.Type,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := responseClaudeMessages2OpenAI(&claudeResponse)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
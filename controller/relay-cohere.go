@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// https://docs.cohere.com/reference/chat
+// https://docs.cohere.com/reference/embed
+// https://docs.cohere.com/reference/rerank
+
+type CohereChatMessage struct {
+	Role    string `json:"role"`
+	Message string `json:"message"`
+}
+
+type CohereChatRequest struct {
+	Model            string              `json:"model,omitempty"`
+	Message          string              `json:"message"`
+	ChatHistory      []CohereChatMessage `json:"chat_history,omitempty"`
+	Preamble         string              `json:"preamble,omitempty"`
+	Stream           bool                `json:"stream,omitempty"`
+	Temperature      float64             `json:"temperature,omitempty"`
+	MaxTokens        int                 `json:"max_tokens,omitempty"`
+	P                float64             `json:"p,omitempty"`
+	Seed             int                 `json:"seed,omitempty"`
+	FrequencyPenalty float64             `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64             `json:"presence_penalty,omitempty"`
+}
+
+type CohereBilledUnits struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	SearchUnits  int `json:"search_units"`
+}
+
+type CohereMeta struct {
+	BilledUnits CohereBilledUnits `json:"billed_units"`
+}
+
+type CohereChatResponse struct {
+	ResponseId   string     `json:"response_id"`
+	GenerationId string     `json:"generation_id"`
+	Text         string     `json:"text"`
+	FinishReason string     `json:"finish_reason"`
+	Meta         CohereMeta `json:"meta"`
+	Message      string     `json:"message,omitempty"`
+}
+
+type CohereChatStreamResponse struct {
+	EventType    string              `json:"event_type"`
+	IsFinished   bool                `json:"is_finished"`
+	GenerationId string              `json:"generation_id,omitempty"`
+	Text         string              `json:"text,omitempty"`
+	FinishReason string              `json:"finish_reason,omitempty"`
+	Response     *CohereChatResponse `json:"response,omitempty"`
+}
+
+type CohereEmbeddingRequest struct {
+	Model     string   `json:"model"`
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type,omitempty"`
+}
+
+type CohereEmbeddingResponse struct {
+	Id         string      `json:"id"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Meta       CohereMeta  `json:"meta"`
+	Message    string      `json:"message,omitempty"`
+}
+
+type CohereRerankResponse struct {
+	Id      string         `json:"id"`
+	Results []RerankResult `json:"results"`
+	Meta    CohereMeta     `json:"meta"`
+	Message string         `json:"message,omitempty"`
+}
+
+// cohere bills rerank by search units, a query with no more than 100 documents is one search unit,
+// so the ratios of the cohere rerank models are priced per search unit rather than per token
+const cohereDocumentsPerSearchUnit = 100
+
+func getCohereSearchUnits(documents int) int {
+	return (documents + cohereDocumentsPerSearchUnit - 1) / cohereDocumentsPerSearchUnit
+}
+
+// v3 embedding models require the input type, OpenAI style "query" and "document" are accepted as well
+func getCohereInputType(inputType string) string {
+	switch inputType {
+	case "":
+		return "search_document"
+	case "query":
+		return "search_query"
+	case "document":
+		return "search_document"
+	default:
+		return inputType
+	}
+}
+
+func requestOpenAI2Cohere(textRequest GeneralOpenAIRequest) *CohereChatRequest {
+	cohereRequest := CohereChatRequest{
+		Model:            textRequest.Model,
+		Stream:           textRequest.Stream,
+		Temperature:      textRequest.Temperature,
+		MaxTokens:        textRequest.MaxTokens,
+		P:                textRequest.TopP,
+		Seed:             int(textRequest.Seed),
+		FrequencyPenalty: textRequest.FrequencyPenalty,
+		PresencePenalty:  textRequest.PresencePenalty,
+	}
+	messages := textRequest.Messages
+	// the leading system messages become the preamble
+	for len(messages) > 0 && messages[0].Role == "system" {
+		if cohereRequest.Preamble != "" {
+			cohereRequest.Preamble += "\n"
+		}
+		cohereRequest.Preamble += messages[0].Content
+		messages = messages[1:]
+	}
+	// the last message is sent as the message, the others are the chat history
+	if len(messages) > 0 {
+		cohereRequest.Message = messages[len(messages)-1].Content
+		messages = messages[:len(messages)-1]
+	}
+	for _, message := range messages {
+		role := "USER"
+		switch message.Role {
+		case "assistant":
+			role = "CHATBOT"
+		case "system":
+			role = "SYSTEM"
+		}
+		cohereRequest.ChatHistory = append(cohereRequest.ChatHistory, CohereChatMessage{
+			Role:    role,
+			Message: message.Content,
+		})
+	}
+	return &cohereRequest
+}
+
+func stopReasonCohere2OpenAI(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "ERROR_TOXIC":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func getCohereUsage(meta CohereMeta) Usage {
+	return Usage{
+		PromptTokens:     meta.BilledUnits.InputTokens,
+		CompletionTokens: meta.BilledUnits.OutputTokens,
+		TotalTokens:      meta.BilledUnits.InputTokens + meta.BilledUnits.OutputTokens,
+	}
+}
+
+func responseCohere2OpenAI(response *CohereChatResponse) *OpenAITextResponse {
+	choice := OpenAITextResponseChoice{
+		Index: 0,
+		Message: Message{
+			Role:    "assistant",
+			Content: response.Text,
+		},
+		FinishReason: stopReasonCohere2OpenAI(response.FinishReason),
+	}
+	fullTextResponse := OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", response.ResponseId),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []OpenAITextResponseChoice{choice},
+		Usage:   getCohereUsage(response.Meta),
+	}
+	return &fullTextResponse
+}
+
+func streamResponseCohere2OpenAI(cohereResponse *CohereChatStreamResponse) *ChatCompletionsStreamResponse {
+	var choice ChatCompletionsStreamResponseChoice
+	switch cohereResponse.EventType {
+	case "text-generation":
+		choice.Delta.Content = cohereResponse.Text
+	case "stream-end":
+		finishReason := stopReasonCohere2OpenAI(cohereResponse.FinishReason)
+		choice.FinishReason = &finishReason
+	default:
+		// stream-start, search results and citations are not forwarded
+		return nil
+	}
+	response := ChatCompletionsStreamResponse{
+		Object:  "chat.completion.chunk",
+		Created: common.GetTimestamp(),
+		Choices: []ChatCompletionsStreamResponseChoice{choice},
+	}
+	return &response
+}
+
+func cohereStreamHandler(c *gin.Context, resp *http.Response, model string) (*OpenAIErrorWithStatusCode, *Usage) {
+	var usage Usage
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	dataChan := make(chan string)
+	stopChan := make(chan bool)
+	go func() {
+		for scanner.Scan() {
+			data := strings.TrimSpace(scanner.Text())
+			if data == "" {
+				continue
+			}
+			dataChan <- data
+		}
+		stopChan <- true
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			var cohereResponse CohereChatStreamResponse
+			err := json.Unmarshal([]byte(data), &cohereResponse)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				return true
+			}
+			if cohereResponse.EventType == "stream-end" && cohereResponse.Response != nil {
+				usage = getCohereUsage(cohereResponse.Response.Meta)
+			}
+			response := streamResponseCohere2OpenAI(&cohereResponse)
+			if response == nil {
+				return true
+			}
+			response.Id = responseId
+			response.Model = model
+			jsonResponse, err := json.Marshal(response)
+			if err != nil {
+				common.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+			return true
+		case <-stopChan:
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+	})
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &usage
+}
+
+func cohereHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	var cohereResponse CohereChatResponse
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.ResponseId == "" && cohereResponse.Message != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: cohereResponse.Message,
+				Type:    "cohere_error",
+				Param:   "",
+				Code:    "cohere_error",
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := responseCohere2OpenAI(&cohereResponse)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+func embeddingRequestOpenAI2Cohere(request GeneralOpenAIRequest) *CohereEmbeddingRequest {
+	return &CohereEmbeddingRequest{
+		Model:     request.Model,
+		Texts:     request.ParseInput(),
+		InputType: getCohereInputType(request.InputType),
+	}
+}
+
+func cohereEmbeddingHandler(c *gin.Context, resp *http.Response, textRequest GeneralOpenAIRequest) (*OpenAIErrorWithStatusCode, *Usage) {
+	var cohereResponse CohereEmbeddingResponse
+	err := json.NewDecoder(resp.Body).Decode(&cohereResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Id == "" && cohereResponse.Message != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: cohereResponse.Message,
+				Type:    "cohere_error",
+				Param:   "",
+				Code:    "cohere_error",
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]OpenAIEmbeddingResponseItem, 0, len(cohereResponse.Embeddings)),
+		Model:  textRequest.Model,
+		Usage:  getCohereUsage(cohereResponse.Meta),
+	}
+	for i, embedding := range cohereResponse.Embeddings {
+		fullTextResponse.Data = append(fullTextResponse.Data, OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
+	}
+	encodeEmbeddingResponse(&fullTextResponse, textRequest.EncodingFormat)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+func cohereRerankHandler(resp *http.Response) (*OpenAIErrorWithStatusCode, *RerankResponse) {
+	var cohereResponse CohereRerankResponse
+	err := json.NewDecoder(resp.Body).Decode(&cohereResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Id == "" && cohereResponse.Message != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: cohereResponse.Message,
+				Type:    "cohere_error",
+				Param:   "",
+				Code:    "cohere_error",
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	return nil, &RerankResponse{
+		Id:      cohereResponse.Id,
+		Results: cohereResponse.Results,
+		Usage: Usage{
+			PromptTokens: cohereResponse.Meta.BilledUnits.SearchUnits,
+			TotalTokens:  cohereResponse.Meta.BilledUnits.SearchUnits,
+		},
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"strconv"
+)
+
+// openAICompatibleVendor describes the differences of vendors speaking the OpenAI API
+type openAICompatibleVendor struct {
+	// parameters rejected by the vendor, they are stripped before forwarding
+	UnsupportedParams []string
+	// parameters named differently by the vendor
+	RenamedParams map[string]string
+	// vendor error types, codes or status codes mapped to the OpenAI error types,
+	// so that the channel can be disabled automatically, e.g. when the balance is used up
+	ErrorTypes map[string]string
+}
+
+var openAICompatibleVendors = map[int]openAICompatibleVendor{
+	// https://docs.mistral.ai/api/
+	common.ChannelTypeMistral: {
+		UnsupportedParams: []string{"n", "user", "logit_bias", "logprobs", "top_logprobs", "frequency_penalty", "presence_penalty", "functions", "function_call"},
+		RenamedParams: map[string]string{
+			"seed": "random_seed",
+		},
+	},
+	// https://platform.deepseek.com/api-docs/
+	common.ChannelTypeDeepSeek: {
+		UnsupportedParams: []string{"n", "logit_bias", "functions", "function_call"},
+		ErrorTypes: map[string]string{
+			"402": "insufficient_quota",
+		},
+	},
+	// https://platform.moonshot.cn/docs/api-reference
+	common.ChannelTypeMoonshot: {
+		UnsupportedParams: []string{"user", "seed", "logit_bias", "logprobs", "top_logprobs", "functions", "function_call"},
+		ErrorTypes: map[string]string{
+			"exceeded_current_quota_error": "insufficient_quota",
+			"invalid_authentication_error": "invalid_api_key",
+		},
+	},
+	// https://console.groq.com/docs/openai
+	common.ChannelTypeGroq: {
+		UnsupportedParams: []string{"n", "logit_bias", "logprobs", "top_logprobs", "functions", "function_call"},
+	},
+	// https://docs.siliconflow.cn/reference/chat-completions-1
+	common.ChannelTypeSiliconFlow: {
+		UnsupportedParams: []string{"user", "seed", "logit_bias", "logprobs", "top_logprobs", "functions", "function_call"},
+		ErrorTypes: map[string]string{
+			"30001": "insufficient_quota",
+		},
+	},
+}
+
+// filterOpenAICompatibleRequest strips and renames the parameters of a chat request for the vendor,
+// unknown fields of the original request are kept
+func filterOpenAICompatibleRequest(requestBody io.Reader, vendor openAICompatibleVendor) (io.Reader, error) {
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	var request map[string]json.RawMessage
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range vendor.UnsupportedParams {
+		delete(request, param)
+	}
+	for from, to := range vendor.RenamedParams {
+		if value, ok := request[from]; ok {
+			request[to] = value
+			delete(request, from)
+		}
+	}
+	jsonStr, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(jsonStr), nil
+}
+
+// openAICompatibleErrorHandler also accepts errors at the top level of the response,
+// e.g. {"code": 30001, "message": "..."}, and the validation errors of mistral whose message is an object
+func openAICompatibleErrorHandler(resp *http.Response, vendor openAICompatibleVendor) *OpenAIErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
+	openAIErr := relayErrorHandler(resp)
+	var vendorError struct {
+		Error   json.RawMessage `json:"error"`
+		Message json.RawMessage `json:"message"`
+		Type    string          `json:"type"`
+		Code    any             `json:"code"`
+		Detail  json.RawMessage `json:"detail"`
+	}
+	if json.Unmarshal(responseBody, &vendorError) == nil && len(vendorError.Error) == 0 {
+		if message := getOpenAICompatibleErrorMessage(vendorError.Message, vendorError.Detail); message != "" {
+			openAIErr.Message = message
+		}
+		if vendorError.Type != "" {
+			openAIErr.Type = vendorError.Type
+		}
+		if vendorError.Code != nil {
+			openAIErr.Code = vendorError.Code
+		}
+	}
+	if openAIErr.Message == "" {
+		openAIErr.Message = fmt.Sprintf("bad response status code %d", resp.StatusCode)
+	}
+	for _, key := range []string{openAIErr.Type, fmt.Sprint(openAIErr.Code), strconv.Itoa(resp.StatusCode)} {
+		if errorType, ok := vendor.ErrorTypes[key]; ok {
+			openAIErr.Type = errorType
+			openAIErr.Code = errorType
+			break
+		}
+	}
+	return openAIErr
+}
+
+func getOpenAICompatibleErrorMessage(message json.RawMessage, detail json.RawMessage) string {
+	for _, raw := range []json.RawMessage{message, detail} {
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			return text
+		}
+		var compacted bytes.Buffer
+		if json.Compact(&compacted, raw) == nil {
+			return compacted.String()
+		}
+	}
+	return ""
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -303,3 +304,162 @@ func geminiChatHandler(c *gin.Context, resp *http.Response, promptTokens int, mo
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &usage
 }
+
+// https://ai.google.dev/api/rest/v1/models/embedContent
+// https://ai.google.dev/api/rest/v1/models/batchEmbedContents
+
+type GeminiEmbeddingRequest struct {
+	Model                string            `json:"model"`
+	Content              GeminiChatContent `json:"content"`
+	OutputDimensionality int               `json:"outputDimensionality,omitempty"`
+}
+
+type GeminiBatchEmbeddingRequest struct {
+	Requests []GeminiEmbeddingRequest `json:"requests"`
+}
+
+type GeminiEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+type GeminiEmbeddingResponse struct {
+	Embedding  *GeminiEmbedding  `json:"embedding,omitempty"`
+	Embeddings []GeminiEmbedding `json:"embeddings,omitempty"`
+}
+
+func getGeminiEmbeddingAction(request GeneralOpenAIRequest) string {
+	if len(request.ParseInput()) == 1 {
+		return "embedContent"
+	}
+	return "batchEmbedContents"
+}
+
+func embeddingRequestOpenAI2Gemini(request GeneralOpenAIRequest) any {
+	inputs := request.ParseInput()
+	requests := make([]GeminiEmbeddingRequest, 0, len(inputs))
+	for _, input := range inputs {
+		requests = append(requests, GeminiEmbeddingRequest{
+			Model: "models/" + request.Model,
+			Content: GeminiChatContent{
+				Parts: []GeminiPart{
+					{
+						Text: input,
+					},
+				},
+			},
+			OutputDimensionality: request.Dimensions,
+		})
+	}
+	if len(requests) == 1 {
+		return requests[0]
+	}
+	return GeminiBatchEmbeddingRequest{
+		Requests: requests,
+	}
+}
+
+func embeddingResponseGemini2OpenAI(response *GeminiEmbeddingResponse) *OpenAIEmbeddingResponse {
+	embeddings := response.Embeddings
+	if response.Embedding != nil {
+		embeddings = []GeminiEmbedding{*response.Embedding}
+	}
+	openAIEmbeddingResponse := OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]OpenAIEmbeddingResponseItem, 0, len(embeddings)),
+	}
+	for i, embedding := range embeddings {
+		openAIEmbeddingResponse.Data = append(openAIEmbeddingResponse.Data, OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding.Values,
+		})
+	}
+	return &openAIEmbeddingResponse
+}
+
+func geminiEmbeddingHandler(c *gin.Context, resp *http.Response, promptTokens int, textRequest GeneralOpenAIRequest) (*OpenAIErrorWithStatusCode, *Usage) {
+	var geminiResponse GeminiEmbeddingResponse
+	err := json.NewDecoder(resp.Body).Decode(&geminiResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	fullTextResponse := embeddingResponseGemini2OpenAI(&geminiResponse)
+	if len(fullTextResponse.Data) == 0 {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: "No embeddings returned",
+				Type:    "server_error",
+				Param:   "",
+				Code:    500,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	// gemini does not return usage for embeddings
+	fullTextResponse.Model = textRequest.Model
+	fullTextResponse.Usage = Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+	encodeEmbeddingResponse(fullTextResponse, textRequest.EncodingFormat)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+func visionRequestOpenAI2Gemini(textRequest VisionOpenAIRequest, images map[string]*imageContent) (*GeminiChatRequest, error) {
+	geminiRequest := GeminiChatRequest{
+		Contents: make([]GeminiChatContent, 0, len(textRequest.Messages)),
+		GenerationConfig: GeminiChatGenerationConfig{
+			Temperature:     textRequest.Temperature,
+			TopP:            textRequest.TopP,
+			MaxOutputTokens: textRequest.MaxTokens,
+		},
+	}
+	for _, message := range textRequest.Messages {
+		content := GeminiChatContent{
+			Role: message.Role,
+		}
+		for _, part := range message.ParseContent() {
+			if part.ImageURL.URL == "" {
+				content.Parts = append(content.Parts, GeminiPart{
+					Text: part.Text,
+				})
+				continue
+			}
+			image, err := getImageContent(part.ImageURL.URL, images)
+			if err != nil {
+				return nil, err
+			}
+			content.Parts = append(content.Parts, GeminiPart{
+				InlineData: &GeminiInlineData{
+					MimeType: image.mimeType,
+					Data:     base64.StdEncoding.EncodeToString(image.data),
+				},
+			})
+		}
+		// gemini only has user and model roles, and the vision model does not support multi-turn chat,
+		// so system prompts are sent as user messages
+		if content.Role == "assistant" {
+			content.Role = "model"
+		} else {
+			content.Role = "user"
+		}
+		last := len(geminiRequest.Contents) - 1
+		if last >= 0 && geminiRequest.Contents[last].Role == content.Role {
+			geminiRequest.Contents[last].Parts = append(geminiRequest.Contents[last].Parts, content.Parts...)
+			continue
+		}
+		geminiRequest.Contents = append(geminiRequest.Contents, content)
+	}
+	return &geminiRequest, nil
+}
@@ -133,16 +133,27 @@ func relayImageHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	modelRatio := common.GetModelRatio(imageModel)
 	groupRatio := common.GetGroupRatio(group)
 	ratio := modelRatio * groupRatio
-	userQuota, err := model.CacheGetUserQuota(userId)
-
 	quota := int(ratio*imageCostRatio*1000) * imageRequest.N
+	baseQuota := int(modelRatio*imageCostRatio*1000) * imageRequest.N
+	// a model with a price is billed by its fee per image
+	if billing := common.GetModelBilling(imageModel); billing.RequestQuota > 0 {
+		quota = int(billing.RequestQuota*groupRatio*imageCostRatio) * imageRequest.N
+		baseQuota = int(billing.RequestQuota*imageCostRatio) * imageRequest.N
+	}
+	cost := getChannelCost(c).imageQuota(imageModel, baseQuota, imageCostRatio, imageRequest.N)
 
-	if consumeQuota && userQuota-quota < 0 {
-		return errorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	var reservation *model.QuotaReservation
+	if consumeQuota {
+		var openAIErr *OpenAIErrorWithStatusCode
+		reservation, openAIErr = reserveQuota(userId, tokenId, quota)
+		if openAIErr != nil {
+			return openAIErr
+		}
 	}
 
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
+		go releaseQuota(c.Request.Context(), reservation)
 		return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
 	}
 	token := c.Request.Header.Get("Authorization")
@@ -158,33 +169,22 @@ func relayImageHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
+		go releaseQuota(c.Request.Context(), reservation)
 		return errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
-	err = req.Body.Close()
-	if err != nil {
-		return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
-	}
-	err = c.Request.Body.Close()
-	if err != nil {
-		return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
-	}
 	var textResponse ImageResponse
 
 	defer func(ctx context.Context) {
 		if consumeQuota {
-			err := model.PostConsumeTokenQuota(tokenId, quota)
+			err := reservation.Settle(quota)
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
 			}
-			err = model.CacheUpdateUserQuota(userId)
-			if err != nil {
-				common.SysError("error update user quota cache: " + err.Error())
-			}
 			if quota != 0 {
 				tokenName := c.GetString("token_name")
 				logContent := fmt.Sprintf("Model multiplier %.2f, basic multiplier %.2f", modelRatio, groupRatio)
-				model.RecordConsumeLog(ctx, userId, channelId, 0, 0, imageModel, tokenName, quota, logContent)
+				model.RecordConsumeLog(ctx, userId, channelId, 0, 0, imageModel, tokenName, group, quota, cost, logContent)
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
@@ -192,6 +192,15 @@ func relayImageHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 		}
 	}(c.Request.Context())
 
+	err = req.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+	}
+	err = c.Request.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+	}
+
 	if consumeQuota {
 		responseBody, err := io.ReadAll(resp.Body)
 
@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// https://github.com/ollama/ollama/blob/main/docs/api.md
+
+type OllamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+type OllamaOptions struct {
+	Temperature      float64 `json:"temperature,omitempty"`
+	TopP             float64 `json:"top_p,omitempty"`
+	NumPredict       int     `json:"num_predict,omitempty"`
+	Seed             int     `json:"seed,omitempty"`
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+}
+
+type OllamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   string          `json:"format,omitempty"`
+	Options  *OllamaOptions  `json:"options,omitempty"`
+}
+
+type OllamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+type OllamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type OllamaEmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type OllamaTagsResponse struct {
+	Models []struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	} `json:"models"`
+}
+
+func requestOpenAI2Ollama(request GeneralOpenAIRequest) *OllamaChatRequest {
+	messages := make([]OllamaMessage, 0, len(request.Messages))
+	for _, message := range request.Messages {
+		messages = append(messages, OllamaMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	ollamaRequest := OllamaChatRequest{
+		Model:    request.Model,
+		Messages: messages,
+		Stream:   request.Stream,
+		Options: &OllamaOptions{
+			Temperature:      request.Temperature,
+			TopP:             request.TopP,
+			NumPredict:       request.MaxTokens,
+			Seed:             int(request.Seed),
+			FrequencyPenalty: request.FrequencyPenalty,
+			PresencePenalty:  request.PresencePenalty,
+		},
+	}
+	if request.ResponseFormat != nil && request.ResponseFormat.Type == "json_object" {
+		ollamaRequest.Format = "json"
+	}
+	return &ollamaRequest
+}
+
+func stopReasonOllama2OpenAI(reason string) string {
+	switch reason {
+	case "length":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+func getOllamaCreatedTime(createdAt string) int64 {
+	created, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return common.GetTimestamp()
+	}
+	return created.Unix()
+}
+
+func responseOllama2OpenAI(response *OllamaChatResponse) *OpenAITextResponse {
+	choice := OpenAITextResponseChoice{
+		Index: 0,
+		Message: Message{
+			Role:    "assistant",
+			Content: response.Message.Content,
+		},
+		FinishReason: stopReasonOllama2OpenAI(response.DoneReason),
+	}
+	fullTextResponse := OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
+		Object:  "chat.completion",
+		Created: getOllamaCreatedTime(response.CreatedAt),
+		Choices: []OpenAITextResponseChoice{choice},
+		Usage: Usage{
+			PromptTokens:     response.PromptEvalCount,
+			CompletionTokens: response.EvalCount,
+			TotalTokens:      response.PromptEvalCount + response.EvalCount,
+		},
+	}
+	return &fullTextResponse
+}
+
+func streamResponseOllama2OpenAI(ollamaResponse *OllamaChatResponse) *ChatCompletionsStreamResponse {
+	var choice ChatCompletionsStreamResponseChoice
+	choice.Delta.Content = ollamaResponse.Message.Content
+	if ollamaResponse.Done {
+		finishReason := stopReasonOllama2OpenAI(ollamaResponse.DoneReason)
+		choice.FinishReason = &finishReason
+	}
+	response := ChatCompletionsStreamResponse{
+		Object:  "chat.completion.chunk",
+		Created: getOllamaCreatedTime(ollamaResponse.CreatedAt),
+		Model:   ollamaResponse.Model,
+		Choices: []ChatCompletionsStreamResponseChoice{choice},
+	}
+	return &response
+}
+
+// ollamaStreamHandler converts the newline delimited json stream to server sent events
+func ollamaStreamHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	var usage Usage
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	dataChan := make(chan string)
+	stopChan := make(chan bool)
+	// closed once the stream is over, so the reader does not block forever after an error
+	done := make(chan struct{})
+	go func() {
+		for scanner.Scan() {
+			data := strings.TrimSpace(scanner.Text())
+			if data == "" {
+				continue
+			}
+			select {
+			case dataChan <- data:
+			case <-done:
+				return
+			}
+		}
+		select {
+		case stopChan <- true:
+		case <-done:
+		}
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			var ollamaResponse OllamaChatResponse
+			err := json.Unmarshal([]byte(data), &ollamaResponse)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				return true
+			}
+			if ollamaResponse.Error != "" {
+				common.SysError("error in ollama stream response: " + ollamaResponse.Error)
+				renderStreamError(c, OpenAIError{
+					Message: ollamaResponse.Error,
+					Type:    "ollama_error",
+					Code:    "ollama_error",
+				})
+				c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+				return false
+			}
+			if ollamaResponse.Done {
+				usage.PromptTokens = ollamaResponse.PromptEvalCount
+				usage.CompletionTokens = ollamaResponse.EvalCount
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			}
+			response := streamResponseOllama2OpenAI(&ollamaResponse)
+			response.Id = responseId
+			jsonResponse, err := json.Marshal(response)
+			if err != nil {
+				common.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+			return true
+		case <-stopChan:
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+	})
+	close(done)
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &usage
+}
+
+func ollamaHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCode, *Usage) {
+	var ollamaResponse OllamaChatResponse
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = json.Unmarshal(responseBody, &ollamaResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if ollamaResponse.Error != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: ollamaResponse.Error,
+				Type:    "ollama_error",
+				Param:   "",
+				Code:    "ollama_error",
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := responseOllama2OpenAI(&ollamaResponse)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+// ollamaErrorHandler reads errors like {"error": "model 'llama2' not found"}
+func ollamaErrorHandler(resp *http.Response) *OpenAIErrorWithStatusCode {
+	openAIErrorWithStatusCode := &OpenAIErrorWithStatusCode{
+		StatusCode: resp.StatusCode,
+		OpenAIError: OpenAIError{
+			Message: fmt.Sprintf("bad response status code %d", resp.StatusCode),
+			Type:    "ollama_error",
+			Code:    "bad_response_status_code",
+			Param:   strconv.Itoa(resp.StatusCode),
+		},
+	}
+	var ollamaResponse OllamaEmbeddingResponse
+	err := json.NewDecoder(resp.Body).Decode(&ollamaResponse)
+	_ = resp.Body.Close()
+	if err == nil && ollamaResponse.Error != "" {
+		openAIErrorWithStatusCode.OpenAIError.Message = ollamaResponse.Error
+	}
+	return openAIErrorWithStatusCode
+}
+
+// ollamaEmbeddingHandler sends one request per input, the usage is estimated since ollama does not return it
+func ollamaEmbeddingHandler(c *gin.Context, textRequest GeneralOpenAIRequest, baseURL string, promptTokens int) (*OpenAIErrorWithStatusCode, *Usage) {
+	fullRequestURL := fmt.Sprintf("%s/api/embeddings", baseURL)
+	fullTextResponse := OpenAIEmbeddingResponse{
+		Object: "list",
+		Model:  textRequest.Model,
+	}
+	for i, input := range textRequest.ParseInput() {
+		jsonData, err := json.Marshal(OllamaEmbeddingRequest{Model: textRequest.Model, Prompt: input})
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError), nil
+		}
+		req, err := http.NewRequest(http.MethodPost, fullRequestURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return errorWrapper(err, "new_request_failed", http.StatusInternalServerError), nil
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return errorWrapper(err, "do_request_failed", http.StatusInternalServerError), nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return ollamaErrorHandler(resp), nil
+		}
+		var ollamaResponse OllamaEmbeddingResponse
+		err = json.NewDecoder(resp.Body).Decode(&ollamaResponse)
+		closeErr := resp.Body.Close()
+		if err != nil {
+			return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		if closeErr != nil {
+			return errorWrapper(closeErr, "close_response_body_failed", http.StatusInternalServerError), nil
+		}
+		fullTextResponse.Data = append(fullTextResponse.Data, OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: ollamaResponse.Embedding,
+		})
+	}
+	fullTextResponse.Usage.PromptTokens = promptTokens
+	fullTextResponse.Usage.TotalTokens = promptTokens
+	encodeEmbeddingResponse(&fullTextResponse, textRequest.EncodingFormat)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// The realtime endpoint keeps one websocket open and relays every message through the
+// regular /v1/chat/completions pipeline, so token auth, channel selection, billing and
+// logging all happen per message exactly as they do for plain HTTP requests.
+
+const (
+	RealtimeTypeDelta    = "delta"
+	RealtimeTypeDone     = "done"
+	RealtimeTypeResponse = "response"
+	RealtimeTypeError    = "error"
+)
+
+const realtimeMaxMessageSize = 16 << 20 // 16 MB
+const realtimePingInterval = 30 * time.Second
+const realtimePongWait = 60 * time.Second
+
+type RealtimeRequest struct {
+	Id      string          `json:"id"`
+	Request json.RawMessage `json:"request"`
+}
+
+type RealtimeResponse struct {
+	Id    string          `json:"id"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *OpenAIError    `json:"error,omitempty"`
+}
+
+var realtimeUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Any origin is accepted, the connection is authenticated by the Authorization header
+	// only, which browsers never attach to a cross-site websocket handshake on their own,
+	// so a foreign page cannot open a connection on behalf of a logged-in user
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+type realtimeSession struct {
+	conn          *websocket.Conn
+	writeLock     sync.Mutex
+	ctx           context.Context
+	handler       http.Handler
+	authorization string
+	remoteAddr    string
+	requests      chan struct{} // limits the requests running at the same time
+}
+
+func (s *realtimeSession) send(response RealtimeResponse) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	err := s.conn.WriteJSON(response)
+	if err != nil {
+		common.SysError("error writing realtime response: " + err.Error())
+	}
+}
+
+func (s *realtimeSession) sendError(id string, err error, code string) {
+	openAIError := errorWrapper(err, code, http.StatusBadRequest).OpenAIError
+	s.send(RealtimeResponse{
+		Id:    id,
+		Type:  RealtimeTypeError,
+		Error: &openAIError,
+	})
+}
+
+func (s *realtimeSession) ping() error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+// realtimeResponseWriter turns what the relay handlers write into websocket frames.
+// SSE events are forwarded one by one, everything else is buffered until the relay returns.
+type realtimeResponseWriter struct {
+	id          string
+	session     *realtimeSession
+	header      http.Header
+	statusCode  int
+	buffer      bytes.Buffer
+	streaming   bool
+	doneSent    bool
+	closeNotify chan bool
+}
+
+func newRealtimeResponseWriter(id string, session *realtimeSession) *realtimeResponseWriter {
+	return &realtimeResponseWriter{
+		id:          id,
+		session:     session,
+		header:      make(http.Header),
+		closeNotify: make(chan bool, 1),
+	}
+}
+
+func (w *realtimeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *realtimeResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *realtimeResponseWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.buffer.Write(data)
+	if w.statusCode == http.StatusOK && strings.HasPrefix(w.header.Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		w.flushEvents()
+	}
+	return len(data), nil
+}
+
+func (w *realtimeResponseWriter) Flush() {}
+
+func (w *realtimeResponseWriter) CloseNotify() <-chan bool {
+	return w.closeNotify
+}
+
+func (w *realtimeResponseWriter) flushEvents() {
+	for {
+		content := w.buffer.String()
+		i := strings.Index(content, "\n\n")
+		if i < 0 {
+			return
+		}
+		w.buffer.Next(i + 2)
+		w.handleEvent(content[:i])
+	}
+}
+
+func (w *realtimeResponseWriter) handleEvent(event string) {
+	for _, line := range strings.Split(event, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if strings.HasPrefix(data, "[DONE]") {
+			w.sendDone()
+			continue
+		}
+		if !json.Valid([]byte(data)) {
+			continue
+		}
+		w.session.send(RealtimeResponse{
+			Id:   w.id,
+			Type: RealtimeTypeDelta,
+			Data: json.RawMessage(data),
+		})
+	}
+}
+
+func (w *realtimeResponseWriter) sendDone() {
+	if w.doneSent {
+		return
+	}
+	w.doneSent = true
+	w.session.send(RealtimeResponse{
+		Id:   w.id,
+		Type: RealtimeTypeDone,
+	})
+}
+
+func (w *realtimeResponseWriter) finish() {
+	if w.streaming {
+		if w.buffer.Len() > 0 {
+			w.buffer.WriteString("\n\n")
+			w.flushEvents()
+		}
+		w.sendDone()
+		return
+	}
+	body := w.buffer.Bytes()
+	if w.statusCode != http.StatusOK {
+		var errResponse GeneralErrorResponse
+		openAIError := OpenAIError{
+			Message: fmt.Sprintf("bad response status code %d", w.statusCode),
+			Type:    "upstream_error",
+			Code:    "bad_response_status_code",
+		}
+		if err := json.Unmarshal(body, &errResponse); err == nil {
+			if errResponse.Error.Message != "" {
+				openAIError = errResponse.Error
+			} else if message := errResponse.ToMessage(); message != "" {
+				openAIError.Message = message
+			}
+		}
+		w.session.send(RealtimeResponse{
+			Id:    w.id,
+			Type:  RealtimeTypeError,
+			Error: &openAIError,
+		})
+		return
+	}
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	w.session.send(RealtimeResponse{
+		Id:   w.id,
+		Type: RealtimeTypeResponse,
+		Data: body,
+	})
+}
+
+// reject answers a message that arrives while too many requests are running
+func (s *realtimeSession) reject(message []byte) {
+	var realtimeRequest RealtimeRequest
+	_ = json.Unmarshal(message, &realtimeRequest)
+	s.sendError(realtimeRequest.Id, fmt.Errorf("too many concurrent requests, at most %d are allowed", cap(s.requests)), "too_many_concurrent_requests")
+}
+
+func (s *realtimeSession) handle(message []byte) {
+	var realtimeRequest RealtimeRequest
+	err := json.Unmarshal(message, &realtimeRequest)
+	if err != nil {
+		s.sendError("", err, "invalid_realtime_message")
+		return
+	}
+	if len(realtimeRequest.Request) == 0 {
+		s.sendError(realtimeRequest.Id, fmt.Errorf("field request is required"), "required_field_missing")
+		return
+	}
+	requestURL := "/v1/chat/completions"
+	for {
+		req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, requestURL, bytes.NewReader(realtimeRequest.Request))
+		if err != nil {
+			s.sendError(realtimeRequest.Id, err, "new_request_failed")
+			return
+		}
+		req.RemoteAddr = s.remoteAddr
+		req.Header.Set("Authorization", s.authorization)
+		req.Header.Set("Content-Type", "application/json")
+		writer := newRealtimeResponseWriter(realtimeRequest.Id, s)
+		finished := make(chan struct{})
+		go func() {
+			select {
+			case <-s.ctx.Done():
+				writer.closeNotify <- true
+			case <-finished:
+			}
+		}()
+		s.handler.ServeHTTP(writer, req)
+		close(finished)
+		// Relay retries by redirecting to the same path, so follow it with the same body
+		if writer.statusCode == http.StatusTemporaryRedirect && writer.header.Get("Location") != "" {
+			location, err := url.Parse(writer.header.Get("Location"))
+			if err != nil {
+				s.sendError(realtimeRequest.Id, err, "invalid_redirect")
+				return
+			}
+			requestURL = location.RequestURI()
+			continue
+		}
+		writer.finish()
+		return
+	}
+}
+
+// RelayRealtime upgrades the connection to a websocket, each text message is expected
+// to be {"id": "...", "request": {chat completion request}} and is answered with
+// delta/done frames for streams or a single response/error frame.
+func RelayRealtime(handler http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			common.LogError(c.Request.Context(), "failed to upgrade realtime connection: "+err.Error())
+			return
+		}
+		maxRequests := common.RealtimeMaxConcurrentRequests
+		if maxRequests < 1 {
+			maxRequests = 1
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		session := &realtimeSession{
+			conn:          conn,
+			ctx:           ctx,
+			handler:       handler,
+			authorization: c.Request.Header.Get("Authorization"),
+			remoteAddr:    c.Request.RemoteAddr,
+			requests:      make(chan struct{}, maxRequests),
+		}
+		defer func() {
+			cancel()
+			err := conn.Close()
+			if err != nil {
+				common.SysError("error closing realtime connection: " + err.Error())
+			}
+		}()
+		conn.SetReadLimit(realtimeMaxMessageSize)
+		_ = conn.SetReadDeadline(time.Now().Add(realtimePongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(realtimePongWait))
+		})
+		go func() {
+			ticker := time.NewTicker(realtimePingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := session.ping(); err != nil {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					common.LogWarn(c.Request.Context(), "realtime connection closed: "+err.Error())
+				}
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(realtimePongWait))
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			select {
+			case session.requests <- struct{}{}:
+				go func() {
+					defer func() { <-session.requests }()
+					session.handle(message)
+				}()
+			default:
+				session.reject(message)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// https://jina.ai/reranker/
+// https://docs.cohere.com/reference/rerank
+
+type OpenAICompatibleRerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	Document       any     `json:"document,omitempty"`
+}
+
+type OpenAICompatibleRerankResponse struct {
+	Id      string                         `json:"id"`
+	Model   string                         `json:"model"`
+	Results []OpenAICompatibleRerankResult `json:"results"`
+	Usage   *Usage                         `json:"usage,omitempty"`
+	Error   OpenAIError                    `json:"error"`
+}
+
+func relayRerankHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
+	channelType := c.GetInt("channel")
+	channelId := c.GetInt("channel_id")
+	tokenId := c.GetInt("token_id")
+	userId := c.GetInt("id")
+	group := c.GetString("group")
+	tokenName := c.GetString("token_name")
+	consumeQuota := c.GetBool("consume_quota")
+
+	var rerankRequest RerankRequest
+	err := common.UnmarshalBodyReusable(c, &rerankRequest)
+	if err != nil {
+		return errorWrapper(err, "bind_request_body_failed", http.StatusBadRequest)
+	}
+	if rerankRequest.Model == "" {
+		return errorWrapper(errors.New("model is required"), "required_field_missing", http.StatusBadRequest)
+	}
+	if rerankRequest.Query == "" {
+		return errorWrapper(errors.New("field query is required"), "required_field_missing", http.StatusBadRequest)
+	}
+	documents := rerankRequest.ParseDocuments()
+	if len(documents) == 0 {
+		return errorWrapper(errors.New("field documents is required"), "required_field_missing", http.StatusBadRequest)
+	}
+	requestModel := rerankRequest.Model
+
+	// map model name
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return errorWrapper(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if modelMap[rerankRequest.Model] != "" {
+			rerankRequest.Model = modelMap[rerankRequest.Model]
+		}
+	}
+
+	// rerank is billed by the tokens of the query and all documents
+	promptTokens := countTokenText(rerankRequest.Query, rerankRequest.Model)
+	for _, document := range documents {
+		promptTokens += countTokenText(document, rerankRequest.Model)
+	}
+	if channelType == common.ChannelTypeCohere {
+		promptTokens = getCohereSearchUnits(len(documents))
+	}
+
+	modelRatio := common.GetModelRatio(rerankRequest.Model)
+	groupRatio := common.GetGroupRatio(group)
+	ratio := modelRatio * groupRatio
+	billing := common.GetModelBilling(rerankRequest.Model)
+	preConsumedQuota := billing.Quota(promptTokens, 0, 0, groupRatio)
+	channelCost := getChannelCost(c)
+	var reservation *model.QuotaReservation
+	var openAIErr *OpenAIErrorWithStatusCode
+	if consumeQuota {
+		reservation, openAIErr = reserveQuota(userId, tokenId, preConsumedQuota)
+		if openAIErr != nil {
+			return openAIErr
+		}
+	}
+	// the reservation is released on every return before the response is billed below
+	settling := false
+	defer func() {
+		if !settling {
+			go releaseQuota(c.Request.Context(), reservation)
+		}
+	}()
+
+	baseURL := common.ChannelBaseURLs[channelType]
+	if c.GetString("base_url") != "" {
+		baseURL = c.GetString("base_url")
+	}
+	var fullRequestURL string
+	var jsonData []byte
+	switch channelType {
+	case common.ChannelTypeAli:
+		fullRequestURL = "https://dashscope.aliyuncs.com/api/v1/services/rerank/text-rerank/text-rerank"
+		jsonData, err = json.Marshal(rerankRequestOpenAI2Ali(rerankRequest, documents))
+	default:
+		fullRequestURL = getFullRequestURL(baseURL, "/v1/rerank", channelType)
+		jsonData, err = json.Marshal(rerankRequest)
+	}
+	if err != nil {
+		return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fullRequestURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	apiKey := c.Request.Header.Get("Authorization")
+	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return relayErrorHandler(resp)
+	}
+
+	var rerankResponse *RerankResponse
+	switch channelType {
+	case common.ChannelTypeAli:
+		openAIErr, rerankResponse = aliRerankHandler(resp)
+	case common.ChannelTypeCohere:
+		openAIErr, rerankResponse = cohereRerankHandler(resp)
+	default:
+		openAIErr, rerankResponse = openaiRerankHandler(resp)
+	}
+	if openAIErr != nil {
+		return openAIErr
+	}
+
+	returnDocuments := rerankRequest.ReturnDocuments == nil || *rerankRequest.ReturnDocuments
+	for i := range rerankResponse.Results {
+		result := &rerankResponse.Results[i]
+		if !returnDocuments {
+			result.Document = nil
+		} else if result.Document == nil && result.Index >= 0 && result.Index < len(documents) {
+			result.Document = &RerankDocument{Text: documents[result.Index]}
+		}
+	}
+	if rerankResponse.Model == "" {
+		rerankResponse.Model = requestModel
+	}
+	// prefer the token count reported by upstream
+	if rerankResponse.Usage.TotalTokens > 0 {
+		promptTokens = rerankResponse.Usage.TotalTokens
+	}
+	rerankResponse.Usage = Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+
+	settling = true
+	defer func(ctx context.Context) {
+		if !consumeQuota {
+			return
+		}
+		go func() {
+			quota := billing.Quota(promptTokens, 0, 0, groupRatio)
+			if ratio != 0 && quota <= 0 {
+				quota = 1
+			}
+			err := reservation.Settle(quota)
+			if err != nil {
+				common.LogError(ctx, "error consuming token remain quota: "+err.Error())
+			}
+			if quota != 0 {
+				logContent := fmt.Sprintf("Model multiplier %.2f, basic multiplier %.2f", modelRatio, groupRatio)
+				cost := channelCost.quota(rerankRequest.Model, billing.Quota(promptTokens, 0, 0, 1), promptTokens, 0, 0)
+				model.RecordConsumeLog(ctx, userId, channelId, promptTokens, 0, rerankRequest.Model, tokenName, group, quota, cost, logContent)
+				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+				model.UpdateChannelUsedQuota(channelId, quota)
+			}
+		}()
+	}(c.Request.Context())
+
+	c.JSON(http.StatusOK, rerankResponse)
+	return nil
+}
+
+func openaiRerankHandler(resp *http.Response) (*OpenAIErrorWithStatusCode, *RerankResponse) {
+	var upstreamResponse OpenAICompatibleRerankResponse
+	err := json.NewDecoder(resp.Body).Decode(&upstreamResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if upstreamResponse.Error.Message != "" {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: upstreamResponse.Error,
+			StatusCode:  resp.StatusCode,
+		}, nil
+	}
+	rerankResponse := RerankResponse{
+		Id:      upstreamResponse.Id,
+		Model:   upstreamResponse.Model,
+		Results: make([]RerankResult, 0, len(upstreamResponse.Results)),
+	}
+	if upstreamResponse.Usage != nil {
+		rerankResponse.Usage = *upstreamResponse.Usage
+	}
+	for _, result := range upstreamResponse.Results {
+		rerankResult := RerankResult{
+			Index:          result.Index,
+			RelevanceScore: result.RelevanceScore,
+		}
+		// jina returns {"text": "..."} while some compatible services return the plain string
+		switch document := result.Document.(type) {
+		case string:
+			rerankResult.Document = &RerankDocument{Text: document}
+		case map[string]any:
+			text, _ := document["text"].(string)
+			rerankResult.Document = &RerankDocument{Text: text}
+		}
+		rerankResponse.Results = append(rerankResponse.Results, rerankResult)
+	}
+	return nil, &rerankResponse
+}
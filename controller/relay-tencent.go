@@ -2,19 +2,25 @@ package controller
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
+	"math"
 	"net/http"
 	"one-api/common"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // https://cloud.tencent.com/document/product/1729/97732
@@ -247,18 +253,30 @@ func tencentHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatus
 	return nil, &fullTextResponse.Usage
 }
 
+// parseTencentConfig accepts the legacy AppId|SecretId|SecretKey key and the SecretId|SecretKey key,
+// the app id is 0 for the latter
 func parseTencentConfig(config string) (appId int64, secretId string, secretKey string, err error) {
 	parts := strings.Split(config, "|")
-	if len(parts) != 3 {
+	switch len(parts) {
+	case 2:
+		secretId = parts[0]
+		secretKey = parts[1]
+	case 3:
+		appId, err = strconv.ParseInt(parts[0], 10, 64)
+		secretId = parts[1]
+		secretKey = parts[2]
+	default:
 		err = errors.New("invalid tencent config")
-		return
 	}
-	appId, err = strconv.ParseInt(parts[0], 10, 64)
-	secretId = parts[1]
-	secretKey = parts[2]
 	return
 }
 
+// isTencentCloudConfig reports whether the channel uses the cloud api 3.0 for chat completions,
+// channels created with the legacy key keep using the hyllm api
+func isTencentCloudConfig(config string) bool {
+	return len(strings.Split(config, "|")) == 2
+}
+
 func getTencentSign(req TencentChatRequest, secretKey string) string {
 	params := make([]string, 0)
 	params = append(params, "app_id="+strconv.FormatInt(req.AppId, 10))
@@ -285,3 +303,666 @@ func getTencentSign(req TencentChatRequest, secretKey string) string {
 	sign := mac.Sum([]byte(nil))
 	return base64.StdEncoding.EncodeToString(sign)
 }
+
+// Tencent Cloud API 3.0, signed with TC3-HMAC-SHA256
+// https://cloud.tencent.com/document/api/1729/101843
+
+type tencentCloudProduct struct {
+	host    string
+	service string
+	version string
+}
+
+var tencentCloudHunyuan = tencentCloudProduct{host: "hunyuan.tencentcloudapi.com", service: "hunyuan", version: "2023-09-01"}
+var tencentCloudTTS = tencentCloudProduct{host: "tts.tencentcloudapi.com", service: "tts", version: "2019-08-23"}
+var tencentCloudASR = tencentCloudProduct{host: "asr.tencentcloudapi.com", service: "asr", version: "2019-06-14"}
+
+type TencentCloudError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+func sha256Hex(s string) string {
+	b := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(b[:])
+}
+
+func hmacSha256(s, key string) string {
+	hashed := hmac.New(sha256.New, []byte(key))
+	hashed.Write([]byte(s))
+	return string(hashed.Sum(nil))
+}
+
+func getTencentCloudAuthorization(product tencentCloudProduct, secretId string, secretKey string, payload string, timestamp int64) string {
+	contentType := "application/json; charset=utf-8"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\n", contentType, product.host)
+	signedHeaders := "content-type;host"
+	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
+		http.MethodPost, "/", "", canonicalHeaders, signedHeaders, sha256Hex(payload))
+
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	credentialScope := fmt.Sprintf("%s/%s/tc3_request", date, product.service)
+	stringToSign := fmt.Sprintf("TC3-HMAC-SHA256\n%d\n%s\n%s", timestamp, credentialScope, sha256Hex(canonicalRequest))
+
+	secretDate := hmacSha256(date, "TC3"+secretKey)
+	secretService := hmacSha256(product.service, secretDate)
+	secretSigning := hmacSha256("tc3_request", secretService)
+	signature := hex.EncodeToString([]byte(hmacSha256(stringToSign, secretSigning)))
+
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		secretId, credentialScope, signedHeaders, signature)
+}
+
+func newTencentCloudRequest(product tencentCloudProduct, action string, payload []byte, secretId string, secretKey string, region string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, "https://"+product.host+"/", bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := common.GetTimestamp()
+	req.Header.Set("Authorization", getTencentCloudAuthorization(product, secretId, secretKey, string(payload), timestamp))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Host", product.host)
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-TC-Version", product.version)
+	if region != "" {
+		req.Header.Set("X-TC-Region", region)
+	}
+	return req, nil
+}
+
+// https://cloud.tencent.com/document/api/1729/105701
+
+const tencentCloudDefaultRegion = "ap-guangzhou"
+
+type TencentCloudMessage struct {
+	Role    string `json:"Role"`
+	Content string `json:"Content"`
+}
+
+type TencentCloudChatRequest struct {
+	Model       string                `json:"Model"`
+	Messages    []TencentCloudMessage `json:"Messages"`
+	Stream      bool                  `json:"Stream,omitempty"`
+	TopP        *float64              `json:"TopP,omitempty"`
+	Temperature *float64              `json:"Temperature,omitempty"`
+}
+
+type TencentCloudUsage struct {
+	PromptTokens     int `json:"PromptTokens"`
+	CompletionTokens int `json:"CompletionTokens"`
+	TotalTokens      int `json:"TotalTokens"`
+}
+
+type TencentCloudChoice struct {
+	FinishReason string              `json:"FinishReason"`
+	Message      TencentCloudMessage `json:"Message"`
+	Delta        TencentCloudMessage `json:"Delta"`
+}
+
+// TencentCloudChatResponse is wrapped in Response for non-stream requests, stream chunks are sent as is
+type TencentCloudChatResponse struct {
+	Id        string               `json:"Id"`
+	Created   int64                `json:"Created"`
+	Note      string               `json:"Note"`
+	Choices   []TencentCloudChoice `json:"Choices"`
+	Usage     TencentCloudUsage    `json:"Usage"`
+	Error     *TencentCloudError   `json:"Error,omitempty"`
+	RequestId string               `json:"RequestId"`
+}
+
+// tencent cloud error codes mapped to the OpenAI error types, so that the channel can be disabled automatically
+var tencentCloudErrorTypes = map[string]string{
+	"AuthFailure.SecretIdNotFound":               "invalid_api_key",
+	"AuthFailure.SignatureFailure":               "invalid_api_key",
+	"FailedOperation.ServiceNotActivated":        "insufficient_quota",
+	"FailedOperation.ServiceStop":                "insufficient_quota",
+	"FailedOperation.ServiceStopArrears":         "insufficient_quota",
+	"ResourceInsufficient.ChargeResourceExhaust": "insufficient_quota",
+}
+
+func requestOpenAI2TencentCloud(request GeneralOpenAIRequest) *TencentCloudChatRequest {
+	messages := make([]TencentCloudMessage, 0, len(request.Messages))
+	for _, message := range request.Messages {
+		messages = append(messages, TencentCloudMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	tencentRequest := TencentCloudChatRequest{
+		Model:    request.Model,
+		Messages: messages,
+		Stream:   request.Stream,
+	}
+	if request.Temperature != 0 {
+		tencentRequest.Temperature = &request.Temperature
+	}
+	if request.TopP != 0 {
+		tencentRequest.TopP = &request.TopP
+	}
+	return &tencentRequest
+}
+
+func stopReasonTencentCloud2OpenAI(reason string) string {
+	switch reason {
+	case "", "stop":
+		return "stop"
+	case "sensitive":
+		return "content_filter"
+	default:
+		return reason
+	}
+}
+
+func usageTencentCloud2OpenAI(usage TencentCloudUsage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
+func responseTencentCloud2OpenAI(response *TencentCloudChatResponse) *OpenAITextResponse {
+	fullTextResponse := OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", response.Id),
+		Object:  "chat.completion",
+		Created: response.Created,
+		Usage:   usageTencentCloud2OpenAI(response.Usage),
+	}
+	for i, choice := range response.Choices {
+		fullTextResponse.Choices = append(fullTextResponse.Choices, OpenAITextResponseChoice{
+			Index: i,
+			Message: Message{
+				Role:    "assistant",
+				Content: choice.Message.Content,
+			},
+			FinishReason: stopReasonTencentCloud2OpenAI(choice.FinishReason),
+		})
+	}
+	return &fullTextResponse
+}
+
+func streamResponseTencentCloud2OpenAI(tencentResponse *TencentCloudChatResponse, model string) *ChatCompletionsStreamResponse {
+	response := ChatCompletionsStreamResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", tencentResponse.Id),
+		Object:  "chat.completion.chunk",
+		Created: tencentResponse.Created,
+		Model:   model,
+	}
+	for _, tencentChoice := range tencentResponse.Choices {
+		var choice ChatCompletionsStreamResponseChoice
+		choice.Delta.Content = tencentChoice.Delta.Content
+		if tencentChoice.FinishReason != "" {
+			finishReason := stopReasonTencentCloud2OpenAI(tencentChoice.FinishReason)
+			choice.FinishReason = &finishReason
+		}
+		response.Choices = append(response.Choices, choice)
+	}
+	return &response
+}
+
+func tencentCloudErrorWrapper(tencentError *TencentCloudError, requestId string) *OpenAIErrorWithStatusCode {
+	openAIErr := &OpenAIErrorWithStatusCode{
+		OpenAIError: OpenAIError{
+			Message: tencentError.Message,
+			Type:    "tencent_error",
+			Param:   requestId,
+			Code:    tencentError.Code,
+		},
+		StatusCode: http.StatusInternalServerError,
+	}
+	if errorType, ok := tencentCloudErrorTypes[tencentError.Code]; ok {
+		openAIErr.Type = errorType
+		openAIErr.Code = errorType
+	}
+	return openAIErr
+}
+
+func doTencentCloudChatRequest(c *gin.Context, tencentRequest *TencentCloudChatRequest, secretId string, secretKey string) (*http.Response, *OpenAIErrorWithStatusCode) {
+	jsonData, err := json.Marshal(tencentRequest)
+	if err != nil {
+		return nil, errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+	}
+	region := c.GetString("region")
+	if region == "" {
+		region = tencentCloudDefaultRegion
+	}
+	req, err := newTencentCloudRequest(tencentCloudHunyuan, "ChatCompletions", jsonData, secretId, secretKey, region)
+	if err != nil {
+		return nil, errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, relayErrorHandler(resp)
+	}
+	return resp, nil
+}
+
+// readTencentCloudResponse reads a non-stream response, which is also returned for failed stream requests
+func readTencentCloudResponse(resp *http.Response) (*TencentCloudChatResponse, *OpenAIErrorWithStatusCode) {
+	var tencentResponse struct {
+		Response TencentCloudChatResponse `json:"Response"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&tencentResponse)
+	if err != nil {
+		return nil, errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	if tencentResponse.Response.Error != nil {
+		return nil, tencentCloudErrorWrapper(tencentResponse.Response.Error, tencentResponse.Response.RequestId)
+	}
+	return &tencentResponse.Response, nil
+}
+
+func tencentCloudHandler(c *gin.Context, textRequest GeneralOpenAIRequest, secretId string, secretKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	resp, openAIErr := doTencentCloudChatRequest(c, requestOpenAI2TencentCloud(textRequest), secretId, secretKey)
+	if openAIErr != nil {
+		return openAIErr, nil
+	}
+	tencentResponse, openAIErr := readTencentCloudResponse(resp)
+	if openAIErr != nil {
+		return openAIErr, nil
+	}
+	fullTextResponse := responseTencentCloud2OpenAI(tencentResponse)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+// tencentCloudStreamHandler converts the chunks to OpenAI format, every chunk carries the usage so far
+func tencentCloudStreamHandler(c *gin.Context, textRequest GeneralOpenAIRequest, secretId string, secretKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	resp, openAIErr := doTencentCloudChatRequest(c, requestOpenAI2TencentCloud(textRequest), secretId, secretKey)
+	if openAIErr != nil {
+		return openAIErr, nil
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		_, openAIErr = readTencentCloudResponse(resp)
+		if openAIErr == nil {
+			openAIErr = errorWrapper(errors.New("unexpected non-stream response"), "unexpected_response", http.StatusInternalServerError)
+		}
+		return openAIErr, nil
+	}
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	dataChan := make(chan string)
+	stopChan := make(chan bool)
+	go func() {
+		for scanner.Scan() {
+			data := strings.TrimSuffix(scanner.Text(), "\r")
+			if !strings.HasPrefix(data, "data:") {
+				continue
+			}
+			dataChan <- strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		}
+		stopChan <- true
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			var tencentResponse TencentCloudChatResponse
+			err := json.Unmarshal([]byte(data), &tencentResponse)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				return true
+			}
+			if tencentResponse.Error != nil {
+				common.SysError("error in tencent stream response: " + tencentResponse.Error.Message)
+				return true
+			}
+			usage = usageTencentCloud2OpenAI(tencentResponse.Usage)
+			response := streamResponseTencentCloud2OpenAI(&tencentResponse, textRequest.Model)
+			jsonResponse, err := json.Marshal(response)
+			if err != nil {
+				common.SysError("error marshalling stream response: " + err.Error())
+				return true
+			}
+			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+			return true
+		case <-stopChan:
+			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+			return false
+		}
+	})
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &usage
+}
+
+// https://cloud.tencent.com/document/api/1729/102832
+
+type TencentEmbeddingRequest struct {
+	Input string `json:"Input"`
+}
+
+type TencentEmbeddingResponse struct {
+	Response struct {
+		Data []struct {
+			Embedding []float64 `json:"Embedding"`
+			Index     int       `json:"Index"`
+			Object    string    `json:"Object"`
+		} `json:"Data"`
+		Usage struct {
+			PromptTokens int `json:"PromptTokens"`
+			TotalTokens  int `json:"TotalTokens"`
+		} `json:"Usage"`
+		Error     *TencentCloudError `json:"Error,omitempty"`
+		RequestId string             `json:"RequestId"`
+	} `json:"Response"`
+}
+
+func tencentEmbeddingHandler(c *gin.Context, textRequest GeneralOpenAIRequest, secretId string, secretKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	region := c.GetString("region")
+	if region == "" {
+		region = tencentCloudDefaultRegion
+	}
+	fullTextResponse := OpenAIEmbeddingResponse{
+		Object: "list",
+		Model:  textRequest.Model,
+	}
+	for i, input := range textRequest.ParseInput() {
+		jsonData, err := json.Marshal(TencentEmbeddingRequest{Input: input})
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError), nil
+		}
+		req, err := newTencentCloudRequest(tencentCloudHunyuan, "GetEmbedding", jsonData, secretId, secretKey, region)
+		if err != nil {
+			return errorWrapper(err, "new_request_failed", http.StatusInternalServerError), nil
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return errorWrapper(err, "do_request_failed", http.StatusInternalServerError), nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return relayErrorHandler(resp), nil
+		}
+		var tencentResponse TencentEmbeddingResponse
+		err = json.NewDecoder(resp.Body).Decode(&tencentResponse)
+		if err != nil {
+			return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		err = resp.Body.Close()
+		if err != nil {
+			return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		}
+		if tencentResponse.Response.Error != nil {
+			return &OpenAIErrorWithStatusCode{
+				OpenAIError: OpenAIError{
+					Message: tencentResponse.Response.Error.Message,
+					Type:    "tencent_error",
+					Param:   tencentResponse.Response.RequestId,
+					Code:    tencentResponse.Response.Error.Code,
+				},
+				StatusCode: http.StatusInternalServerError,
+			}, nil
+		}
+		for _, item := range tencentResponse.Response.Data {
+			fullTextResponse.Data = append(fullTextResponse.Data, OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     i,
+				Embedding: item.Embedding,
+			})
+		}
+		fullTextResponse.Usage.PromptTokens += tencentResponse.Response.Usage.PromptTokens
+		fullTextResponse.Usage.TotalTokens += tencentResponse.Response.Usage.TotalTokens
+	}
+	encodeEmbeddingResponse(&fullTextResponse, textRequest.EncodingFormat)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+// https://cloud.tencent.com/document/api/1073/37995
+
+type TencentTTSRequest struct {
+	Text       string  `json:"Text"`
+	SessionId  string  `json:"SessionId"`
+	VoiceType  int64   `json:"VoiceType"`
+	Codec      string  `json:"Codec"`
+	Speed      float64 `json:"Speed"`
+	SampleRate int     `json:"SampleRate,omitempty"`
+}
+
+type TencentTTSResponse struct {
+	Response struct {
+		Audio     string             `json:"Audio"`
+		SessionId string             `json:"SessionId"`
+		Error     *TencentCloudError `json:"Error,omitempty"`
+		RequestId string             `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// https://cloud.tencent.com/document/api/1093/35646
+
+type TencentASRRequest struct {
+	EngSerViceType string `json:"EngSerViceType"`
+	SourceType     int    `json:"SourceType"`
+	VoiceFormat    string `json:"VoiceFormat"`
+	Data           string `json:"Data"`
+	DataLen        int    `json:"DataLen"`
+}
+
+type TencentASRResponse struct {
+	Response struct {
+		Result        string             `json:"Result"`
+		AudioDuration int64              `json:"AudioDuration"` // millisecond
+		Error         *TencentCloudError `json:"Error,omitempty"`
+		RequestId     string             `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// map openai voices to similar tencent voices, numeric voices are passed through
+var tencentVoiceTypes = map[string]int64{
+	"alloy":   101001,
+	"echo":    101004,
+	"fable":   101002,
+	"onyx":    101013,
+	"nova":    101003,
+	"shimmer": 101016,
+}
+
+var tencentAudioCodecs = map[string]string{
+	"":    "mp3",
+	"mp3": "mp3",
+	"wav": "wav",
+	"pcm": "pcm",
+}
+
+var tencentAudioContentTypes = map[string]string{
+	"mp3": "audio/mpeg",
+	"wav": "audio/wav",
+	"pcm": "audio/pcm",
+}
+
+// tencent speed is a level from -2 (0.6x) to 6 (2.5x) where 0 is the normal speed
+func speedOpenAI2Tencent(speed float64) float64 {
+	if speed == 0 {
+		return 0
+	}
+	levels := []struct {
+		level float64
+		speed float64
+	}{{-2, 0.6}, {-1, 0.8}, {0, 1}, {1, 1.2}, {2, 1.5}, {6, 2.5}}
+	result := levels[0]
+	for _, level := range levels {
+		if math.Abs(level.speed-speed) < math.Abs(result.speed-speed) {
+			result = level
+		}
+	}
+	return result.level
+}
+
+func ttsRequestOpenAI2Tencent(request TextToSpeechRequest) (*TencentTTSRequest, error) {
+	codec, ok := tencentAudioCodecs[request.ResponseFormat]
+	if !ok {
+		return nil, fmt.Errorf("response format %s is not supported", request.ResponseFormat)
+	}
+	voiceType, ok := tencentVoiceTypes[request.Voice]
+	if !ok {
+		var err error
+		voiceType, err = strconv.ParseInt(request.Voice, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("voice %s is not supported", request.Voice)
+		}
+	}
+	return &TencentTTSRequest{
+		Text:      request.Input,
+		SessionId: common.GetUUID(),
+		VoiceType: voiceType,
+		Codec:     codec,
+		Speed:     speedOpenAI2Tencent(request.Speed),
+	}, nil
+}
+
+func tencentTTSHandler(c *gin.Context, request TextToSpeechRequest, secretId string, secretKey string) *OpenAIErrorWithStatusCode {
+	tencentRequest, err := ttsRequestOpenAI2Tencent(request)
+	if err != nil {
+		return errorWrapper(err, "invalid_tts_request", http.StatusBadRequest)
+	}
+	jsonData, err := json.Marshal(tencentRequest)
+	if err != nil {
+		return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+	}
+	req, err := newTencentCloudRequest(tencentCloudTTS, "TextToVoice", jsonData, secretId, secretKey, "")
+	if err != nil {
+		return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return relayErrorHandler(resp)
+	}
+	var tencentResponse TencentTTSResponse
+	err = json.NewDecoder(resp.Body).Decode(&tencentResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	if tencentResponse.Response.Error != nil {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: tencentResponse.Response.Error.Message,
+				Type:    "tencent_error",
+				Param:   tencentResponse.Response.RequestId,
+				Code:    tencentResponse.Response.Error.Code,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	audio, err := base64.StdEncoding.DecodeString(tencentResponse.Response.Audio)
+	if err != nil {
+		return errorWrapper(err, "decode_audio_failed", http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", tencentAudioContentTypes[tencentRequest.Codec])
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(audio)
+	if err != nil {
+		return errorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+func getTencentVoiceFormat(filename string) string {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	switch format {
+	case "ogg", "opus":
+		return "ogg-opus"
+	case "mpeg", "mpga":
+		return "mp3"
+	case "":
+		return "wav"
+	}
+	return format
+}
+
+func getTencentEngineType(language string) string {
+	switch language {
+	case "", "zh":
+		return "16k_zh"
+	case "en", "ja", "ko", "yue":
+		return "16k_" + language
+	}
+	return "16k_zh_large"
+}
+
+// tencentASRHandler transcribes audio up to 60 seconds, returns the text and the duration reported by tencent
+func tencentASRHandler(c *gin.Context, audio []byte, filename string, responseFormat string, secretId string, secretKey string) (*OpenAIErrorWithStatusCode, string, float64) {
+	jsonData, err := json.Marshal(TencentASRRequest{
+		EngSerViceType: getTencentEngineType(c.PostForm("language")),
+		SourceType:     1,
+		VoiceFormat:    getTencentVoiceFormat(filename),
+		Data:           base64.StdEncoding.EncodeToString(audio),
+		DataLen:        len(audio),
+	})
+	if err != nil {
+		return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError), "", 0
+	}
+	req, err := newTencentCloudRequest(tencentCloudASR, "SentenceRecognition", jsonData, secretId, secretKey, "")
+	if err != nil {
+		return errorWrapper(err, "new_request_failed", http.StatusInternalServerError), "", 0
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errorWrapper(err, "do_request_failed", http.StatusInternalServerError), "", 0
+	}
+	if resp.StatusCode != http.StatusOK {
+		return relayErrorHandler(resp), "", 0
+	}
+	var tencentResponse TencentASRResponse
+	err = json.NewDecoder(resp.Body).Decode(&tencentResponse)
+	if err != nil {
+		return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), "", 0
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", 0
+	}
+	if tencentResponse.Response.Error != nil {
+		return &OpenAIErrorWithStatusCode{
+			OpenAIError: OpenAIError{
+				Message: tencentResponse.Response.Error.Message,
+				Type:    "tencent_error",
+				Param:   tencentResponse.Response.RequestId,
+				Code:    tencentResponse.Response.Error.Code,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, "", 0
+	}
+	text := tencentResponse.Response.Result
+	duration := float64(tencentResponse.Response.AudioDuration) / 1000
+	responseBody, contentType, err := formatTranscription(text, duration, responseFormat)
+	if err != nil {
+		return errorWrapper(err, "unexpected_response_format", http.StatusBadRequest), "", 0
+	}
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return errorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), "", 0
+	}
+	return nil, text, duration
+}
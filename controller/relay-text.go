@@ -28,6 +28,10 @@ const (
 	APITypeAIProxyLibrary
 	APITypeTencent
 	APITypeGemini
+	APITypeAwsBedrock
+	APITypeVertexAI
+	APITypeOllama
+	APITypeCohere
 )
 
 var httpClient *http.Client
@@ -53,6 +57,7 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
 	consumeQuota := c.GetBool("consume_quota")
+	isChannelTest := c.GetBool("channel_test")
 	group := c.GetString("group")
 	var textRequest GeneralOpenAIRequest
 	if consumeQuota || channelType == common.ChannelTypeAzure || channelType == common.ChannelTypePaLM {
@@ -127,6 +132,14 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		apiType = APITypeTencent
 	case common.ChannelTypeGemini:
 		apiType = APITypeGemini
+	case common.ChannelTypeAwsBedrock:
+		apiType = APITypeAwsBedrock
+	case common.ChannelTypeVertexAI:
+		apiType = APITypeVertexAI
+	case common.ChannelTypeOllama:
+		apiType = APITypeOllama
+	case common.ChannelTypeCohere:
+		apiType = APITypeCohere
 	}
 	baseURL := common.ChannelBaseURLs[channelType]
 	requestURL := c.Request.URL.String()
@@ -159,25 +172,17 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			fullRequestURL = fmt.Sprintf("%s/v1/complete", baseURL)
 		}
 	case APITypeBaidu:
-		switch textRequest.Model {
-		case "ERNIE-Bot":
-			fullRequestURL = "https://aip.baidubce.com/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/completions"
-		case "ERNIE-Bot-turbo":
-			fullRequestURL = "https://aip.baidubce.com/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/eb-instant"
-		case "ERNIE-Bot-4":
-			fullRequestURL = "https://aip.baidubce.com/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/completions_pro"
-		case "BLOOMZ-7B":
-			fullRequestURL = "https://aip.baidubce.com/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/bloomz_7b1"
-		case "Embedding-V1":
-			fullRequestURL = "https://aip.baidubce.com/rpc/2.0/ai_custom/v1/wenxinworkshop/embeddings/embedding-v1"
+		endpoint, ok := common.GetBaiduModelEndpoint(textRequest.Model)
+		if !ok {
+			return errorWrapper(fmt.Errorf("the endpoint of baidu model %s is not configured", textRequest.Model), "unknown_baidu_model", http.StatusBadRequest)
 		}
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
-		var err error
-		if apiKey, err = getBaiduAccessToken(apiKey); err != nil {
-			return errorWrapper(err, "invalid_baidu_config", http.StatusInternalServerError)
+		accessToken, err := getBaiduAccessToken(apiKey)
+		if err != nil {
+			return baiduAccessTokenErrorWrapper(err)
 		}
-		fullRequestURL += "?access_token=" + apiKey
+		fullRequestURL = endpoint + "?access_token=" + accessToken
 	case APITypePaLM:
 		fullRequestURL = "https://generativelanguage.googleapis.com/v1beta2/models/chat-bison-001:generateMessage"
 		if baseURL != "" {
@@ -199,11 +204,21 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		if textRequest.Stream {
 			action = "streamGenerateContent"
 		}
+		if relayMode == RelayModeEmbeddings {
+			action = getGeminiEmbeddingAction(textRequest)
+		}
 		fullRequestURL = fmt.Sprintf("%s/%s/models/%s:%s", requestBaseURL, version, textRequest.Model, action)
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 		fullRequestURL += "?key=" + apiKey
 	case APITypeZhipu:
+		if isZhipuV4(c) {
+			fullRequestURL = "https://open.bigmodel.cn/api/paas/v4/chat/completions"
+			if relayMode == RelayModeEmbeddings {
+				fullRequestURL = "https://open.bigmodel.cn/api/paas/v4/embeddings"
+			}
+			break
+		}
 		method := "invoke"
 		if textRequest.Stream {
 			method = "sse-invoke"
@@ -218,6 +233,37 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		fullRequestURL = "https://hunyuan.cloud.tencent.com/hyllm/v1/chat/completions"
 	case APITypeAIProxyLibrary:
 		fullRequestURL = fmt.Sprintf("%s/api/library/ask", baseURL)
+	case APITypeVertexAI:
+		if relayMode != RelayModeChatCompletions {
+			return errorWrapper(errors.New("only chat completions are supported by vertex ai channel"), "unsupported_relay_mode", http.StatusBadRequest)
+		}
+		apiKey := c.Request.Header.Get("Authorization")
+		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+		account, err := parseVertexServiceAccount(apiKey)
+		if err != nil {
+			return errorWrapper(err, "invalid_vertex_config", http.StatusInternalServerError)
+		}
+		accessToken, err := getVertexAccessToken(account)
+		if err != nil {
+			return errorWrapper(err, "get_vertex_access_token_failed", http.StatusInternalServerError)
+		}
+		fullRequestURL = getVertexRequestURL(baseURL, account, c.GetString("region"), textRequest.Model, textRequest.Stream)
+		// the service account is exchanged for an access token, which is sent as a bearer token
+		c.Request.Header.Set("Authorization", "Bearer "+accessToken)
+	case APITypeOllama:
+		if relayMode != RelayModeChatCompletions && relayMode != RelayModeEmbeddings {
+			return errorWrapper(errors.New("only chat completions and embeddings are supported by ollama channel"), "unsupported_relay_mode", http.StatusBadRequest)
+		}
+		fullRequestURL = fmt.Sprintf("%s/api/chat", baseURL)
+	case APITypeCohere:
+		switch relayMode {
+		case RelayModeChatCompletions:
+			fullRequestURL = fmt.Sprintf("%s/v1/chat", baseURL)
+		case RelayModeEmbeddings:
+			fullRequestURL = fmt.Sprintf("%s/v1/embed", baseURL)
+		default:
+			return errorWrapper(errors.New("only chat completions and embeddings are supported by cohere channel"), "unsupported_relay_mode", http.StatusBadRequest)
+		}
 	}
 	var promptTokens int
 	var completionTokens int
@@ -228,6 +274,8 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		promptTokens = countTokenInput(textRequest.Prompt, textRequest.Model)
 	case RelayModeModerations:
 		promptTokens = countTokenInput(textRequest.Input, textRequest.Model)
+	case RelayModeEmbeddings:
+		promptTokens = countTokenInput(textRequest.Input, textRequest.Model)
 	}
 	preConsumedTokens := common.PreConsumedQuota
 	if textRequest.MaxTokens != 0 {
@@ -236,30 +284,26 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	modelRatio := common.GetModelRatio(textRequest.Model)
 	groupRatio := common.GetGroupRatio(group)
 	ratio := modelRatio * groupRatio
-	preConsumedQuota := int(float64(preConsumedTokens) * ratio)
-	userQuota, err := model.CacheGetUserQuota(userId)
-	if err != nil {
-		return errorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota-preConsumedQuota < 0 {
-		return errorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
-	}
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
-	if err != nil {
-		return errorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota > 100*preConsumedQuota {
-		// in this case, we do not pre-consume quota
-		// because the user has enough quota
-		preConsumedQuota = 0
-		common.LogInfo(c.Request.Context(), fmt.Sprintf("user %d has enough quota %d, trusted and no need to pre-consume", userId, userQuota))
-	}
-	if consumeQuota && preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
-		if err != nil {
-			return errorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	billing := common.GetModelBilling(textRequest.Model)
+	channelCost := getChannelCost(c)
+	preConsumedQuota := billing.Quota(preConsumedTokens, 0, 0, groupRatio)
+	var err error
+	var reservation *model.QuotaReservation
+	// channel tests are not billed
+	if !isChannelTest && consumeQuota {
+		var openAIErr *OpenAIErrorWithStatusCode
+		reservation, openAIErr = reserveQuota(userId, tokenId, preConsumedQuota)
+		if openAIErr != nil {
+			return openAIErr
 		}
 	}
+	// the reservation is released on every return before the response is billed below
+	settling := false
+	defer func() {
+		if !settling {
+			go releaseQuota(c.Request.Context(), reservation)
+		}
+	}()
 	var requestBody io.Reader
 	if isModelMapped {
 		jsonStr, err := json.Marshal(textRequest)
@@ -271,6 +315,14 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		requestBody = c.Request.Body
 	}
 	switch apiType {
+	case APITypeOpenAI:
+		if vendor, ok := openAICompatibleVendors[channelType]; ok && relayMode == RelayModeChatCompletions {
+			var err error
+			requestBody, err = filterOpenAICompatibleRequest(requestBody, vendor)
+			if err != nil {
+				return errorWrapper(err, "filter_text_request_failed", http.StatusInternalServerError)
+			}
+		}
 	case APITypeClaude:
 		claudeRequest := requestOpenAI2Claude(textRequest)
 		jsonStr, err := json.Marshal(claudeRequest)
@@ -301,14 +353,64 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		}
 		requestBody = bytes.NewBuffer(jsonStr)
 	case APITypeGemini:
-		geminiChatRequest := requestOpenAI2Gemini(textRequest)
-		jsonStr, err := json.Marshal(geminiChatRequest)
+		var geminiRequest any
+		switch relayMode {
+		case RelayModeEmbeddings:
+			geminiRequest = embeddingRequestOpenAI2Gemini(textRequest)
+		default:
+			geminiRequest = requestOpenAI2Gemini(textRequest)
+		}
+		jsonStr, err := json.Marshal(geminiRequest)
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonStr)
+	case APITypeCohere:
+		var cohereRequest any
+		switch relayMode {
+		case RelayModeEmbeddings:
+			cohereRequest = embeddingRequestOpenAI2Cohere(textRequest)
+		default:
+			cohereRequest = requestOpenAI2Cohere(textRequest)
+		}
+		jsonStr, err := json.Marshal(cohereRequest)
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonStr)
+	case APITypeOllama:
+		ollamaRequest := requestOpenAI2Ollama(textRequest)
+		jsonStr, err := json.Marshal(ollamaRequest)
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonStr)
+	case APITypeVertexAI:
+		var vertexRequest any
+		if isVertexClaudeModel(textRequest.Model) {
+			claudeRequest := requestOpenAI2ClaudeMessages(textRequest)
+			claudeRequest.Model = ""
+			claudeRequest.AnthropicVersion = vertexAnthropicVersion
+			vertexRequest = claudeRequest
+		} else {
+			vertexRequest = requestOpenAI2Gemini(textRequest)
+		}
+		jsonStr, err := json.Marshal(vertexRequest)
 		if err != nil {
 			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(jsonStr)
 	case APITypeZhipu:
-		zhipuRequest := requestOpenAI2Zhipu(textRequest)
+		if relayMode == RelayModeEmbeddings {
+			// the v4 embedding api is compatible with OpenAI, and the v3 one is requested by the handler
+			break
+		}
+		var zhipuRequest any
+		if isZhipuV4(c) {
+			zhipuRequest = requestOpenAI2ZhipuV4(textRequest)
+		} else {
+			zhipuRequest = requestOpenAI2Zhipu(textRequest)
+		}
 		jsonStr, err := json.Marshal(zhipuRequest)
 		if err != nil {
 			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
@@ -332,6 +434,9 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	case APITypeTencent:
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+		if relayMode == RelayModeEmbeddings || isTencentCloudConfig(apiKey) {
+			break
+		}
 		appId, secretId, secretKey, err := parseTencentConfig(apiKey)
 		if err != nil {
 			return errorWrapper(err, "invalid_tencent_config", http.StatusInternalServerError)
@@ -360,7 +465,17 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	var resp *http.Response
 	isStream := textRequest.Stream
 
-	if apiType != APITypeXunfei { // cause xunfei use websocket
+	// xunfei uses websocket, aws bedrock and the tencent cloud api 3.0 require signing the converted body,
+	// and some embedding APIs only accept one text per request,
+	// in these cases the handler sends the requests itself
+	selfRequest := apiType == APITypeXunfei || apiType == APITypeAwsBedrock
+	if apiType == APITypeTencent && isTencentCloudConfig(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")) {
+		selfRequest = true
+	}
+	if relayMode == RelayModeEmbeddings && ((apiType == APITypeZhipu && !isZhipuV4(c)) || apiType == APITypeTencent || apiType == APITypeOllama) {
+		selfRequest = true
+	}
+	if !selfRequest {
 		req, err = http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 		if err != nil {
 			return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
@@ -426,14 +541,11 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		isStream = isStream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
 
 		if resp.StatusCode != http.StatusOK {
-			if preConsumedQuota != 0 {
-				go func(ctx context.Context) {
-					// return pre-consumed quota
-					err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
-					if err != nil {
-						common.LogError(ctx, "error return pre-consumed quota: "+err.Error())
-					}
-				}(c.Request.Context())
+			if apiType == APITypeOllama {
+				return ollamaErrorHandler(resp)
+			}
+			if vendor, ok := openAICompatibleVendors[channelType]; ok {
+				return openAICompatibleErrorHandler(resp, vendor)
 			}
 			return relayErrorHandler(resp)
 		}
@@ -442,14 +554,18 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	var textResponse TextResponse
 	tokenName := c.GetString("token_name")
 
+	settling = true
 	defer func(ctx context.Context) {
+		if reservation == nil {
+			return
+		}
 		// c.Writer.Flush()
 		go func() {
 			quota := 0
-			completionRatio := common.GetCompletionRatio(textRequest.Model)
 			promptTokens = textResponse.Usage.PromptTokens
 			completionTokens = textResponse.Usage.CompletionTokens
-			quota = int(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+			cachedTokens := textResponse.Usage.GetCachedTokens()
+			quota = billing.Quota(promptTokens, cachedTokens, completionTokens, groupRatio)
 			if ratio != 0 && quota <= 0 {
 				quota = 1
 			}
@@ -459,18 +575,14 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 				// we cannot just return, because we may have to return the pre-consumed quota
 				quota = 0
 			}
-			quotaDelta := quota - preConsumedQuota
-			err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
+			err := reservation.Settle(quota)
 			if err != nil {
 				common.LogError(ctx, "error consuming token remain quota: "+err.Error())
 			}
-			err = model.CacheUpdateUserQuota(userId)
-			if err != nil {
-				common.LogError(ctx, "error update user quota cache: "+err.Error())
-			}
 			if quota != 0 {
 				logContent := fmt.Sprintf("Model multiplier %.2f, basic multiplier %.2f", modelRatio, groupRatio)
-				model.RecordConsumeLog(ctx, userId, channelId, promptTokens, completionTokens, textRequest.Model, tokenName, quota, logContent)
+				cost := channelCost.quota(textRequest.Model, billing.Quota(promptTokens, cachedTokens, completionTokens, 1), promptTokens, cachedTokens, completionTokens)
+				model.RecordConsumeLog(ctx, userId, channelId, promptTokens, completionTokens, textRequest.Model, tokenName, group, quota, cost, logContent)
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				model.UpdateChannelUsedQuota(channelId, quota)
 			}
@@ -531,7 +643,7 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			var usage *Usage
 			switch relayMode {
 			case RelayModeEmbeddings:
-				err, usage = baiduEmbeddingHandler(c, resp)
+				err, usage = baiduEmbeddingHandler(c, resp, textRequest)
 			default:
 				err, usage = baiduHandler(c, resp)
 			}
@@ -563,6 +675,16 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			return nil
 		}
 	case APITypeGemini:
+		if relayMode == RelayModeEmbeddings {
+			err, usage := geminiEmbeddingHandler(c, resp, promptTokens, textRequest)
+			if err != nil {
+				return err
+			}
+			if usage != nil {
+				textResponse.Usage = *usage
+			}
+			return nil
+		}
 		if textRequest.Stream {
 			err, responseText := geminiChatStreamHandler(c, resp)
 			if err != nil {
@@ -582,6 +704,34 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			return nil
 		}
 	case APITypeZhipu:
+		if isZhipuV4(c) {
+			var err *OpenAIErrorWithStatusCode
+			var usage *Usage
+			if isStream {
+				err, usage = zhipuV4StreamHandler(c, resp, promptTokens, textRequest.Model)
+			} else {
+				err, usage = openaiHandler(c, resp, true, promptTokens, textRequest.Model)
+			}
+			if err != nil {
+				return err
+			}
+			if usage != nil {
+				textResponse.Usage = *usage
+			}
+			return nil
+		}
+		if relayMode == RelayModeEmbeddings {
+			apiKey := c.Request.Header.Get("Authorization")
+			apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+			err, usage := zhipuEmbeddingHandler(c, textRequest, apiKey)
+			if err != nil {
+				return err
+			}
+			if usage != nil {
+				textResponse.Usage = *usage
+			}
+			return nil
+		}
 		if isStream {
 			err, usage := zhipuStreamHandler(c, resp)
 			if err != nil {
@@ -620,7 +770,7 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			var usage *Usage
 			switch relayMode {
 			case RelayModeEmbeddings:
-				err, usage = aliEmbeddingHandler(c, resp)
+				err, usage = aliEmbeddingHandler(c, resp, textRequest)
 			default:
 				err, usage = aliHandler(c, resp)
 			}
@@ -641,10 +791,12 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 		}
 		var err *OpenAIErrorWithStatusCode
 		var usage *Usage
-		if isStream {
-			err, usage = xunfeiStreamHandler(c, textRequest, splits[0], splits[1], splits[2])
+		if relayMode == RelayModeEmbeddings {
+			err, usage = xunfeiEmbeddingHandler(c, textRequest, splits[0], splits[1], splits[2])
+		} else if isStream {
+			err, usage = xunfeiStreamHandler(c, textRequest, promptTokens, splits[0], splits[1], splits[2])
 		} else {
-			err, usage = xunfeiHandler(c, textRequest, splits[0], splits[1], splits[2])
+			err, usage = xunfeiHandler(c, textRequest, promptTokens, splits[0], splits[1], splits[2])
 		}
 		if err != nil {
 			return err
@@ -674,6 +826,44 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			return nil
 		}
 	case APITypeTencent:
+		if relayMode == RelayModeEmbeddings {
+			apiKey := c.Request.Header.Get("Authorization")
+			apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+			_, secretId, secretKey, err := parseTencentConfig(apiKey)
+			if err != nil {
+				return errorWrapper(err, "invalid_tencent_config", http.StatusInternalServerError)
+			}
+			openAIErr, usage := tencentEmbeddingHandler(c, textRequest, secretId, secretKey)
+			if openAIErr != nil {
+				return openAIErr
+			}
+			if usage != nil {
+				textResponse.Usage = *usage
+			}
+			return nil
+		}
+		apiKey := c.Request.Header.Get("Authorization")
+		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+		if isTencentCloudConfig(apiKey) {
+			_, secretId, secretKey, err := parseTencentConfig(apiKey)
+			if err != nil {
+				return errorWrapper(err, "invalid_tencent_config", http.StatusInternalServerError)
+			}
+			var openAIErr *OpenAIErrorWithStatusCode
+			var usage *Usage
+			if isStream {
+				openAIErr, usage = tencentCloudStreamHandler(c, textRequest, secretId, secretKey)
+			} else {
+				openAIErr, usage = tencentCloudHandler(c, textRequest, secretId, secretKey)
+			}
+			if openAIErr != nil {
+				return openAIErr
+			}
+			if usage != nil {
+				textResponse.Usage = *usage
+			}
+			return nil
+		}
 		if isStream {
 			err, responseText := tencentStreamHandler(c, resp)
 			if err != nil {
@@ -692,6 +882,93 @@ func relayTextHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 			}
 			return nil
 		}
+	case APITypeAwsBedrock:
+		if relayMode != RelayModeChatCompletions {
+			return errorWrapper(errors.New("only chat completions are supported by aws bedrock channel"), "unsupported_relay_mode", http.StatusBadRequest)
+		}
+		awsRequest, convertErr := requestOpenAI2Aws(textRequest, getAwsModelId(textRequest.Model))
+		if convertErr != nil {
+			return errorWrapper(convertErr, "unsupported_model", http.StatusBadRequest)
+		}
+		var err *OpenAIErrorWithStatusCode
+		var usage *Usage
+		if isStream {
+			err, usage = awsStreamHandler(c, textRequest.Model, awsRequest, promptTokens)
+		} else {
+			err, usage = awsHandler(c, textRequest.Model, awsRequest, promptTokens)
+		}
+		if err != nil {
+			return err
+		}
+		if usage != nil {
+			textResponse.Usage = *usage
+		}
+		return nil
+	case APITypeCohere:
+		var err *OpenAIErrorWithStatusCode
+		var usage *Usage
+		if relayMode == RelayModeEmbeddings {
+			err, usage = cohereEmbeddingHandler(c, resp, textRequest)
+		} else if isStream {
+			err, usage = cohereStreamHandler(c, resp, textRequest.Model)
+		} else {
+			err, usage = cohereHandler(c, resp)
+		}
+		if err != nil {
+			return err
+		}
+		if usage != nil {
+			textResponse.Usage = *usage
+		}
+		return nil
+	case APITypeOllama:
+		var err *OpenAIErrorWithStatusCode
+		var usage *Usage
+		if relayMode == RelayModeEmbeddings {
+			err, usage = ollamaEmbeddingHandler(c, textRequest, baseURL, promptTokens)
+		} else if isStream {
+			err, usage = ollamaStreamHandler(c, resp)
+		} else {
+			err, usage = ollamaHandler(c, resp)
+		}
+		if err != nil {
+			return err
+		}
+		if usage != nil {
+			textResponse.Usage = *usage
+			// ollama omits prompt_eval_count when the prompt is cached
+			if textResponse.Usage.PromptTokens == 0 {
+				textResponse.Usage.PromptTokens = promptTokens
+				textResponse.Usage.TotalTokens += promptTokens
+			}
+		}
+		return nil
+	case APITypeVertexAI:
+		var err *OpenAIErrorWithStatusCode
+		var usage *Usage
+		if isVertexClaudeModel(textRequest.Model) {
+			if isStream {
+				err, usage = claudeMessagesStreamHandler(c, resp)
+			} else {
+				err, usage = claudeMessagesHandler(c, resp)
+			}
+		} else if textRequest.Stream {
+			var responseText string
+			err, responseText = geminiChatStreamHandler(c, resp)
+			usage = &Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: countTokenText(responseText, textRequest.Model),
+			}
+		} else {
+			err, usage = geminiChatHandler(c, resp, promptTokens, textRequest.Model)
+		}
+		if err != nil {
+			return err
+		}
+		if usage != nil {
+			textResponse.Usage = *usage
+		}
+		return nil
 	default:
 		return errorWrapper(errors.New("unknown api type"), "unknown_api_type", http.StatusInternalServerError)
 	}
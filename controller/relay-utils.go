@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"one-api/model"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var stopFinishReason = "stop"
@@ -153,43 +155,129 @@ func (image imgInfo) calculateTokenCost() int {
 	return int(tiles)*tileCost + baseCost
 }
 
-func getImageInfo(url string) (*imgInfo, error) {
-	var isWebp bool
+// https://docs.anthropic.com/claude/docs/vision#calculate-image-costs
+// https://ai.google.dev/gemini-api/docs/tokens
+// https://help.aliyun.com/zh/dashscope/developer-reference/tongyi-qianwen-vl-plus-api
+func (image imgInfo) calculateTokenCostByChannel(channelType int) int {
+	switch channelType {
+	case common.ChannelTypeAnthropic:
+		// images are scaled down until the long edge is no more than 1568px
+		maxEdge := 1568
+		width, height := image.width, image.height
+		if width > maxEdge || height > maxEdge {
+			if width > height {
+				height = height * maxEdge / width
+				width = maxEdge
+			} else {
+				width = width * maxEdge / height
+				height = maxEdge
+			}
+		}
+		return int(math.Ceil(float64(width*height) / 750))
+	case common.ChannelTypeGemini:
+		// every image is counted as 258 tokens
+		return 258
+	case common.ChannelTypeAli:
+		// every 28x28 pixels is one token, an image costs 4 tokens at least and 1280 tokens at most
+		tokens := int(math.Ceil(float64(image.width)/28) * math.Ceil(float64(image.height)/28))
+		if tokens < 4 {
+			tokens = 4
+		}
+		if tokens > 1280 {
+			tokens = 1280
+		}
+		return tokens + 2
+	default:
+		return image.calculateTokenCost()
+	}
+}
+
+var allowedImageMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var imageHTTPClient = &http.Client{
+	Timeout: time.Duration(common.ImageFetchTimeout) * time.Second,
+}
+
+type imageContent struct {
+	mimeType string
+	data     []byte
+	width    int
+	height   int
+}
+
+// getImageContent loads the image from a http(s) url or data uri, images are checked against
+// the size and mime type limits, and cached in images if it is not nil
+func getImageContent(url string, images map[string]*imageContent) (*imageContent, error) {
+	if image, ok := images[url]; ok {
+		return image, nil
+	}
+	var mimeType string
 	var data []byte
 	var err error
 	switch {
 	case strings.HasPrefix(url, "data:image/"):
-		isWebp, data, err = getImageFromBase64(url)
-		break
+		mimeType, data, err = getImageFromBase64(url)
 	case strings.HasPrefix(url, "http"):
-		isWebp, data, err = getImageFromURL(url)
-		break
+		mimeType, data, err = getImageFromURL(url)
 	default:
 		return nil, errors.New("invalid image url")
 	}
-
-	res := &imgInfo{}
-	if isWebp {
+	if err != nil {
+		return nil, err
+	}
+	content := &imageContent{
+		mimeType: mimeType,
+		data:     data,
+	}
+	if mimeType == "image/webp" {
 		w, h, _, err := webp.GetInfo(data)
 		if err != nil {
 			return nil, errors.New("failed to get webp image info")
 		}
-		res.width = w
-		res.height = h
-		return res, nil
+		content.width = w
+		content.height = h
+	} else {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.New("failed to decode image")
+		}
+		content.width = config.Width
+		content.height = config.Height
+	}
+	if images != nil {
+		images[url] = content
 	}
-	img, _, err := image.Decode(bytes.NewReader(data))
+	return content, nil
+}
+
+func getImageInfo(url string) (*imgInfo, error) {
+	content, err := getImageContent(url, nil)
 	if err != nil {
-		return nil, errors.New("failed to decode image")
+		return nil, err
+	}
+	return &imgInfo{
+		width:  content.width,
+		height: content.height,
+	}, nil
+}
+
+func checkImage(mimeType string, size int) error {
+	if !allowedImageMimeTypes[mimeType] {
+		return fmt.Errorf("unsupported image type %s", mimeType)
+	}
+	if size > common.MaxImageSize*1024*1024 {
+		return fmt.Errorf("image is too large (over %d MB)", common.MaxImageSize)
 	}
-	res.width = img.Bounds().Dx()
-	res.height = img.Bounds().Dy()
-	return res, nil
+	return nil
 }
 
-func getImageFromURL(url string) (isWebp bool, resp []byte, err error) {
-	// Decode image
-	res, err := http.Get(url)
+func getImageFromURL(url string) (mimeType string, resp []byte, err error) {
+	res, err := imageHTTPClient.Get(url)
 	if err != nil {
 		err = errors.New("failed to get image")
 		return
@@ -197,25 +285,37 @@ func getImageFromURL(url string) (isWebp bool, resp []byte, err error) {
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(res.Body)
-
-	resp, err = io.ReadAll(res.Body)
-
-	contentType := res.Header.Get("Content-Type")
-	if strings.HasPrefix(contentType, "image/webp") {
-		isWebp = true
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to get image, status code %d", res.StatusCode)
+		return
 	}
-
+	mimeType = strings.TrimSpace(strings.Split(res.Header.Get("Content-Type"), ";")[0])
+	maxSize := common.MaxImageSize * 1024 * 1024
+	if res.ContentLength > int64(maxSize) {
+		err = checkImage(mimeType, int(res.ContentLength))
+		return
+	}
+	resp, err = io.ReadAll(io.LimitReader(res.Body, int64(maxSize)+1))
+	if err != nil {
+		err = errors.New("failed to read image")
+		return
+	}
+	if !allowedImageMimeTypes[mimeType] {
+		// some servers do not set a proper content type
+		mimeType = http.DetectContentType(resp)
+	}
+	err = checkImage(mimeType, len(resp))
 	return
 }
 
-func getImageFromBase64(base64Data string) (isWebp bool, resp []byte, err error) {
+func getImageFromBase64(base64Data string) (mimeType string, resp []byte, err error) {
 	// Remove data:image/xxx;base64, prefix
-	isWebp = strings.HasPrefix(base64Data, "image/webp")
 	data := strings.SplitN(base64Data, ",", 2)
 	if len(data) != 2 {
 		err = errors.New("invalid base64 data")
 		return
 	}
+	mimeType = strings.TrimPrefix(strings.Split(data[0], ";")[0], "data:")
 
 	// Decode base64 data
 	resp, err = base64.StdEncoding.DecodeString(data[1])
@@ -223,11 +323,30 @@ func getImageFromBase64(base64Data string) (isWebp bool, resp []byte, err error)
 		err = errors.New("failed to decoding base64 data")
 		return
 	}
-
+	err = checkImage(mimeType, len(resp))
 	return
 }
 
-func countVisionTokenMessage(messages []VisionMessage) (int, error) {
+func (m VisionMessage) ParseContent() []VisionContent {
+	var contents []VisionContent
+	err := json.Unmarshal(m.Content, &contents)
+	if err == nil {
+		return contents
+	}
+	var text string
+	err = json.Unmarshal(m.Content, &text)
+	if err != nil {
+		text = string(m.Content)
+	}
+	return []VisionContent{
+		{
+			Type: "text",
+			Text: text,
+		},
+	}
+}
+
+func countVisionTokenMessage(messages []VisionMessage, channelType int, images map[string]*imageContent) (int, error) {
 	tokenEncoder := getTokenEncoder("gpt-4")
 	var tokensPerMessage int
 	var tokensPerName int
@@ -241,34 +360,24 @@ func countVisionTokenMessage(messages []VisionMessage) (int, error) {
 			tokenNum += tokensPerName
 			tokenNum += getTokenNum(tokenEncoder, *message.Name)
 		}
-
-		content, err := message.Content.MarshalJSON()
-		if err != nil {
-			return 0, fmt.Errorf("failed to marshal content")
-		}
-
-		visions := make([]VisionContent, 0)
-		err = json.Unmarshal(content, &visions)
-
-		if err == nil {
-			for _, content := range visions {
-				tokenNum += getTokenNum(tokenEncoder, content.Text)
-				if len(content.ImageURL.URL) > 0 {
-					img, err := getImageInfo(content.ImageURL.URL)
-					if err != nil {
-						return 0, fmt.Errorf("failed to get %s info", content.ImageURL.URL)
-					}
-					detail := "auto"
-					if len(content.ImageURL.Detail) > 0 {
-						detail = content.ImageURL.Detail
-					}
-					img.detail = detail
-
-					tokenNum += img.calculateTokenCost()
+		for _, content := range message.ParseContent() {
+			tokenNum += getTokenNum(tokenEncoder, content.Text)
+			if len(content.ImageURL.URL) > 0 {
+				image, err := getImageContent(content.ImageURL.URL, images)
+				if err != nil {
+					return 0, fmt.Errorf("failed to get image info: %s", err.Error())
+				}
+				detail := "auto"
+				if len(content.ImageURL.Detail) > 0 {
+					detail = content.ImageURL.Detail
+				}
+				img := imgInfo{
+					width:  image.width,
+					height: image.height,
+					detail: detail,
 				}
+				tokenNum += img.calculateTokenCostByChannel(channelType)
 			}
-		} else {
-			tokenNum += getTokenNum(tokenEncoder, string(content))
 		}
 	}
 	tokenNum += 3 // Every reply is primed with <|start|>assistant<|message|>
@@ -285,10 +394,37 @@ func countTokenInput(input any, model string) int {
 			text += s
 		}
 		return countTokenText(text, model)
+	case []any:
+		text := ""
+		for _, item := range input.([]any) {
+			if s, ok := item.(string); ok {
+				text += s
+			}
+		}
+		return countTokenText(text, model)
 	}
 	return 0
 }
 
+// encodeEmbeddingResponse converts embeddings into the base64 format of OpenAI,
+// which is the little-endian float32 array encoded in base64
+func encodeEmbeddingResponse(response *OpenAIEmbeddingResponse, encodingFormat string) {
+	if encodingFormat != "base64" {
+		return
+	}
+	for i, item := range response.Data {
+		embedding, ok := item.Embedding.([]float64)
+		if !ok {
+			continue
+		}
+		buf := make([]byte, 4*len(embedding))
+		for j, value := range embedding {
+			binary.LittleEndian.PutUint32(buf[j*4:], math.Float32bits(float32(value)))
+		}
+		response.Data[i].Embedding = base64.StdEncoding.EncodeToString(buf)
+	}
+}
+
 func countTokenText(text string, model string) int {
 	tokenEncoder := getTokenEncoder(model)
 	return getTokenNum(tokenEncoder, text)
@@ -343,6 +479,17 @@ func setEventStreamHeaders(c *gin.Context) {
 	c.Writer.Header().Set("X-Accel-Buffering", "no")
 }
 
+// renderStreamError sends an error the upstream reported in the middle of a stream, the
+// status code has been sent already, so the error is sent as an event like OpenAI does
+func renderStreamError(c *gin.Context, openAIError OpenAIError) {
+	jsonResponse, err := json.Marshal(gin.H{"error": openAIError})
+	if err != nil {
+		common.SysError("error marshalling stream error: " + err.Error())
+		return
+	}
+	c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+}
+
 type GeneralErrorResponse struct {
 	Error    OpenAIError `json:"error"`
 	Message  string      `json:"message"`
@@ -433,20 +580,76 @@ func getFullRequestURL(baseURL string, requestURL string, channelType int) strin
 	return fullRequestURL
 }
 
-func postConsumeQuota(ctx context.Context, tokenId int, quotaDelta int, totalQuota int, userId int, channelId int, modelRatio float64, groupRatio float64, modelName string, tokenName string) {
-	// quotaDelta is remaining quota to be consumed
-	err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
+// reserveQuota holds the quota of a request until it is settled, see model.ReserveQuota
+func reserveQuota(userId int, tokenId int, quota int) (*model.QuotaReservation, *OpenAIErrorWithStatusCode) {
+	reservation, err := model.ReserveQuota(userId, tokenId, quota)
+	if errors.Is(err, model.ErrInsufficientUserQuota) {
+		return nil, errorWrapper(err, "insufficient_user_quota", http.StatusForbidden)
+	}
 	if err != nil {
-		common.SysError("error consuming token remain quota: " + err.Error())
+		return nil, errorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	}
+	return reservation, nil
+}
+
+// releaseQuota returns the reserved quota of a failed request
+func releaseQuota(ctx context.Context, reservation *model.QuotaReservation) {
+	if reservation == nil {
+		return
+	}
+	err := reservation.Settle(0)
+	if err != nil {
+		common.LogError(ctx, "error return pre-consumed quota: "+err.Error())
+	}
+}
+
+// channelCost is the upstream price of the channel serving a request
+type channelCost struct {
+	ratio  float64
+	prices map[string]common.ModelPrice
+}
+
+func getChannelCost(c *gin.Context) *channelCost {
+	cost := &channelCost{ratio: 1}
+	if ratio, ok := c.Get("cost_ratio"); ok {
+		cost.ratio = ratio.(float64)
 	}
-	err = model.CacheUpdateUserQuota(userId)
+	if prices := c.GetString("cost_prices"); prices != "" {
+		err := json.Unmarshal([]byte(prices), &cost.prices)
+		if err != nil {
+			common.LogWarn(c.Request.Context(), fmt.Sprintf("invalid cost prices of channel %d: %s", c.GetInt("channel_id"), err.Error()))
+		}
+	}
+	return cost
+}
+
+// quota returns the quota charged by the upstream, baseQuota is the quota of the request
+// without the group ratio, the upstream price of the model is only used for token usages
+func (cost *channelCost) quota(modelName string, baseQuota int, promptTokens int, cachedTokens int, completionTokens int) int {
+	if price, ok := cost.prices[modelName]; ok && promptTokens+completionTokens > 0 {
+		return price.Billing().Quota(promptTokens, cachedTokens, completionTokens, 1)
+	}
+	return int(math.Ceil(float64(baseQuota) * cost.ratio))
+}
+
+// imageQuota returns the quota charged by the upstream for images, the upstream price is per image
+func (cost *channelCost) imageQuota(modelName string, baseQuota int, imageCostRatio float64, n int) int {
+	if price, ok := cost.prices[modelName]; ok {
+		return int(price.Billing().RequestQuota*imageCostRatio) * n
+	}
+	return int(math.Ceil(float64(baseQuota) * cost.ratio))
+}
+
+func postConsumeQuota(ctx context.Context, reservation *model.QuotaReservation, totalQuota int, userId int, channelId int, modelRatio float64, groupRatio float64, modelName string, tokenName string, group string, channelCost *channelCost) {
+	err := reservation.Settle(totalQuota)
 	if err != nil {
-		common.SysError("error update user quota cache: " + err.Error())
+		common.SysError("error consuming token remain quota: " + err.Error())
 	}
 	// totalQuota is total quota consumed
 	if totalQuota != 0 {
 		logContent := fmt.Sprintf("Model multiplier %.2f, basic multiplier %.2f", modelRatio, groupRatio)
-		model.RecordConsumeLog(ctx, userId, channelId, totalQuota, 0, modelName, tokenName, totalQuota, logContent)
+		cost := channelCost.quota(modelName, int(math.Ceil(float64(totalQuota)/groupRatio)), 0, 0, 0)
+		model.RecordConsumeLog(ctx, userId, channelId, totalQuota, 0, modelName, tokenName, group, totalQuota, cost, logContent)
 		model.UpdateUserUsedQuotaAndRequestCount(userId, totalQuota)
 		model.UpdateChannelUsedQuota(channelId, totalQuota)
 	}
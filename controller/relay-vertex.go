@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/gemini
+// https://cloud.google.com/vertex-ai/generative-ai/docs/partner-models/use-claude
+// the channel key is the json key of a service account, and the region is set in the channel
+
+const vertexDefaultRegion = "us-central1"
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+const vertexAnthropicVersion = "vertex-2023-10-16"
+
+type VertexServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectId    string `json:"project_id"`
+	PrivateKeyId string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type VertexAccessToken struct {
+	AccessToken      string    `json:"access_token"`
+	ExpiresIn        int64     `json:"expires_in"`
+	TokenType        string    `json:"token_type"`
+	Error            string    `json:"error,omitempty"`
+	ErrorDescription string    `json:"error_description,omitempty"`
+	ExpiresAt        time.Time `json:"-"`
+}
+
+var vertexTokenStore sync.Map
+
+// claude models on vertex are versioned with an @, e.g. claude-3-sonnet@20240229
+var vertexClaudeModels = map[string]string{
+	"claude-3-haiku-20240307":  "claude-3-haiku@20240307",
+	"claude-3-sonnet-20240229": "claude-3-sonnet@20240229",
+	"claude-3-opus-20240229":   "claude-3-opus@20240229",
+}
+
+func isVertexClaudeModel(model string) bool {
+	return strings.HasPrefix(model, "claude")
+}
+
+func parseVertexServiceAccount(key string) (*VertexServiceAccount, error) {
+	var account VertexServiceAccount
+	err := json.Unmarshal([]byte(key), &account)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vertex ai service account: %s", err.Error())
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" || account.ProjectId == "" {
+		return nil, errors.New("invalid vertex ai service account: client_email, private_key and project_id are required")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &account, nil
+}
+
+func getVertexRequestURL(baseURL string, account *VertexServiceAccount, region string, model string, stream bool) string {
+	if region == "" {
+		region = vertexDefaultRegion
+	}
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s-aiplatform.googleapis.com", region)
+	}
+	publisher := "google"
+	action := "generateContent"
+	if stream {
+		action = "streamGenerateContent"
+	}
+	if isVertexClaudeModel(model) {
+		publisher = "anthropic"
+		action = "rawPredict"
+		if stream {
+			action = "streamRawPredict"
+		}
+		if vertexModel, ok := vertexClaudeModels[model]; ok {
+			model = vertexModel
+		}
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/%s/models/%s:%s",
+		baseURL, account.ProjectId, region, publisher, model, action)
+}
+
+func getVertexAccessToken(account *VertexServiceAccount) (string, error) {
+	cacheKey := account.ClientEmail + "|" + account.PrivateKeyId
+	if val, ok := vertexTokenStore.Load(cacheKey); ok {
+		var accessToken VertexAccessToken
+		if accessToken, ok = val.(VertexAccessToken); ok {
+			// soon this will expire
+			if time.Now().Add(10 * time.Minute).After(accessToken.ExpiresAt) {
+				go func() {
+					_, _ = getVertexAccessTokenHelper(account, cacheKey)
+				}()
+			}
+			if time.Now().Before(accessToken.ExpiresAt) {
+				return accessToken.AccessToken, nil
+			}
+		}
+	}
+	accessToken, err := getVertexAccessTokenHelper(account, cacheKey)
+	if err != nil {
+		return "", err
+	}
+	if accessToken == nil {
+		return "", errors.New("getVertexAccessToken return a nil token")
+	}
+	return (*accessToken).AccessToken, nil
+}
+
+// getVertexAccessTokenHelper exchanges a self signed jwt for an access token
+// https://developers.google.com/identity/protocols/oauth2/service-account#httprest
+func getVertexAccessTokenHelper(account *VertexServiceAccount, cacheKey string) (*VertexAccessToken, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   account.ClientEmail,
+		"scope": vertexScope,
+		"aud":   account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = account.PrivateKeyId
+	assertion, err := token.SignedString(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequest("POST", account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+	res, err := impatientHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var accessToken VertexAccessToken
+	err = json.NewDecoder(res.Body).Decode(&accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken.Error != "" {
+		return nil, errors.New(accessToken.Error + ": " + accessToken.ErrorDescription)
+	}
+	if accessToken.AccessToken == "" {
+		return nil, errors.New("getVertexAccessTokenHelper get empty access token")
+	}
+	accessToken.ExpiresAt = now.Add(time.Duration(accessToken.ExpiresIn) * time.Second)
+	vertexTokenStore.Store(cacheKey, accessToken)
+	return &accessToken, nil
+}
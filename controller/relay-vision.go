@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
@@ -31,15 +30,47 @@ func init() {
 	}
 }
 
+// isVisionChannel reports whether relayVisionHelper can talk to the channel type
+func isVisionChannel(channelType int) bool {
+	switch channelType {
+	case common.ChannelTypeBaidu, common.ChannelTypePaLM, common.ChannelTypeXunfei, common.ChannelTypeAIProxyLibrary,
+		common.ChannelTypeTencent, common.ChannelTypeOllama, common.ChannelTypeCohere:
+		return false
+	}
+	return true
+}
+
+// isVisionRequest reports whether the request carries images and the channel supports them,
+// other requests, including array content without images, go to the text relay
+func isVisionRequest(c *gin.Context) bool {
+	return isVisionChannel(c.GetInt("channel")) && common.UnmarshalBodyIsVersionModel(c)
+}
+
 func relayVisionHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode {
 	channelType := c.GetInt("channel")
 	channelId := c.GetInt("channel_id")
 	tokenId := c.GetInt("token_id")
 	userId := c.GetInt("id")
 	consumeQuota := c.GetBool("consume_quota")
+	isChannelTest := c.GetBool("channel_test")
 	group := c.GetString("group")
+	apiType := APITypeOpenAI
+	switch channelType {
+	case common.ChannelTypeAnthropic:
+		apiType = APITypeClaude
+	case common.ChannelTypeGemini:
+		apiType = APITypeGemini
+	case common.ChannelTypeAli:
+		apiType = APITypeAli
+	case common.ChannelTypeZhipu:
+		apiType = APITypeZhipu
+	case common.ChannelTypeAwsBedrock:
+		apiType = APITypeAwsBedrock
+	case common.ChannelTypeVertexAI:
+		apiType = APITypeVertexAI
+	}
 	var textRequest VisionOpenAIRequest
-	if consumeQuota || channelType == common.ChannelTypeAzure || channelType == common.ChannelTypePaLM {
+	if consumeQuota || channelType == common.ChannelTypeAzure || channelType == common.ChannelTypePaLM || apiType != APITypeOpenAI {
 		err := common.UnmarshalBodyReusable(c, &textRequest)
 		if err != nil {
 			return errorWrapper(err, "bind_request_body_failed", http.StatusBadRequest)
@@ -71,29 +102,70 @@ func relayVisionHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	if c.GetString("base_url") != "" {
 		baseURL = c.GetString("base_url")
 	}
+	apiKey := c.Request.Header.Get("Authorization")
+	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 	fullRequestURL := getFullRequestURL(baseURL, requestURL, channelType)
-	if channelType == common.ChannelTypeAzure {
-		// https://learn.microsoft.com/en-us/azure/cognitive-services/openai/chatgpt-quickstart?pivots=rest-api&tabs=command-line#rest-api
-		query := c.Request.URL.Query()
-		apiVersion := query.Get("api-version")
-		if apiVersion == "" {
-			apiVersion = c.GetString("api_version")
-		}
-		requestURL := strings.Split(requestURL, "?")[0]
-		requestURL = fmt.Sprintf("%s?api-version=%s", requestURL, apiVersion)
-		baseURL = c.GetString("base_url")
-		task := strings.TrimPrefix(requestURL, "/v1/")
-		model_ := textRequest.Model
-		model_ = strings.Replace(model_, ".", "", -1)
-		// https://github.com/songquanpeng/one-api/issues/67
-		model_ = strings.TrimSuffix(model_, "-0301")
-		model_ = strings.TrimSuffix(model_, "-0314")
-		model_ = strings.TrimSuffix(model_, "-0613")
-		fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/%s", baseURL, model_, task)
+	switch apiType {
+	case APITypeOpenAI:
+		if channelType == common.ChannelTypeAzure {
+			// https://learn.microsoft.com/en-us/azure/cognitive-services/openai/chatgpt-quickstart?pivots=rest-api&tabs=command-line#rest-api
+			query := c.Request.URL.Query()
+			apiVersion := query.Get("api-version")
+			if apiVersion == "" {
+				apiVersion = c.GetString("api_version")
+			}
+			requestURL := strings.Split(requestURL, "?")[0]
+			requestURL = fmt.Sprintf("%s?api-version=%s", requestURL, apiVersion)
+			baseURL = c.GetString("base_url")
+			task := strings.TrimPrefix(requestURL, "/v1/")
+			model_ := textRequest.Model
+			model_ = strings.Replace(model_, ".", "", -1)
+			// https://github.com/songquanpeng/one-api/issues/67
+			model_ = strings.TrimSuffix(model_, "-0301")
+			model_ = strings.TrimSuffix(model_, "-0314")
+			model_ = strings.TrimSuffix(model_, "-0613")
+			fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/%s", baseURL, model_, task)
+		}
+	case APITypeClaude:
+		// images are only supported by the messages api
+		fullRequestURL = "https://api.anthropic.com/v1/messages"
+		if baseURL != "" {
+			fullRequestURL = fmt.Sprintf("%s/v1/messages", baseURL)
+		}
+	case APITypeGemini:
+		requestBaseURL := "https://generativelanguage.googleapis.com"
+		if baseURL != "" {
+			requestBaseURL = baseURL
+		}
+		version := "v1"
+		if c.GetString("api_version") != "" {
+			version = c.GetString("api_version")
+		}
+		action := "generateContent"
+		if textRequest.Stream {
+			action = "streamGenerateContent"
+		}
+		fullRequestURL = fmt.Sprintf("%s/%s/models/%s:%s?key=%s", requestBaseURL, version, textRequest.Model, action, apiKey)
+	case APITypeAli:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/multimodal-generation/generation", baseURL)
+	case APITypeZhipu:
+		fullRequestURL = fmt.Sprintf("%s/api/paas/v4/chat/completions", baseURL)
+	case APITypeVertexAI:
+		account, err := parseVertexServiceAccount(apiKey)
+		if err != nil {
+			return errorWrapper(err, "invalid_vertex_config", http.StatusInternalServerError)
+		}
+		apiKey, err = getVertexAccessToken(account)
+		if err != nil {
+			return errorWrapper(err, "get_vertex_access_token_failed", http.StatusInternalServerError)
+		}
+		fullRequestURL = getVertexRequestURL(c.GetString("base_url"), account, c.GetString("region"), textRequest.Model, textRequest.Stream)
 	}
 	var promptTokens int
 	var completionTokens int
-	promptTokens, err := countVisionTokenMessage(textRequest.Messages)
+	// images are downloaded once, both for counting tokens and for providers requiring inline data
+	images := make(map[string]*imageContent)
+	promptTokens, err := countVisionTokenMessage(textRequest.Messages, channelType, images)
 	if err != nil {
 		return errorWrapper(err, "count_prompt_tokens_failed", http.StatusBadRequest)
 	}
@@ -104,33 +176,70 @@ func relayVisionHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	modelRatio := common.GetModelRatio(textRequest.Model)
 	groupRatio := common.GetGroupRatio(group)
 	ratio := modelRatio * groupRatio
-	preConsumedQuota := int(float64(preConsumedTokens) * ratio)
-	userQuota, err := model.CacheGetUserQuota(userId)
-	if err != nil {
-		return errorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	billing := common.GetModelBilling(textRequest.Model)
+	channelCost := getChannelCost(c)
+	preConsumedQuota := billing.Quota(preConsumedTokens, 0, 0, groupRatio)
+	var reservation *model.QuotaReservation
+	// channel tests are not billed
+	if !isChannelTest && consumeQuota {
+		var openAIErr *OpenAIErrorWithStatusCode
+		reservation, openAIErr = reserveQuota(userId, tokenId, preConsumedQuota)
+		if openAIErr != nil {
+			return openAIErr
+		}
 	}
-	if userQuota-preConsumedQuota < 0 {
-		return errorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	// the reservation is released on every return before the response is billed below
+	settling := false
+	defer func() {
+		if !settling {
+			go releaseQuota(c.Request.Context(), reservation)
+		}
+	}()
+	var requestBody io.Reader
+	var convertedRequest any
+	switch apiType {
+	case APITypeClaude:
+		convertedRequest, err = visionRequestOpenAI2Claude(textRequest, images)
+	case APITypeGemini:
+		convertedRequest, err = visionRequestOpenAI2Gemini(textRequest, images)
+	case APITypeAli:
+		convertedRequest = visionRequestOpenAI2Ali(textRequest)
+	case APITypeZhipu:
+		convertedRequest, err = visionRequestOpenAI2Zhipu(textRequest)
+	case APITypeAwsBedrock:
+		if getAwsModelProvider(getAwsModelId(textRequest.Model)) != "anthropic" {
+			return errorWrapper(errors.New("image input is only supported by claude models on aws bedrock"), "unsupported_model", http.StatusBadRequest)
+		}
+		var claudeRequest *ClaudeMessagesRequest
+		claudeRequest, err = visionRequestOpenAI2Claude(textRequest, images)
+		if err == nil {
+			claudeRequest.Model = ""
+			claudeRequest.Stream = false
+			claudeRequest.AnthropicVersion = "bedrock-2023-05-31"
+		}
+		convertedRequest = claudeRequest
+	case APITypeVertexAI:
+		if isVertexClaudeModel(textRequest.Model) {
+			var claudeRequest *ClaudeMessagesRequest
+			claudeRequest, err = visionRequestOpenAI2Claude(textRequest, images)
+			if err == nil {
+				claudeRequest.Model = ""
+				claudeRequest.AnthropicVersion = vertexAnthropicVersion
+			}
+			convertedRequest = claudeRequest
+		} else {
+			convertedRequest, err = visionRequestOpenAI2Gemini(textRequest, images)
+		}
+	default:
+		if isModelMapped {
+			convertedRequest = textRequest
+		}
 	}
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
 	if err != nil {
-		return errorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota > 100*preConsumedQuota {
-		// in this case, we do not pre-consume quota
-		// because the user has enough quota
-		preConsumedQuota = 0
-		common.LogInfo(c.Request.Context(), fmt.Sprintf("user %d has enough quota %d, trusted and no need to pre-consume", userId, userQuota))
-	}
-	if consumeQuota && preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
-		if err != nil {
-			return errorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
-		}
+		return errorWrapper(err, "convert_request_failed", http.StatusBadRequest)
 	}
-	var requestBody io.Reader
-	if isModelMapped {
-		jsonStr, err := json.Marshal(textRequest)
+	if convertedRequest != nil && apiType != APITypeAwsBedrock {
+		jsonStr, err := json.Marshal(convertedRequest)
 		if err != nil {
 			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
 		}
@@ -143,66 +252,83 @@ func relayVisionHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 	var resp *http.Response
 	isStream := textRequest.Stream
 
-	req, err = http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
-	if err != nil {
-		return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
-	}
-	apiKey := c.Request.Header.Get("Authorization")
-	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
-	if channelType == common.ChannelTypeAzure {
-		req.Header.Set("api-key", apiKey)
-	} else {
-		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
-		if channelType == common.ChannelTypeOpenRouter {
-			req.Header.Set("HTTP-Referer", "https://github.com/songquanpeng/one-api")
-			req.Header.Set("X-Title", "One API")
+	// aws bedrock requires signing the converted body, its handlers send the request themselves
+	if apiType != APITypeAwsBedrock {
+		req, err = http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+		if err != nil {
+			return errorWrapper(err, "new_request_failed", http.StatusInternalServerError)
 		}
-	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
-	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
-	if isStream && c.Request.Header.Get("Accept") == "" {
-		req.Header.Set("Accept", "text/event-stream")
-	}
-	//req.Header.Set("Connection", c.Request.Header.Get("Connection"))
-	resp, err = httpClient.Do(req)
-	if err != nil {
-		return errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
-	}
-	err = req.Body.Close()
-	if err != nil {
-		return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
-	}
-	err = c.Request.Body.Close()
-	if err != nil {
-		return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
-	}
-	isStream = isStream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
-
-	if resp.StatusCode != http.StatusOK {
-		if preConsumedQuota != 0 {
-			go func(ctx context.Context) {
-				// return pre-consumed quota
-				err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
-				if err != nil {
-					common.LogError(ctx, "error return pre-consumed quota: "+err.Error())
+		switch apiType {
+		case APITypeOpenAI:
+			if channelType == common.ChannelTypeAzure {
+				req.Header.Set("api-key", apiKey)
+			} else {
+				req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
+				if channelType == common.ChannelTypeOpenRouter {
+					req.Header.Set("HTTP-Referer", "https://github.com/songquanpeng/one-api")
+					req.Header.Set("X-Title", "One API")
 				}
-			}(c.Request.Context())
+			}
+		case APITypeClaude:
+			req.Header.Set("x-api-key", apiKey)
+			anthropicVersion := c.Request.Header.Get("anthropic-version")
+			if anthropicVersion == "" {
+				anthropicVersion = "2023-06-01"
+			}
+			req.Header.Set("anthropic-version", anthropicVersion)
+		case APITypeGemini:
+			// do not set Authorization header
+		case APITypeAli:
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+			if textRequest.Stream {
+				req.Header.Set("X-DashScope-SSE", "enable")
+			}
+		case APITypeZhipu:
+			req.Header.Set("Authorization", getZhipuToken(apiKey))
+		case APITypeVertexAI:
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+		req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+		if isStream && c.Request.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		//req.Header.Set("Connection", c.Request.Header.Get("Connection"))
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			return errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		}
+		err = req.Body.Close()
+		if err != nil {
+			return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+		}
+		err = c.Request.Body.Close()
+		if err != nil {
+			return errorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+		}
+		isStream = isStream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+
+		if resp.StatusCode != http.StatusOK {
+			return relayErrorHandler(resp)
 		}
-		return relayErrorHandler(resp)
 	}
 
 	var textResponse TextResponse
 	tokenName := c.GetString("token_name")
 
+	settling = true
 	defer func(ctx context.Context) {
+		if reservation == nil {
+			return
+		}
 		// c.Writer.Flush()
 		go func() {
 			if consumeQuota {
 				quota := 0
-				completionRatio := common.GetCompletionRatio(textRequest.Model)
 				promptTokens = textResponse.Usage.PromptTokens
 				completionTokens = textResponse.Usage.CompletionTokens
-				quota = int(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+				cachedTokens := textResponse.Usage.GetCachedTokens()
+				quota = billing.Quota(promptTokens, cachedTokens, completionTokens, groupRatio)
 				if ratio != 0 && quota <= 0 {
 					quota = 1
 				}
@@ -212,40 +338,87 @@ func relayVisionHelper(c *gin.Context, relayMode int) *OpenAIErrorWithStatusCode
 					// we cannot just return, because we may have to return the pre-consumed quota
 					quota = 0
 				}
-				quotaDelta := quota - preConsumedQuota
-				err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
+				err := reservation.Settle(quota)
 				if err != nil {
 					common.LogError(ctx, "error consuming token remain quota: "+err.Error())
 				}
-				err = model.CacheUpdateUserQuota(userId)
-				if err != nil {
-					common.LogError(ctx, "error update user quota cache: "+err.Error())
-				}
 				if quota != 0 {
 					logContent := fmt.Sprintf("Model multiplier %.2f, basic multiplier %.2f", modelRatio, groupRatio)
-					model.RecordConsumeLog(ctx, userId, channelId, promptTokens, completionTokens, textRequest.Model, tokenName, quota, logContent)
+					cost := channelCost.quota(textRequest.Model, billing.Quota(promptTokens, cachedTokens, completionTokens, 1), promptTokens, cachedTokens, completionTokens)
+					model.RecordConsumeLog(ctx, userId, channelId, promptTokens, completionTokens, textRequest.Model, tokenName, group, quota, cost, logContent)
 					model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 					model.UpdateChannelUsedQuota(channelId, quota)
 				}
 			}
 		}()
 	}(c.Request.Context())
-	if isStream {
-		err, responseText := openaiStreamHandler(c, resp, relayMode)
-		if err != nil {
-			return err
+	var openAIErr *OpenAIErrorWithStatusCode
+	var usage *Usage
+	var responseText string
+	switch apiType {
+	case APITypeClaude:
+		if isStream {
+			openAIErr, usage = claudeMessagesStreamHandler(c, resp)
+		} else {
+			openAIErr, usage = claudeMessagesHandler(c, resp)
 		}
-		textResponse.Usage.PromptTokens = promptTokens
-		textResponse.Usage.CompletionTokens = countTokenText(responseText, textRequest.Model)
-		return nil
-	} else {
-		err, usage := openaiHandler(c, resp, consumeQuota, promptTokens, textRequest.Model)
-		if err != nil {
-			return err
+	case APITypeGemini:
+		if textRequest.Stream {
+			openAIErr, responseText = geminiChatStreamHandler(c, resp)
+		} else {
+			openAIErr, usage = geminiChatHandler(c, resp, promptTokens, textRequest.Model)
+		}
+	case APITypeVertexAI:
+		if isVertexClaudeModel(textRequest.Model) {
+			if isStream {
+				openAIErr, usage = claudeMessagesStreamHandler(c, resp)
+			} else {
+				openAIErr, usage = claudeMessagesHandler(c, resp)
+			}
+		} else if textRequest.Stream {
+			openAIErr, responseText = geminiChatStreamHandler(c, resp)
+		} else {
+			openAIErr, usage = geminiChatHandler(c, resp, promptTokens, textRequest.Model)
+		}
+	case APITypeAwsBedrock:
+		if isStream {
+			openAIErr, usage = awsStreamHandler(c, textRequest.Model, convertedRequest, promptTokens)
+		} else {
+			openAIErr, usage = awsHandler(c, textRequest.Model, convertedRequest, promptTokens)
+		}
+	case APITypeZhipu:
+		// glm-4v always uses the v4 api
+		if isStream {
+			openAIErr, usage = zhipuV4StreamHandler(c, resp, promptTokens, textRequest.Model)
+		} else {
+			openAIErr, usage = openaiHandler(c, resp, true, promptTokens, textRequest.Model)
 		}
-		if usage != nil {
-			textResponse.Usage = *usage
+	case APITypeAli:
+		if isStream {
+			openAIErr, usage = aliVLStreamHandler(c, resp)
+		} else {
+			openAIErr, usage = aliVLHandler(c, resp)
 		}
-		return nil
+	default:
+		if isStream {
+			openAIErr, responseText = openaiStreamHandler(c, resp, relayMode)
+		} else {
+			// the estimated prompt tokens already include the images, use them when upstream reports no usage
+			openAIErr, usage = openaiHandler(c, resp, consumeQuota || apiType != APITypeOpenAI, promptTokens, textRequest.Model)
+		}
+	}
+	if openAIErr != nil {
+		return openAIErr
+	}
+	if usage != nil {
+		textResponse.Usage = *usage
+	}
+	// prefer the usage reported by upstream, which bills images with the provider's own rules
+	if textResponse.Usage.PromptTokens == 0 {
+		textResponse.Usage.PromptTokens = promptTokens
+	}
+	if textResponse.Usage.CompletionTokens == 0 && responseText != "" {
+		textResponse.Usage.CompletionTokens = countTokenText(responseText, textRequest.Model)
 	}
+	return nil
 }
@@ -1,18 +1,24 @@
 package controller
 
 import (
+	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"one-api/common"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -41,13 +47,23 @@ type XunfeiChatRequest struct {
 		Message struct {
 			Text []XunfeiMessage `json:"text"`
 		} `json:"message"`
+		Functions *struct {
+			Text []json.RawMessage `json:"text"`
+		} `json:"functions,omitempty"`
 	} `json:"payload"`
 }
 
+type XunfeiFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
 type XunfeiChatResponseTextItem struct {
-	Content string `json:"content"`
-	Role    string `json:"role"`
-	Index   int    `json:"index"`
+	Content      string              `json:"content"`
+	Role         string              `json:"role"`
+	Index        int                 `json:"index"`
+	ContentType  string              `json:"content_type,omitempty"`
+	FunctionCall *XunfeiFunctionCall `json:"function_call,omitempty"`
 }
 
 type XunfeiChatResponse struct {
@@ -64,21 +80,96 @@ type XunfeiChatResponse struct {
 			Text   []XunfeiChatResponseTextItem `json:"text"`
 		} `json:"choices"`
 		Usage struct {
-			//Text struct {
-			//	QuestionTokens   string `json:"question_tokens"`
-			//	PromptTokens     string `json:"prompt_tokens"`
-			//	CompletionTokens string `json:"completion_tokens"`
-			//	TotalTokens      string `json:"total_tokens"`
-			//} `json:"text"`
+			// question_tokens is also returned, prompt_tokens includes the history
 			Text Usage `json:"text"`
 		} `json:"usage"`
 	} `json:"payload"`
 }
 
-func requestOpenAI2Xunfei(request GeneralOpenAIRequest, xunfeiAppId string, domain string) *XunfeiChatRequest {
+// xunfeiVersion describes a spark version, the version of a request is taken from the api-version query,
+// the model (e.g. SparkDesk-v3.5) or the channel, and defaults to v1.1
+type xunfeiVersion struct {
+	Path      string
+	Domain    string
+	MaxTokens int
+	// the system role and function calling are supported since v3.1
+	System    bool
+	Functions bool
+}
+
+// https://www.xfyun.cn/doc/spark/Web.html#_1-%E6%8E%A5%E5%8F%A3%E8%AF%B4%E6%98%8E
+var xunfeiVersions = map[string]xunfeiVersion{
+	"v1.1":     {Path: "v1.1/chat", Domain: "lite", MaxTokens: 4096},
+	"v2.1":     {Path: "v2.1/chat", Domain: "generalv2", MaxTokens: 8192},
+	"v3.1":     {Path: "v3.1/chat", Domain: "generalv3", MaxTokens: 8192, System: true, Functions: true},
+	"pro-128k": {Path: "chat/pro-128k", Domain: "pro-128k", MaxTokens: 4096, System: true},
+	"v3.5":     {Path: "v3.5/chat", Domain: "generalv3.5", MaxTokens: 8192, System: true, Functions: true},
+	"v4.0":     {Path: "v4.0/chat", Domain: "4.0Ultra", MaxTokens: 8192, System: true, Functions: true},
+}
+
+func getXunfeiVersion(c *gin.Context, model string) xunfeiVersion {
+	apiVersion := c.Request.URL.Query().Get("api-version")
+	if apiVersion == "" && strings.HasPrefix(model, "SparkDesk-") {
+		apiVersion = strings.TrimPrefix(model, "SparkDesk-")
+	}
+	if apiVersion == "" {
+		apiVersion = c.GetString("api_version")
+	}
+	if apiVersion == "" {
+		apiVersion = "v1.1"
+		common.SysLog("api_version not found, use default: " + apiVersion)
+	}
+	version, ok := xunfeiVersions[apiVersion]
+	if !ok {
+		// unknown versions follow the naming of v2.1 and v3.1
+		version = xunfeiVersion{
+			Path:      apiVersion + "/chat",
+			Domain:    "general" + strings.Split(apiVersion, ".")[0],
+			MaxTokens: 8192,
+		}
+	}
+	return version
+}
+
+// getXunfeiFunctions collects the function definitions from both tools and the legacy functions
+func getXunfeiFunctions(request GeneralOpenAIRequest) []json.RawMessage {
+	var functions []json.RawMessage
+	if request.Tools != nil {
+		var tools []struct {
+			Type     string          `json:"type"`
+			Function json.RawMessage `json:"function"`
+		}
+		data, err := json.Marshal(request.Tools)
+		if err == nil && json.Unmarshal(data, &tools) == nil {
+			for _, tool := range tools {
+				if tool.Type == "function" && len(tool.Function) != 0 {
+					functions = append(functions, tool.Function)
+				}
+			}
+		}
+	}
+	if request.Functions != nil {
+		var legacyFunctions []json.RawMessage
+		data, err := json.Marshal(request.Functions)
+		if err == nil && json.Unmarshal(data, &legacyFunctions) == nil {
+			functions = append(functions, legacyFunctions...)
+		}
+	}
+	return functions
+}
+
+func requestOpenAI2Xunfei(request GeneralOpenAIRequest, xunfeiAppId string, version xunfeiVersion) *XunfeiChatRequest {
 	messages := make([]XunfeiMessage, 0, len(request.Messages))
 	for _, message := range request.Messages {
-		if message.Role == "system" {
+		switch message.Role {
+		case "system":
+			if version.System {
+				messages = append(messages, XunfeiMessage{
+					Role:    "system",
+					Content: message.Content,
+				})
+				continue
+			}
 			messages = append(messages, XunfeiMessage{
 				Role:    "user",
 				Content: message.Content,
@@ -87,60 +178,122 @@ func requestOpenAI2Xunfei(request GeneralOpenAIRequest, xunfeiAppId string, doma
 				Role:    "assistant",
 				Content: "Okay",
 			})
-		} else {
+		case "tool", "function":
+			// spark has no role for function results
 			messages = append(messages, XunfeiMessage{
-				Role:    message.Role,
+				Role:    "user",
 				Content: message.Content,
 			})
+		default:
+			content := message.Content
+			if content == "" && message.Role == "assistant" {
+				// spark rejects empty messages, the function call is sent as the content instead
+				functionCall := message.ToolCalls
+				if functionCall == nil {
+					functionCall = message.FunctionCall
+				}
+				if functionCall != nil {
+					data, _ := json.Marshal(functionCall)
+					content = string(data)
+				}
+			}
+			messages = append(messages, XunfeiMessage{
+				Role:    message.Role,
+				Content: content,
+			})
 		}
 	}
 	xunfeiRequest := XunfeiChatRequest{}
 	xunfeiRequest.Header.AppId = xunfeiAppId
-	xunfeiRequest.Parameter.Chat.Domain = domain
-	xunfeiRequest.Parameter.Chat.Temperature = request.Temperature
-	xunfeiRequest.Parameter.Chat.TopK = request.N
+	xunfeiRequest.Parameter.Chat.Domain = version.Domain
+	// spark accepts temperature in (0, 1] and top_k in [1, 6]
+	xunfeiRequest.Parameter.Chat.Temperature = math.Min(request.Temperature, 1)
+	xunfeiRequest.Parameter.Chat.TopK = request.TopK
+	if request.TopK > 6 {
+		xunfeiRequest.Parameter.Chat.TopK = 6
+	}
 	xunfeiRequest.Parameter.Chat.MaxTokens = request.MaxTokens
+	if request.MaxTokens > version.MaxTokens {
+		xunfeiRequest.Parameter.Chat.MaxTokens = version.MaxTokens
+	}
 	xunfeiRequest.Payload.Message.Text = messages
+	if version.Functions {
+		if functions := getXunfeiFunctions(request); len(functions) != 0 {
+			xunfeiRequest.Payload.Functions = &struct {
+				Text []json.RawMessage `json:"text"`
+			}{Text: functions}
+		}
+	}
 	return &xunfeiRequest
 }
 
-func responseXunfei2OpenAI(response *XunfeiChatResponse) *OpenAITextResponse {
-	if len(response.Payload.Choices.Text) == 0 {
-		response.Payload.Choices.Text = []XunfeiChatResponseTextItem{
+// functionCallXunfei2OpenAI sets the function call in the format of the request, which is tools or the legacy functions,
+// and returns the finish reason
+func functionCallXunfei2OpenAI(functionCall *XunfeiFunctionCall, tools bool) (toolCalls []ToolCall, legacyCall *FunctionCall, finishReason string) {
+	call := FunctionCall{
+		Name:      functionCall.Name,
+		Arguments: functionCall.Arguments,
+	}
+	if tools {
+		toolCalls = []ToolCall{
 			{
-				Content: "",
+				Id:       fmt.Sprintf("call_%s", common.GetUUID()),
+				Type:     "function",
+				Function: call,
 			},
 		}
+		return toolCalls, nil, "tool_calls"
 	}
+	return nil, &call, "function_call"
+}
+
+func responseXunfei2OpenAI(content string, functionCall *XunfeiFunctionCall, tools bool, usage Usage) *OpenAITextResponse {
 	choice := OpenAITextResponseChoice{
 		Index: 0,
 		Message: Message{
 			Role:    "assistant",
-			Content: response.Payload.Choices.Text[0].Content,
+			Content: content,
 		},
 		FinishReason: stopFinishReason,
 	}
+	if functionCall != nil {
+		toolCalls, legacyCall, finishReason := functionCallXunfei2OpenAI(functionCall, tools)
+		if toolCalls != nil {
+			choice.Message.ToolCalls = toolCalls
+		}
+		if legacyCall != nil {
+			choice.Message.FunctionCall = legacyCall
+		}
+		choice.FinishReason = finishReason
+	}
 	fullTextResponse := OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
 		Object:  "chat.completion",
 		Created: common.GetTimestamp(),
 		Choices: []OpenAITextResponseChoice{choice},
-		Usage:   response.Payload.Usage.Text,
+		Usage:   usage,
 	}
 	return &fullTextResponse
 }
 
-func streamResponseXunfei2OpenAI(xunfeiResponse *XunfeiChatResponse) *ChatCompletionsStreamResponse {
-	if len(xunfeiResponse.Payload.Choices.Text) == 0 {
-		xunfeiResponse.Payload.Choices.Text = []XunfeiChatResponseTextItem{
-			{
-				Content: "",
-			},
+// streamResponseXunfei2OpenAI converts a frame, finishReason is used for the last frame
+func streamResponseXunfei2OpenAI(xunfeiResponse *XunfeiChatResponse, tools bool, finishReason *string) *ChatCompletionsStreamResponse {
+	var choice ChatCompletionsStreamResponseChoice
+	for _, item := range xunfeiResponse.Payload.Choices.Text {
+		choice.Delta.Content += item.Content
+		if item.FunctionCall != nil {
+			toolCalls, legacyCall, reason := functionCallXunfei2OpenAI(item.FunctionCall, tools)
+			if toolCalls != nil {
+				choice.Delta.ToolCalls = toolCalls
+			}
+			if legacyCall != nil {
+				choice.Delta.FunctionCall = legacyCall
+			}
+			*finishReason = reason
 		}
 	}
-	var choice ChatCompletionsStreamResponseChoice
-	choice.Delta.Content = xunfeiResponse.Payload.Choices.Text[0].Content
 	if xunfeiResponse.Payload.Choices.Status == 2 {
-		choice.FinishReason = &stopFinishReason
+		choice.FinishReason = finishReason
 	}
 	response := ChatCompletionsStreamResponse{
 		Object:  "chat.completion.chunk",
@@ -152,6 +305,10 @@ func streamResponseXunfei2OpenAI(xunfeiResponse *XunfeiChatResponse) *ChatComple
 }
 
 func buildXunfeiAuthUrl(hostUrl string, apiKey, apiSecret string) string {
+	return buildXunfeiAuthUrlWithMethod(http.MethodGet, hostUrl, apiKey, apiSecret)
+}
+
+func buildXunfeiAuthUrlWithMethod(method string, hostUrl string, apiKey, apiSecret string) string {
 	HmacWithShaToBase64 := func(algorithm, data, key string) string {
 		mac := hmac.New(sha256.New, []byte(key))
 		mac.Write([]byte(data))
@@ -163,7 +320,7 @@ func buildXunfeiAuthUrl(hostUrl string, apiKey, apiSecret string) string {
 		fmt.Println(err)
 	}
 	date := time.Now().UTC().Format(time.RFC1123)
-	signString := []string{"host: " + ul.Host, "date: " + date, "GET " + ul.Path + " HTTP/1.1"}
+	signString := []string{"host: " + ul.Host, "date: " + date, method + " " + ul.Path + " HTTP/1.1"}
 	sign := strings.Join(signString, "\n")
 	sha := HmacWithShaToBase64("hmac-sha256", sign, apiSecret)
 	authUrl := fmt.Sprintf("hmac username=\"%s\", algorithm=\"%s\", headers=\"%s\", signature=\"%s\"", apiKey,
@@ -177,21 +334,46 @@ func buildXunfeiAuthUrl(hostUrl string, apiKey, apiSecret string) string {
 	return callUrl
 }
 
-func xunfeiStreamHandler(c *gin.Context, textRequest GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*OpenAIErrorWithStatusCode, *Usage) {
-	domain, authUrl := getXunfeiAuthUrl(c, apiKey, apiSecret)
-	dataChan, stopChan, err := xunfeiMakeRequest(textRequest, domain, authUrl, appId)
-	if err != nil {
-		return errorWrapper(err, "make xunfei request err", http.StatusInternalServerError), nil
+func xunfeiErrorWrapper(response *XunfeiChatResponse) *OpenAIErrorWithStatusCode {
+	statusCode := http.StatusInternalServerError
+	switch response.Header.Code {
+	case 11201, 11202, 11203:
+		// the daily limit, qps limit and concurrency limit are exceeded
+		statusCode = http.StatusTooManyRequests
+	}
+	return &OpenAIErrorWithStatusCode{
+		OpenAIError: OpenAIError{
+			Message: response.Header.Message,
+			Type:    "xunfei_error",
+			Param:   response.Header.Sid,
+			Code:    response.Header.Code,
+		},
+		StatusCode: statusCode,
+	}
+}
+
+func xunfeiStreamHandler(c *gin.Context, textRequest GeneralOpenAIRequest, promptTokens int, appId string, apiSecret string, apiKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	version := getXunfeiVersion(c, textRequest.Model)
+	dataChan, stopChan, openAIErr := xunfeiMakeRequest(c.Request.Context(), textRequest, version, appId, apiSecret, apiKey)
+	if openAIErr != nil {
+		return openAIErr, nil
 	}
+	tools := textRequest.Tools != nil
+	finishReason := stopFinishReason
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
 	setEventStreamHeaders(c)
 	var usage Usage
+	var responseText string
 	c.Stream(func(w io.Writer) bool {
 		select {
 		case xunfeiResponse := <-dataChan:
-			usage.PromptTokens += xunfeiResponse.Payload.Usage.Text.PromptTokens
-			usage.CompletionTokens += xunfeiResponse.Payload.Usage.Text.CompletionTokens
-			usage.TotalTokens += xunfeiResponse.Payload.Usage.Text.TotalTokens
-			response := streamResponseXunfei2OpenAI(&xunfeiResponse)
+			// the usage is returned with the last frame
+			if xunfeiResponse.Payload.Usage.Text.TotalTokens != 0 {
+				usage = xunfeiResponse.Payload.Usage.Text
+			}
+			response := streamResponseXunfei2OpenAI(&xunfeiResponse, tools, &finishReason)
+			response.Id = responseId
+			responseText += response.Choices[0].Delta.Content
 			jsonResponse, err := json.Marshal(response)
 			if err != nil {
 				common.SysError("error marshalling stream response: " + err.Error())
@@ -202,44 +384,52 @@ func xunfeiStreamHandler(c *gin.Context, textRequest GeneralOpenAIRequest, appId
 		case <-stopChan:
 			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
 			return false
+		case <-c.Request.Context().Done():
+			return false
 		}
 	})
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = promptTokens
+		usage.CompletionTokens = countTokenText(responseText, textRequest.Model)
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
 	return nil, &usage
 }
 
-func xunfeiHandler(c *gin.Context, textRequest GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*OpenAIErrorWithStatusCode, *Usage) {
-	domain, authUrl := getXunfeiAuthUrl(c, apiKey, apiSecret)
-	dataChan, stopChan, err := xunfeiMakeRequest(textRequest, domain, authUrl, appId)
-	if err != nil {
-		return errorWrapper(err, "make xunfei request err", http.StatusInternalServerError), nil
+func xunfeiHandler(c *gin.Context, textRequest GeneralOpenAIRequest, promptTokens int, appId string, apiSecret string, apiKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	version := getXunfeiVersion(c, textRequest.Model)
+	dataChan, stopChan, openAIErr := xunfeiMakeRequest(c.Request.Context(), textRequest, version, appId, apiSecret, apiKey)
+	if openAIErr != nil {
+		return openAIErr, nil
 	}
 	var usage Usage
 	var content string
-	var xunfeiResponse XunfeiChatResponse
+	var functionCall *XunfeiFunctionCall
 	stop := false
 	for !stop {
 		select {
-		case xunfeiResponse = <-dataChan:
-			if len(xunfeiResponse.Payload.Choices.Text) == 0 {
-				continue
+		case xunfeiResponse := <-dataChan:
+			for _, item := range xunfeiResponse.Payload.Choices.Text {
+				content += item.Content
+				if item.FunctionCall != nil {
+					functionCall = item.FunctionCall
+				}
+			}
+			if xunfeiResponse.Payload.Usage.Text.TotalTokens != 0 {
+				usage = xunfeiResponse.Payload.Usage.Text
 			}
-			content += xunfeiResponse.Payload.Choices.Text[0].Content
-			usage.PromptTokens += xunfeiResponse.Payload.Usage.Text.PromptTokens
-			usage.CompletionTokens += xunfeiResponse.Payload.Usage.Text.CompletionTokens
-			usage.TotalTokens += xunfeiResponse.Payload.Usage.Text.TotalTokens
 		case stop = <-stopChan:
+		case <-c.Request.Context().Done():
+			// the client is gone, what has been generated so far is still billed
+			stop = true
 		}
 	}
-	if len(xunfeiResponse.Payload.Choices.Text) == 0 {
-		xunfeiResponse.Payload.Choices.Text = []XunfeiChatResponseTextItem{
-			{
-				Content: "",
-			},
-		}
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = promptTokens
+		usage.CompletionTokens = countTokenText(content, textRequest.Model)
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	}
-	xunfeiResponse.Payload.Choices.Text[0].Content = content
-
-	response := responseXunfei2OpenAI(&xunfeiResponse)
+	response := responseXunfei2OpenAI(content, functionCall, textRequest.Tools != nil, usage)
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
 		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -249,64 +439,338 @@ func xunfeiHandler(c *gin.Context, textRequest GeneralOpenAIRequest, appId strin
 	return nil, &usage
 }
 
-func xunfeiMakeRequest(textRequest GeneralOpenAIRequest, domain, authUrl, appId string) (chan XunfeiChatResponse, chan bool, error) {
+// spark answers one request per round on a websocket, the connection is kept after the last frame
+// and reused by the later requests with the same key, the idle connections are pinged to keep them alive
+
+const xunfeiMaxIdleConns = 8
+const xunfeiIdleTimeout = 5 * time.Minute
+const xunfeiPingInterval = 30 * time.Second
+
+type xunfeiIdleConn struct {
+	conn      *websocket.Conn
+	idleSince time.Time
+}
+
+var xunfeiConnPool = map[string][]xunfeiIdleConn{}
+var xunfeiConnPoolLock sync.Mutex
+var xunfeiKeepAliveOnce sync.Once
+
+func getXunfeiIdleConn(key string) *websocket.Conn {
+	xunfeiConnPoolLock.Lock()
+	defer xunfeiConnPoolLock.Unlock()
+	conns := xunfeiConnPool[key]
+	for len(conns) > 0 {
+		idle := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if time.Since(idle.idleSince) < xunfeiIdleTimeout {
+			xunfeiConnPool[key] = conns
+			return idle.conn
+		}
+		_ = idle.conn.Close()
+	}
+	delete(xunfeiConnPool, key)
+	return nil
+}
+
+func putXunfeiIdleConn(key string, conn *websocket.Conn) {
+	xunfeiKeepAliveOnce.Do(func() {
+		go keepXunfeiIdleConnsAlive()
+	})
+	xunfeiConnPoolLock.Lock()
+	defer xunfeiConnPoolLock.Unlock()
+	if len(xunfeiConnPool[key]) >= xunfeiMaxIdleConns {
+		_ = conn.Close()
+		return
+	}
+	xunfeiConnPool[key] = append(xunfeiConnPool[key], xunfeiIdleConn{conn: conn, idleSince: time.Now()})
+}
+
+// keepXunfeiIdleConnsAlive takes the idle connections out of the pool while pinging them,
+// so that a slow connection does not block the requests
+func keepXunfeiIdleConnsAlive() {
+	for range time.Tick(xunfeiPingInterval) {
+		xunfeiConnPoolLock.Lock()
+		pool := xunfeiConnPool
+		xunfeiConnPool = map[string][]xunfeiIdleConn{}
+		xunfeiConnPoolLock.Unlock()
+		for key, conns := range pool {
+			for _, idle := range conns {
+				if time.Since(idle.idleSince) >= xunfeiIdleTimeout {
+					_ = idle.conn.Close()
+					continue
+				}
+				err := idle.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
+				if err != nil {
+					_ = idle.conn.Close()
+					continue
+				}
+				xunfeiConnPoolLock.Lock()
+				if len(xunfeiConnPool[key]) < xunfeiMaxIdleConns {
+					xunfeiConnPool[key] = append(xunfeiConnPool[key], idle)
+				} else {
+					_ = idle.conn.Close()
+				}
+				xunfeiConnPoolLock.Unlock()
+			}
+		}
+	}
+}
+
+func readXunfeiResponse(conn *websocket.Conn) (*XunfeiChatResponse, error) {
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var response XunfeiChatResponse
+	err = json.Unmarshal(msg, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func sendXunfeiRequest(conn *websocket.Conn, data *XunfeiChatRequest) (*XunfeiChatResponse, error) {
+	err := conn.WriteJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return readXunfeiResponse(conn)
+}
+
+// dialXunfei returns the handshake error of spark, e.g. an invalid signature, with its status code
+func dialXunfei(hostUrl string, apiKey string, apiSecret string) (*websocket.Conn, *OpenAIErrorWithStatusCode) {
 	d := websocket.Dialer{
 		HandshakeTimeout: 5 * time.Second,
 	}
-	conn, resp, err := d.Dial(authUrl, nil)
-	if err != nil || resp.StatusCode != 101 {
-		return nil, nil, err
-	}
-	data := requestOpenAI2Xunfei(textRequest, appId, domain)
-	err = conn.WriteJSON(data)
+	conn, resp, err := d.Dial(buildXunfeiAuthUrl(hostUrl, apiKey, apiSecret), nil)
 	if err != nil {
-		return nil, nil, err
+		if resp == nil {
+			return nil, errorWrapper(err, "dial_xunfei_failed", http.StatusInternalServerError)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		var handshakeError struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &handshakeError) == nil && handshakeError.Message != "" {
+			err = errors.New(handshakeError.Message)
+		}
+		return nil, errorWrapper(err, "dial_xunfei_failed", resp.StatusCode)
+	}
+	return conn, nil
+}
+
+func xunfeiMakeRequest(ctx context.Context, textRequest GeneralOpenAIRequest, version xunfeiVersion, appId string, apiSecret string, apiKey string) (chan XunfeiChatResponse, chan bool, *OpenAIErrorWithStatusCode) {
+	hostUrl := "wss://spark-api.xf-yun.com/" + version.Path
+	poolKey := strings.Join([]string{hostUrl, appId, apiKey}, "|")
+	data := requestOpenAI2Xunfei(textRequest, appId, version)
+
+	var response *XunfeiChatResponse
+	conn := getXunfeiIdleConn(poolKey)
+	if conn != nil {
+		var err error
+		response, err = sendXunfeiRequest(conn, data)
+		if err != nil {
+			// the idle connection has been closed by spark
+			_ = conn.Close()
+			conn = nil
+		}
+	}
+	if conn == nil {
+		var openAIErr *OpenAIErrorWithStatusCode
+		conn, openAIErr = dialXunfei(hostUrl, apiKey, apiSecret)
+		if openAIErr != nil {
+			return nil, nil, openAIErr
+		}
+		var err error
+		response, err = sendXunfeiRequest(conn, data)
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, errorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		}
+	}
+	if response.Header.Code != 0 {
+		_ = conn.Close()
+		return nil, nil, xunfeiErrorWrapper(response)
 	}
 
 	dataChan := make(chan XunfeiChatResponse)
 	stopChan := make(chan bool)
 	go func() {
 		for {
-			_, msg, err := conn.ReadMessage()
-			if err != nil {
-				common.SysError("error reading stream response: " + err.Error())
+			select {
+			case dataChan <- *response:
+			case <-ctx.Done():
+				// the client is gone, the rest of the answer is dropped with the connection
+				_ = conn.Close()
+				return
+			}
+			if response.Payload.Choices.Status == 2 {
+				putXunfeiIdleConn(poolKey, conn)
 				break
 			}
-			var response XunfeiChatResponse
-			err = json.Unmarshal(msg, &response)
+			var err error
+			response, err = readXunfeiResponse(conn)
 			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
+				common.SysError("error reading stream response: " + err.Error())
+				_ = conn.Close()
 				break
 			}
-			dataChan <- response
-			if response.Payload.Choices.Status == 2 {
-				err := conn.Close()
-				if err != nil {
-					common.SysError("error closing websocket connection: " + err.Error())
-				}
+			if response.Header.Code != 0 {
+				common.SysError("error in xunfei stream response: " + response.Header.Message)
+				_ = conn.Close()
 				break
 			}
 		}
-		stopChan <- true
+		select {
+		case stopChan <- true:
+		case <-ctx.Done():
+		}
 	}()
 
 	return dataChan, stopChan, nil
 }
 
-func getXunfeiAuthUrl(c *gin.Context, apiKey string, apiSecret string) (string, string) {
-	query := c.Request.URL.Query()
-	apiVersion := query.Get("api-version")
-	if apiVersion == "" {
-		apiVersion = c.GetString("api_version")
+// https://www.xfyun.cn/doc/spark/Embedding_api.html
+// the embedding API only accepts one text per request, so array input is sent one by one
+
+type XunfeiEmbeddingRequest struct {
+	Header struct {
+		AppId  string `json:"app_id"`
+		Status int    `json:"status"`
+	} `json:"header"`
+	Parameter struct {
+		Emb struct {
+			Domain  string `json:"domain"`
+			Feature struct {
+				Encoding string `json:"encoding"`
+			} `json:"feature"`
+		} `json:"emb"`
+	} `json:"parameter"`
+	Payload struct {
+		Messages struct {
+			Text string `json:"text"`
+		} `json:"messages"`
+	} `json:"payload"`
+}
+
+type XunfeiEmbeddingResponse struct {
+	Header struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Sid     string `json:"sid"`
+	} `json:"header"`
+	Payload struct {
+		Feature struct {
+			Text string `json:"text"`
+		} `json:"feature"`
+	} `json:"payload"`
+}
+
+func embeddingRequestOpenAI2Xunfei(input string, appId string) (*XunfeiEmbeddingRequest, error) {
+	messages, err := json.Marshal(map[string][]XunfeiMessage{
+		"messages": {
+			{
+				Role:    "user",
+				Content: input,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
-	if apiVersion == "" {
-		apiVersion = "v1.1"
-		common.SysLog("api_version not found, use default: " + apiVersion)
+	xunfeiRequest := XunfeiEmbeddingRequest{}
+	xunfeiRequest.Header.AppId = appId
+	xunfeiRequest.Header.Status = 3
+	xunfeiRequest.Parameter.Emb.Domain = "para"
+	xunfeiRequest.Parameter.Emb.Feature.Encoding = "utf8"
+	xunfeiRequest.Payload.Messages.Text = base64.StdEncoding.EncodeToString(messages)
+	return &xunfeiRequest, nil
+}
+
+// decodeXunfeiEmbedding decodes the base64 encoded little-endian float32 array
+func decodeXunfeiEmbedding(text string) ([]float64, error) {
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	embedding := make([]float64, 0, len(data)/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		embedding = append(embedding, float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i:i+4]))))
+	}
+	return embedding, nil
+}
+
+func xunfeiEmbeddingHandler(c *gin.Context, textRequest GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	fullTextResponse := OpenAIEmbeddingResponse{
+		Object: "list",
+		Model:  textRequest.Model,
+	}
+	for i, input := range textRequest.ParseInput() {
+		xunfeiRequest, err := embeddingRequestOpenAI2Xunfei(input, appId)
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError), nil
+		}
+		jsonData, err := json.Marshal(xunfeiRequest)
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError), nil
+		}
+		authUrl := buildXunfeiAuthUrlWithMethod(http.MethodPost, "https://emb-cn-huabei-1.xf-yun.com/", apiKey, apiSecret)
+		req, err := http.NewRequest(http.MethodPost, authUrl, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return errorWrapper(err, "new_request_failed", http.StatusInternalServerError), nil
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return errorWrapper(err, "do_request_failed", http.StatusInternalServerError), nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return relayErrorHandler(resp), nil
+		}
+		var xunfeiResponse XunfeiEmbeddingResponse
+		err = json.NewDecoder(resp.Body).Decode(&xunfeiResponse)
+		if err != nil {
+			return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		err = resp.Body.Close()
+		if err != nil {
+			return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		}
+		if xunfeiResponse.Header.Code != 0 {
+			return &OpenAIErrorWithStatusCode{
+				OpenAIError: OpenAIError{
+					Message: xunfeiResponse.Header.Message,
+					Type:    "xunfei_error",
+					Param:   xunfeiResponse.Header.Sid,
+					Code:    xunfeiResponse.Header.Code,
+				},
+				StatusCode: http.StatusInternalServerError,
+			}, nil
+		}
+		embedding, err := decodeXunfeiEmbedding(xunfeiResponse.Payload.Feature.Text)
+		if err != nil {
+			return errorWrapper(err, "decode_embedding_failed", http.StatusInternalServerError), nil
+		}
+		fullTextResponse.Data = append(fullTextResponse.Data, OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
 	}
-	domain := "general"
-	if apiVersion != "v1.1" {
-		domain += strings.Split(apiVersion, ".")[0]
+	// xunfei does not return usage for embeddings
+	promptTokens := countTokenInput(textRequest.Input, textRequest.Model)
+	fullTextResponse.Usage = Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
 	}
-	authUrl := buildXunfeiAuthUrl(fmt.Sprintf("wss://spark-api.xf-yun.com/%s/chat", apiVersion), apiKey, apiSecret)
-	return domain, authUrl
+	encodeEmbeddingResponse(&fullTextResponse, textRequest.EncodingFormat)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
 }
@@ -2,7 +2,9 @@ package controller
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"io"
@@ -299,3 +301,216 @@ func zhipuHandler(c *gin.Context, resp *http.Response) (*OpenAIErrorWithStatusCo
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &fullTextResponse.Usage
 }
+
+// https://open.bigmodel.cn/dev/api#text_embedding
+// the embedding API only accepts one text per request, so array input is sent one by one
+
+type ZhipuEmbeddingRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+type ZhipuEmbeddingResponse struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Success bool   `json:"success"`
+	Data    struct {
+		Embedding []float64 `json:"embedding"`
+		Usage     `json:"usage"`
+	} `json:"data"`
+}
+
+func zhipuEmbeddingHandler(c *gin.Context, textRequest GeneralOpenAIRequest, apiKey string) (*OpenAIErrorWithStatusCode, *Usage) {
+	fullRequestURL := fmt.Sprintf("https://open.bigmodel.cn/api/paas/v3/model-api/%s/invoke", textRequest.Model)
+	fullTextResponse := OpenAIEmbeddingResponse{
+		Object: "list",
+		Model:  textRequest.Model,
+	}
+	for i, input := range textRequest.ParseInput() {
+		jsonData, err := json.Marshal(ZhipuEmbeddingRequest{Prompt: input})
+		if err != nil {
+			return errorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError), nil
+		}
+		req, err := http.NewRequest(http.MethodPost, fullRequestURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return errorWrapper(err, "new_request_failed", http.StatusInternalServerError), nil
+		}
+		req.Header.Set("Authorization", getZhipuToken(apiKey))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return errorWrapper(err, "do_request_failed", http.StatusInternalServerError), nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return relayErrorHandler(resp), nil
+		}
+		var zhipuResponse ZhipuEmbeddingResponse
+		err = json.NewDecoder(resp.Body).Decode(&zhipuResponse)
+		if err != nil {
+			return errorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		err = resp.Body.Close()
+		if err != nil {
+			return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		}
+		if !zhipuResponse.Success {
+			return &OpenAIErrorWithStatusCode{
+				OpenAIError: OpenAIError{
+					Message: zhipuResponse.Msg,
+					Type:    "zhipu_error",
+					Param:   "",
+					Code:    zhipuResponse.Code,
+				},
+				StatusCode: resp.StatusCode,
+			}, nil
+		}
+		fullTextResponse.Data = append(fullTextResponse.Data, OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: zhipuResponse.Data.Embedding,
+		})
+		fullTextResponse.Usage.PromptTokens += zhipuResponse.Data.Usage.PromptTokens
+		fullTextResponse.Usage.TotalTokens += zhipuResponse.Data.Usage.TotalTokens
+	}
+	encodeEmbeddingResponse(&fullTextResponse, textRequest.EncodingFormat)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return errorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
+
+// https://open.bigmodel.cn/dev/api#glm-4v
+// glm-4v uses the openai compatible v4 api, but only accepts image urls or raw base64 data
+
+func visionRequestOpenAI2Zhipu(textRequest VisionOpenAIRequest) (*VisionOpenAIRequest, error) {
+	zhipuRequest := textRequest
+	zhipuRequest.Messages = make([]VisionMessage, 0, len(textRequest.Messages))
+	for _, message := range textRequest.Messages {
+		contents := message.ParseContent()
+		for i := range contents {
+			url := contents[i].ImageURL.URL
+			if strings.HasPrefix(url, "data:image/") {
+				if i := strings.Index(url, ","); i >= 0 {
+					url = url[i+1:]
+				}
+				contents[i].ImageURL.URL = url
+			}
+		}
+		content, err := json.Marshal(contents)
+		if err != nil {
+			return nil, err
+		}
+		message.Content = content
+		zhipuRequest.Messages = append(zhipuRequest.Messages, message)
+	}
+	return &zhipuRequest, nil
+}
+
+// https://open.bigmodel.cn/dev/api#glm-4
+// the v4 api is compatible with OpenAI, it supports tools including web_search and returns the real usage,
+// it is used when the version of the channel is set to v4
+
+type ZhipuV4Request struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	TopP        float64   `json:"top_p,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Tools       any       `json:"tools,omitempty"`
+	ToolChoice  any       `json:"tool_choice,omitempty"`
+	UserId      string    `json:"user_id,omitempty"`
+}
+
+func isZhipuV4(c *gin.Context) bool {
+	return c.GetString("api_version") == "v4"
+}
+
+// temperature and top_p of the v4 api must be in the open interval (0, 1)
+func clampZhipuV4Param(value float64) float64 {
+	if value >= 1 {
+		return 0.99
+	}
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+func requestOpenAI2ZhipuV4(request GeneralOpenAIRequest) *ZhipuV4Request {
+	return &ZhipuV4Request{
+		Model:       request.Model,
+		Messages:    request.Messages,
+		Stream:      request.Stream,
+		Temperature: clampZhipuV4Param(request.Temperature),
+		TopP:        clampZhipuV4Param(request.TopP),
+		MaxTokens:   request.MaxTokens,
+		Tools:       request.Tools,
+		ToolChoice:  request.ToolChoice,
+		UserId:      request.User,
+	}
+}
+
+// zhipuV4StreamHandler forwards the OpenAI style chunks, the usage is carried by the last chunk
+func zhipuV4StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*OpenAIErrorWithStatusCode, *Usage) {
+	var usage *Usage
+	responseText := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	dataChan := make(chan string)
+	stopChan := make(chan bool)
+	go func() {
+		for scanner.Scan() {
+			data := strings.TrimSuffix(scanner.Text(), "\r")
+			if !strings.HasPrefix(data, "data:") {
+				continue
+			}
+			data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+			if data != "[DONE]" {
+				var streamResponse struct {
+					ChatCompletionsStreamResponse
+					Usage *Usage `json:"usage,omitempty"`
+				}
+				err := json.Unmarshal([]byte(data), &streamResponse)
+				if err != nil {
+					common.SysError("error unmarshalling stream response: " + err.Error())
+					continue
+				}
+				for _, choice := range streamResponse.Choices {
+					responseText += choice.Delta.Content
+				}
+				if streamResponse.Usage != nil {
+					usage = streamResponse.Usage
+				}
+			}
+			dataChan <- data
+		}
+		stopChan <- true
+	}()
+	setEventStreamHeaders(c)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case data := <-dataChan:
+			c.Render(-1, common.CustomEvent{Data: "data: " + data})
+			return true
+		case <-stopChan:
+			return false
+		}
+	})
+	err := resp.Body.Close()
+	if err != nil {
+		return errorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if usage == nil {
+		completionTokens := countTokenText(responseText, model)
+		usage = &Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+	}
+	return nil, usage
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"one-api/common"
@@ -14,9 +16,63 @@ import (
 )
 
 type Message struct {
-	Role    string  `json:"role"`
-	Content string  `json:"content"`
-	Name    *string `json:"name,omitempty"`
+	Role         string  `json:"role"`
+	Content      string  `json:"content"`
+	Name         *string `json:"name,omitempty"`
+	ToolCalls    any     `json:"tool_calls,omitempty"`
+	ToolCallId   string  `json:"tool_call_id,omitempty"`
+	FunctionCall any     `json:"function_call,omitempty"`
+}
+
+// UnmarshalJSON accepts both string content and the array form of text-only content,
+// the text parts of an array are joined, requests with images go to the vision relay
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	v := struct {
+		*message
+		Content json.RawMessage `json:"content"`
+	}{message: (*message)(m)}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	m.Content = ""
+	content := bytes.TrimSpace(v.Content)
+	if len(content) == 0 || string(content) == "null" {
+		return nil
+	}
+	if content[0] != '[' {
+		return json.Unmarshal(content, &m.Content)
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	err = json.Unmarshal(content, &parts)
+	if err != nil {
+		return err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return errors.New("only text content is supported by this channel")
+		}
+		texts = append(texts, part.Text)
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ToolCall struct {
+	Index    int          `json:"index"`
+	Id       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
 }
 
 type VisionContent struct {
@@ -46,6 +102,7 @@ const (
 	RelayModeAudioSpeech
 	RelayModeAudioTranscription
 	RelayModeAudioTranslation
+	RelayModeRerank
 )
 
 // https://platform.openai.com/docs/api-reference/chat
@@ -74,6 +131,10 @@ type GeneralOpenAIRequest struct {
 	Tools            any             `json:"tools,omitempty"`
 	ToolChoice       any             `json:"tool_choice,omitempty"`
 	User             string          `json:"user,omitempty"`
+	EncodingFormat   string          `json:"encoding_format,omitempty"`
+	Dimensions       int             `json:"dimensions,omitempty"`
+	InputType        string          `json:"input_type,omitempty"`
+	TopK             int             `json:"top_k,omitempty"`
 }
 
 type VisionOpenAIRequest struct {
@@ -114,6 +175,7 @@ type ChatRequest struct {
 	Model     string    `json:"model"`
 	Messages  []Message `json:"messages"`
 	MaxTokens int       `json:"max_tokens"`
+	Stream    bool      `json:"stream,omitempty"`
 }
 
 type TextRequest struct {
@@ -170,9 +232,21 @@ type TextToSpeechRequest struct {
 }
 
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+func (usage *Usage) GetCachedTokens() int {
+	if usage.PromptTokensDetails == nil {
+		return 0
+	}
+	return usage.PromptTokensDetails.CachedTokens
 }
 
 type OpenAIError struct {
@@ -208,9 +282,9 @@ type OpenAITextResponse struct {
 }
 
 type OpenAIEmbeddingResponseItem struct {
-	Object    string    `json:"object"`
-	Index     int       `json:"index"`
-	Embedding []float64 `json:"embedding"`
+	Object    string `json:"object"`
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"` // []float64, or a base64 string if encoding_format is base64
 }
 
 type OpenAIEmbeddingResponse struct {
@@ -220,6 +294,48 @@ type OpenAIEmbeddingResponse struct {
 	Usage  `json:"usage"`
 }
 
+// RerankRequest follows the Cohere/Jina rerank API, documents may be plain strings or {"text": "..."} objects
+// https://docs.cohere.com/reference/rerank
+type RerankRequest struct {
+	Model           string `json:"model"`
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	TopN            int    `json:"top_n,omitempty"`
+	ReturnDocuments *bool  `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int    `json:"max_chunks_per_doc,omitempty"`
+}
+
+func (r RerankRequest) ParseDocuments() []string {
+	documents := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		switch document.(type) {
+		case string:
+			documents = append(documents, document.(string))
+		case map[string]any:
+			text, _ := document.(map[string]any)["text"].(string)
+			documents = append(documents, text)
+		}
+	}
+	return documents
+}
+
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   Usage          `json:"usage"`
+}
+
 type ImageResponse struct {
 	Created int `json:"created"`
 	Data    []struct {
@@ -229,7 +345,9 @@ type ImageResponse struct {
 
 type ChatCompletionsStreamResponseChoice struct {
 	Delta struct {
-		Content string `json:"content"`
+		Content      string `json:"content"`
+		ToolCalls    any    `json:"tool_calls,omitempty"`
+		FunctionCall any    `json:"function_call,omitempty"`
 	} `json:"delta"`
 	FinishReason *string `json:"finish_reason,omitempty"`
 }
@@ -259,6 +377,8 @@ func Relay(c *gin.Context) {
 		relayMode = RelayModeEmbeddings
 	} else if strings.HasSuffix(c.Request.URL.Path, "embeddings") {
 		relayMode = RelayModeEmbeddings
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/rerank") {
+		relayMode = RelayModeRerank
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		relayMode = RelayModeModerations
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
@@ -282,8 +402,10 @@ func Relay(c *gin.Context) {
 		fallthrough
 	case RelayModeAudioTranscription:
 		err = relayAudioHelper(c, relayMode)
+	case RelayModeRerank:
+		err = relayRerankHelper(c, relayMode)
 	default:
-		if common.UnmarshalBodyIsVersionModel(c) {
+		if isVisionRequest(c) {
 			err = relayVisionHelper(c, relayMode)
 		} else {
 			err = relayTextHelper(c, relayMode)
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
@@ -332,7 +333,17 @@ func GetSelf(c *gin.Context) {
 
 func UpdateUser(c *gin.Context) {
 	var updatedUser model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&updatedUser)
+	// the quota is only changed if it is provided, so it can be set to 0
+	var quotaField struct {
+		Quota *int `json:"quota"`
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &updatedUser)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &quotaField)
+	}
 	if err != nil || updatedUser.Id == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -384,7 +395,15 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
-	if originUser.Quota != updatedUser.Quota {
+	if quotaField.Quota != nil && originUser.Quota != updatedUser.Quota {
+		err = model.SetUserQuota(originUser.Id, updatedUser.Quota, model.LedgerReasonAdminAdjust, fmt.Sprintf("user:%d", c.GetInt("id")))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -441,6 +460,48 @@ func UpdateSelf(c *gin.Context) {
 	return
 }
 
+func UpdateSelfNotifySetting(c *gin.Context) {
+	var user model.User
+	err := json.NewDecoder(c.Request.Body).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	// make sure the notifier can be built before saving it
+	_, err = common.GetUserNotifier(user.NotifyChannel, user.NotifyTarget, user.NotifySecret, "")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanUser := model.User{
+		Id:            c.GetInt("id"),
+		NotifyChannel: user.NotifyChannel,
+		NotifyTarget:  user.NotifyTarget,
+		NotifySecret:  user.NotifySecret,
+	}
+	if cleanUser.NotifyChannel == "" {
+		cleanUser.NotifyChannel = common.NotifierEmail
+	}
+	if err := cleanUser.UpdateNotifySetting(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
 func DeleteUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
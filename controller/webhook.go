@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const webhookMaxAttempts = 10
+const webhookMaxRetryDelay = 6 * 3600 // in seconds
+
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// getWebhookRetryDelay backs off exponentially: 10s, 20s, 40s ... up to 6 hours
+func getWebhookRetryDelay(attempts int) int64 {
+	delay := int64(10)
+	for i := 1; i < attempts && delay < webhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxRetryDelay {
+		delay = webhookMaxRetryDelay
+	}
+	return delay
+}
+
+// sendWebhook posts the payload, the signature is the hex encoded HMAC-SHA256 of "timestamp.body"
+func sendWebhook(subscription *model.WebhookSubscription, delivery *model.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(common.GetTimestamp(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-One-API-Event", delivery.Event)
+	req.Header.Set("X-One-API-Delivery", strconv.Itoa(delivery.Id))
+	req.Header.Set("X-One-API-Timestamp", timestamp)
+	if subscription.Secret != "" {
+		req.Header.Set("X-One-API-Signature", common.HmacSHA256Hex(subscription.Secret, []byte(timestamp+"."+delivery.Payload)))
+	}
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status code: %d, body: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func deliverWebhook(delivery *model.WebhookDelivery) {
+	subscription, err := model.GetWebhookSubscriptionById(delivery.SubscriptionId)
+	if err == nil && subscription.Status != common.WebhookStatusEnabled {
+		err = errors.New("subscription is disabled")
+	}
+	if err == nil {
+		err = sendWebhook(subscription, delivery)
+	}
+	now := common.GetTimestamp()
+	delivery.Attempts++
+	if err == nil {
+		delivery.Status = model.WebhookDeliveryStatusSucceeded
+		delivery.DeliveredTime = now
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = common.TruncateString(err.Error(), 1024)
+		if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = model.WebhookDeliveryStatusFailed
+		} else {
+			delivery.NextAttemptTime = now + getWebhookRetryDelay(delivery.Attempts)
+		}
+	}
+	err = delivery.SelectUpdate()
+	if err != nil {
+		common.SysError("failed to update webhook delivery: " + err.Error())
+	}
+}
+
+// AutomaticallyDeliverWebhooks sends the pending deliveries in the outbox
+func AutomaticallyDeliverWebhooks(frequency int) {
+	for {
+		deliveries, err := model.GetDueWebhookDeliveries(100)
+		if err != nil {
+			common.SysError("failed to get webhook deliveries: " + err.Error())
+		}
+		for _, delivery := range deliveries {
+			deliverWebhook(delivery)
+		}
+		if len(deliveries) < 100 {
+			time.Sleep(time.Duration(frequency) * time.Second)
+		}
+	}
+}
+
+func validateWebhookSubscription(subscription *model.WebhookSubscription) error {
+	if !strings.HasPrefix(subscription.URL, "http://") && !strings.HasPrefix(subscription.URL, "https://") {
+		return errors.New("无效的 Webhook 地址")
+	}
+	if subscription.Events == "" {
+		return errors.New("请至少订阅一个事件")
+	}
+	for _, event := range strings.Split(subscription.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event == "*" {
+			continue
+		}
+		known := false
+		for _, e := range model.WebhookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("未知的事件：%s", event)
+		}
+	}
+	if subscription.SampleRate <= 0 || subscription.SampleRate > 1 {
+		subscription.SampleRate = 1
+	}
+	return nil
+}
+
+func GetAllWebhookSubscriptions(c *gin.Context) {
+	subscriptions, err := model.GetAllWebhookSubscriptions()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscriptions,
+		"events":  model.WebhookEvents,
+	})
+	return
+}
+
+func AddWebhookSubscription(c *gin.Context) {
+	subscription := model.WebhookSubscription{}
+	err := c.ShouldBindJSON(&subscription)
+	if err == nil {
+		err = validateWebhookSubscription(&subscription)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	subscription.Id = 0
+	subscription.CreatedTime = common.GetTimestamp()
+	if subscription.Status == 0 {
+		subscription.Status = common.WebhookStatusEnabled
+	}
+	err = subscription.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscription,
+	})
+	return
+}
+
+func UpdateWebhookSubscription(c *gin.Context) {
+	subscription := model.WebhookSubscription{}
+	err := c.ShouldBindJSON(&subscription)
+	if err == nil {
+		err = validateWebhookSubscription(&subscription)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = subscription.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscription,
+	})
+	return
+}
+
+func DeleteWebhookSubscription(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteWebhookSubscriptionById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	subscriptionId, _ := strconv.Atoi(c.Query("subscription_id"))
+	deliveries, err := model.GetWebhookDeliveries(subscriptionId, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    deliveries,
+	})
+	return
+}
+
+func RetryWebhookDelivery(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.RetryWebhookDeliveryById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
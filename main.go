@@ -22,6 +22,7 @@ var buildFS embed.FS
 var indexPage []byte
 
 func main() {
+	common.Init()
 	common.SetupLogger()
 	common.SysLog("One API " + common.Version + " started")
 	if os.Getenv("GIN_MODE") != "debug" {
@@ -30,6 +31,9 @@ func main() {
 	if common.DebugEnabled {
 		common.SysLog("running in debug mode")
 	}
+	if common.PaymentFakeEnabled {
+		common.SysError("PAYMENT_FAKE_ENABLED is set, admins can top up any amount without paying, never enable it in production")
+	}
 	// Initialize SQL Database
 	err := model.InitDB()
 	if err != nil {
@@ -41,6 +45,12 @@ func main() {
 			common.FatalLog("failed to close database: " + err.Error())
 		}
 	}()
+	if *common.Reconcile {
+		if !model.RunQuotaLedgerReconciliation(*common.ReconcileFix) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize Redis
 	err = common.InitRedisClient()
@@ -59,10 +69,18 @@ func main() {
 		common.SysError(fmt.Sprintf("sync frequency: %d seconds", common.SyncFrequency))
 		model.InitChannelCache()
 	}
+	model.InitWebhookSubscriptionCache()
+	// subscriptions are always cached, so the cache must be synced even without memory cache,
+	// otherwise the other nodes never see the subscriptions added on the master node
+	go model.SyncWebhookSubscriptionCache(common.SyncFrequency)
 	if common.MemoryCacheEnabled {
 		go model.SyncOptions(common.SyncFrequency)
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
+	if common.IsMasterNode {
+		go controller.AutomaticallyDeliverWebhooks(5)
+		go controller.AutomaticallyRefreshUserPlans(60)
+	}
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
 		if err != nil {
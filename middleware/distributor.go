@@ -20,6 +20,15 @@ func Distribute() func(c *gin.Context) {
 		userId := c.GetInt("id")
 		userGroup, _ := model.CacheGetUserGroup(userId)
 		c.Set("group", userGroup)
+		plan, err := model.CacheGetActivePlanOfUser(userId)
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if plan != nil && !plan.AllowsGroup(userGroup) {
+			abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("当前套餐不支持分组 %s", userGroup))
+			return
+		}
 		var channel *model.Channel
 		channelId, ok := c.Get("channelId")
 		if ok {
@@ -65,6 +74,10 @@ func Distribute() func(c *gin.Context) {
 					modelRequest.Model = "whisper-1"
 				}
 			}
+			if plan != nil && !plan.AllowsModel(modelRequest.Model) {
+				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("当前套餐不支持模型 %s", modelRequest.Model))
+				return
+			}
 			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model)
 			if err != nil {
 				message := fmt.Sprintf("No available service nodes for model %s", modelRequest.Model)
@@ -76,24 +89,35 @@ func Distribute() func(c *gin.Context) {
 				return
 			}
 		}
-		c.Set("channel", channel.Type)
-		c.Set("channel_id", channel.Id)
-		c.Set("channel_name", channel.Name)
-		c.Set("model_mapping", channel.GetModelMapping())
-		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
-		c.Set("base_url", channel.GetBaseURL())
-		switch channel.Type {
-		case common.ChannelTypeAzure:
-			c.Set("api_version", channel.Other)
-		case common.ChannelTypeXunfei:
-			c.Set("api_version", channel.Other)
-		case common.ChannelTypeGemini:
-			c.Set("api_version", channel.Other)
-		case common.ChannelTypeAIProxyLibrary:
-			c.Set("library_id", channel.Other)
-		case common.ChannelTypeAli:
-			c.Set("plugin", channel.Other)
-		}
+		SetupContextForSelectedChannel(c, channel)
 		c.Next()
 	}
 }
+
+// SetupContextForSelectedChannel sets the channel info used by the relay, it is also used by the channel test
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel) {
+	c.Set("channel", channel.Type)
+	c.Set("channel_id", channel.Id)
+	c.Set("channel_name", channel.Name)
+	c.Set("model_mapping", channel.GetModelMapping())
+	c.Set("cost_ratio", channel.GetCostRatio())
+	c.Set("cost_prices", channel.GetCostPrices())
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Set("base_url", channel.GetBaseURL())
+	switch channel.Type {
+	case common.ChannelTypeAzure:
+		c.Set("api_version", channel.Other)
+	case common.ChannelTypeXunfei:
+		c.Set("api_version", channel.Other)
+	case common.ChannelTypeGemini:
+		c.Set("api_version", channel.Other)
+	case common.ChannelTypeZhipu:
+		c.Set("api_version", channel.Other)
+	case common.ChannelTypeAIProxyLibrary:
+		c.Set("library_id", channel.Other)
+	case common.ChannelTypeAli:
+		c.Set("plugin", channel.Other)
+	case common.ChannelTypeVertexAI, common.ChannelTypeTencent:
+		c.Set("region", channel.Other)
+	}
+}
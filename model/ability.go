@@ -1,6 +1,8 @@
 package model
 
 import (
+	"errors"
+	"gorm.io/gorm"
 	"one-api/common"
 	"strings"
 )
@@ -24,12 +26,26 @@ func GetRandomSatisfiedChannel(group string, model string) (*Channel, error) {
 	}
 
 	var err error = nil
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-	channelQuery := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
+	// channels predicted to run out of balance are only used when there is no other choice
+	deadline := common.GetTimestamp() + int64(common.ChannelExhaustionWarningHours*3600)
+	runningDryChannels := DB.Model(&Channel{}).Select("id").Where("exhaustion_time > 0 and exhaustion_time < ?", deadline)
+	for _, skipRunningDry := range []bool{true, false} {
+		condition := groupCol + " = ? and model = ? and enabled = " + trueVal
+		args := []any{group, model}
+		if skipRunningDry {
+			condition += " and channel_id not in (?)"
+			args = append(args, runningDryChannels)
+		}
+		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(condition, args...)
+		channelQuery := DB.Where(condition+" and priority = (?)", append(args, maxPrioritySubQuery)...)
+		if common.UsingSQLite || common.UsingPostgreSQL {
+			err = channelQuery.Order("RANDOM()").First(&ability).Error
+		} else {
+			err = channelQuery.Order("RAND()").First(&ability).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
 	}
 	if err != nil {
 		return nil, err
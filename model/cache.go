@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -72,13 +73,15 @@ func CacheGetUserQuota(id int) (quota int, err error) {
 	if !common.RedisEnabled {
 		return GetUserQuota(id)
 	}
-	quotaString, err := common.RedisGet(fmt.Sprintf("user_quota:%d", id))
+	keys := getUserQuotaCacheKeys(id)
+	quotaString, err := common.RedisGet(keys[0])
 	if err != nil {
-		quota, err = GetUserQuota(id)
+		var version string
+		quota, version, err = loadUserQuotaCache(id)
 		if err != nil {
 			return 0, err
 		}
-		err = common.RedisSet(fmt.Sprintf("user_quota:%d", id), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
+		err = loadUserQuotaScript.Run(context.Background(), common.RDB, keys, quota, version, UserId2QuotaCacheSeconds).Err()
 		if err != nil {
 			common.SysError("Redis set user quota error: " + err.Error())
 		}
@@ -88,24 +91,22 @@ func CacheGetUserQuota(id int) (quota int, err error) {
 	return quota, err
 }
 
+// CacheUpdateUserQuota must be called after the quota is changed in the database, the
+// cached quota is deleted rather than overwritten, see reservation.go
 func CacheUpdateUserQuota(id int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
-	quota, err := GetUserQuota(id)
-	if err != nil {
-		return err
-	}
-	err = common.RedisSet(fmt.Sprintf("user_quota:%d", id), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
-	return err
+	return invalidateUserQuotaCache(id, "")
 }
 
-func CacheDecreaseUserQuota(id int, quota int) error {
+// CacheUpdateTokenQuota must be called after the remaining quota of a token is changed in
+// the database outside of a reservation
+func CacheUpdateTokenQuota(id int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
-	err := common.RedisDecrease(fmt.Sprintf("user_quota:%d", id), int64(quota))
-	return err
+	return invalidateTokenQuotaCache(id, "")
 }
 
 func CacheIsUserEnabled(userId int) (bool, error) {
@@ -199,6 +200,16 @@ func CacheGetRandomSatisfiedChannel(group string, model string) (*Channel, error
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
+	// channels predicted to run out of balance are only used when there is no other choice
+	var candidates []*Channel
+	for _, channel := range channels {
+		if !channel.IsRunningDry() {
+			candidates = append(candidates, channel)
+		}
+	}
+	if len(candidates) > 0 {
+		channels = candidates
+	}
 	endIdx := len(channels)
 	// choose by priority
 	firstChannel := channels[0]
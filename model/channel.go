@@ -6,24 +6,35 @@ import (
 )
 
 type Channel struct {
-	Id                 int     `json:"id"`
-	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null;index"`
-	Status             int     `json:"status" gorm:"default:1"`
-	Name               string  `json:"name" gorm:"index"`
-	Weight             *uint   `json:"weight" gorm:"default:0"`
-	CreatedTime        int64   `json:"created_time" gorm:"bigint"`
-	TestTime           int64   `json:"test_time" gorm:"bigint"`
-	ResponseTime       int     `json:"response_time"` // in milliseconds
-	BaseURL            *string `json:"base_url" gorm:"column:base_url;default:''"`
-	Other              string  `json:"other"`
-	Balance            float64 `json:"balance"` // in USD
-	BalanceUpdatedTime int64   `json:"balance_updated_time" gorm:"bigint"`
-	Models             string  `json:"models"`
-	Group              string  `json:"group" gorm:"type:varchar(32);default:'default'"`
-	UsedQuota          int64   `json:"used_quota" gorm:"bigint;default:0"`
-	ModelMapping       *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
-	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
+	Id                  int      `json:"id"`
+	Type                int      `json:"type" gorm:"default:0"`
+	Key                 string   `json:"key" gorm:"not null;index"`
+	Status              int      `json:"status" gorm:"default:1"`
+	Name                string   `json:"name" gorm:"index"`
+	Weight              *uint    `json:"weight" gorm:"default:0"`
+	CreatedTime         int64    `json:"created_time" gorm:"bigint"`
+	TestTime            int64    `json:"test_time" gorm:"bigint"`
+	ResponseTime        int      `json:"response_time"`    // in milliseconds
+	FirstTokenTime      int      `json:"first_token_time"` // in milliseconds
+	TestError           string   `json:"test_error" gorm:"type:varchar(1024);default:''"`
+	TestModel           *string  `json:"test_model" gorm:"type:varchar(64);default:''"`
+	BaseURL             *string  `json:"base_url" gorm:"column:base_url;default:''"`
+	Other               string   `json:"other"`
+	Balance             float64  `json:"balance"` // in USD
+	BalanceUpdatedTime  int64    `json:"balance_updated_time" gorm:"bigint"`
+	BalanceThreshold    *float64 `json:"balance_threshold" gorm:"default:0"` // send an alert when the balance is below it
+	BurnRate            float64  `json:"burn_rate"`                          // balance consumed per hour
+	BurnRateUsedQuota   int64    `json:"burn_rate_used_quota" gorm:"bigint;default:0"`
+	BurnRateUpdatedTime int64    `json:"burn_rate_updated_time" gorm:"bigint"`
+	ExhaustionTime      int64    `json:"exhaustion_time" gorm:"bigint"` // predicted time when the balance runs out, 0 means unknown
+	BalanceAlertTime    int64    `json:"balance_alert_time" gorm:"bigint"`
+	Models              string   `json:"models"`
+	Group               string   `json:"group" gorm:"type:varchar(32);default:'default'"`
+	UsedQuota           int64    `json:"used_quota" gorm:"bigint;default:0"`
+	ModelMapping        *string  `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
+	Priority            *int64   `json:"priority" gorm:"bigint;default:0"`
+	CostRatio           *float64 `json:"cost_ratio" gorm:"default:1"`  // the upstream price relative to the price of the model
+	CostPrices          *string  `json:"cost_prices" gorm:"type:text"` // the upstream prices of models, in the format of ModelPrices
 }
 
 func GetAllChannels(startIdx int, num int, selectAll bool) ([]*Channel, error) {
@@ -79,6 +90,21 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+func (channel *Channel) GetBalanceThreshold() float64 {
+	if channel.BalanceThreshold == nil {
+		return 0
+	}
+	return *channel.BalanceThreshold
+}
+
+// IsRunningDry reports whether the balance of the channel is predicted to run out soon
+func (channel *Channel) IsRunningDry() bool {
+	if channel.ExhaustionTime == 0 {
+		return false
+	}
+	return channel.ExhaustionTime-common.GetTimestamp() < int64(common.ChannelExhaustionWarningHours*3600)
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -86,6 +112,20 @@ func (channel *Channel) GetBaseURL() string {
 	return *channel.BaseURL
 }
 
+func (channel *Channel) GetCostRatio() float64 {
+	if channel.CostRatio == nil {
+		return 1
+	}
+	return *channel.CostRatio
+}
+
+func (channel *Channel) GetCostPrices() string {
+	if channel.CostPrices == nil {
+		return ""
+	}
+	return *channel.CostPrices
+}
+
 func (channel *Channel) GetModelMapping() string {
 	if channel.ModelMapping == nil {
 		return ""
@@ -105,7 +145,25 @@ func (channel *Channel) Insert() error {
 
 func (channel *Channel) Update() error {
 	var err error
-	err = DB.Model(channel).Updates(channel).Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var oldStatus int
+		err := tx.Model(&Channel{}).Where("id = ?", channel.Id).Select("status").Scan(&oldStatus).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(channel).Updates(channel).Error
+		if err != nil {
+			return err
+		}
+		// the status is only updated if it is set, see Updates
+		if channel.Status == 0 || channel.Status == oldStatus {
+			return nil
+		}
+		return PublishWebhookEvent(tx, WebhookEventChannelStatusChange, map[string]any{
+			"id":     channel.Id,
+			"status": channel.Status,
+		})
+	})
 	if err != nil {
 		return err
 	}
@@ -114,13 +172,23 @@ func (channel *Channel) Update() error {
 	return err
 }
 
-func (channel *Channel) UpdateResponseTime(responseTime int64) {
-	err := DB.Model(channel).Select("response_time", "test_time").Updates(Channel{
-		TestTime:     common.GetTimestamp(),
-		ResponseTime: int(responseTime),
+func (channel *Channel) GetTestModel() string {
+	if channel.TestModel == nil {
+		return ""
+	}
+	return *channel.TestModel
+}
+
+func (channel *Channel) UpdateTestResult(responseTime int64, firstTokenTime int64, testError string) {
+	testError = common.TruncateString(testError, 1024)
+	err := DB.Model(channel).Select("response_time", "first_token_time", "test_error", "test_time").Updates(Channel{
+		TestTime:       common.GetTimestamp(),
+		ResponseTime:   int(responseTime),
+		FirstTokenTime: int(firstTokenTime),
+		TestError:      testError,
 	}).Error
 	if err != nil {
-		common.SysError("failed to update response time: " + err.Error())
+		common.SysError("failed to update test result: " + err.Error())
 	}
 }
 
@@ -134,6 +202,19 @@ func (channel *Channel) UpdateBalance(balance float64) {
 	}
 }
 
+func (channel *Channel) UpdateBalanceForecast() {
+	err := DB.Model(channel).Select("burn_rate", "burn_rate_used_quota", "burn_rate_updated_time", "exhaustion_time", "balance_alert_time").Updates(Channel{
+		BurnRate:            channel.BurnRate,
+		BurnRateUsedQuota:   channel.BurnRateUsedQuota,
+		BurnRateUpdatedTime: channel.BurnRateUpdatedTime,
+		ExhaustionTime:      channel.ExhaustionTime,
+		BalanceAlertTime:    channel.BalanceAlertTime,
+	}).Error
+	if err != nil {
+		common.SysError("failed to update balance forecast: " + err.Error())
+	}
+}
+
 func (channel *Channel) Delete() error {
 	var err error
 	err = DB.Delete(channel).Error
@@ -149,7 +230,16 @@ func UpdateChannelStatusById(id int, status int) {
 	if err != nil {
 		common.SysError("failed to update ability status: " + err.Error())
 	}
-	err = DB.Model(&Channel{}).Where("id = ?", id).Update("status", status).Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Channel{}).Where("id = ?", id).Update("status", status).Error
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventChannelStatusChange, map[string]any{
+			"id":     id,
+			"status": status,
+		})
+	})
 	if err != nil {
 		common.SysError("failed to update channel status: " + err.Error())
 	}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"one-api/common"
+)
+
+// the reason of a ledger entry is also the counter account of the change
+const (
+	LedgerReasonOpening       = "opening" // the balances before the ledger was introduced
+	LedgerReasonRegister      = "register"
+	LedgerReasonInviteeBonus  = "invitee_bonus"
+	LedgerReasonInviterBonus  = "inviter_bonus"
+	LedgerReasonRedemption    = "redemption"
+	LedgerReasonPayment       = "payment"
+	LedgerReasonPlan          = "plan"
+	LedgerReasonAdminAdjust   = "admin_adjust"
+	LedgerReasonPreConsume    = "pre_consume"
+	LedgerReasonConsume       = "consume"
+	LedgerReasonBatchUpdate   = "batch_update" // changes aggregated by the batch updater
+	LedgerReasonReconcileDiff = "reconcile_diff"
+)
+
+// QuotaLedgerEntry is an immutable record of a change of User.Quota, it is written in
+// the same transaction as the change, so the sum of the deltas of a user is the quota
+type QuotaLedgerEntry struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index:idx_user_id_created_time,priority:1"`
+	Delta        int    `json:"delta"`
+	BalanceAfter int    `json:"balance_after"`
+	Reason       string `json:"reason" gorm:"type:varchar(32)"`
+	ReferenceId  string `json:"reference_id" gorm:"type:varchar(64);default:''"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint;index:idx_user_id_created_time,priority:2"`
+}
+
+// initQuotaLedger records the existing balances as opening entries, it runs once
+// when the ledger table is created
+func initQuotaLedger(db *gorm.DB) error {
+	return db.Exec("INSERT INTO quota_ledger_entries (user_id, delta, balance_after, reason, reference_id, created_time) SELECT id, quota, quota, ?, '', ? FROM users WHERE quota <> 0",
+		LedgerReasonOpening, common.GetTimestamp()).Error
+}
+
+// changeUserQuota adds delta to the quota of the user and records the ledger entry, tx must be a transaction
+func changeUserQuota(tx *gorm.DB, userId int, delta int, reason string, referenceId string) error {
+	result := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %d not found", userId)
+	}
+	var balance int
+	err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&balance).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&QuotaLedgerEntry{
+		UserId:       userId,
+		Delta:        delta,
+		BalanceAfter: balance,
+		Reason:       reason,
+		ReferenceId:  referenceId,
+		CreatedTime:  common.GetTimestamp(),
+	}).Error
+}
+
+// setUserQuota sets the quota of the user and records the difference, tx must be a transaction
+func setUserQuota(tx *gorm.DB, userId int, quota int, reason string, referenceId string) error {
+	user := User{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota").First(&user, "id = ?", userId).Error
+	if err != nil {
+		return err
+	}
+	if user.Quota == quota {
+		return nil
+	}
+	return changeUserQuota(tx, userId, quota-user.Quota, reason, referenceId)
+}
+
+func ChangeUserQuota(userId int, delta int, reason string, referenceId string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return changeUserQuota(tx, userId, delta, reason, referenceId)
+	})
+	if err != nil {
+		return err
+	}
+	return CacheUpdateUserQuota(userId)
+}
+
+func SetUserQuota(userId int, quota int, reason string, referenceId string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return setUserQuota(tx, userId, quota, reason, referenceId)
+	})
+	if err != nil {
+		return err
+	}
+	return CacheUpdateUserQuota(userId)
+}
+
+func GetQuotaLedgerEntries(userId int, startTimestamp int64, endTimestamp int64, startIdx int, num int) (entries []*QuotaLedgerEntry, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_time >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_time <= ?", endTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, err
+}
+
+// GetQuotaBalanceAt returns the balance of the user after the last entry before the timestamp
+func GetQuotaBalanceAt(userId int, timestamp int64) (balance int, err error) {
+	var entries []*QuotaLedgerEntry
+	err = DB.Where("user_id = ? and created_time <= ?", userId, timestamp).Order("id desc").Limit(1).Find(&entries).Error
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	return entries[0].BalanceAfter, nil
+}
+
+type QuotaLedgerMismatch struct {
+	UserId      int
+	Username    string
+	Quota       int
+	LedgerQuota int
+}
+
+// ReconcileQuotaLedger returns the users whose quota is not the sum of their ledger entries,
+// it is a single query so the balances and the entries are read from the same snapshot
+func ReconcileQuotaLedger() (mismatches []*QuotaLedgerMismatch, err error) {
+	err = DB.Table("users").
+		Select("users.id as user_id, users.username, users.quota, coalesce(sum(quota_ledger_entries.delta), 0) as ledger_quota").
+		Joins("left join quota_ledger_entries on quota_ledger_entries.user_id = users.id").
+		Group("users.id, users.username, users.quota").
+		Having("users.quota <> coalesce(sum(quota_ledger_entries.delta), 0)").
+		Scan(&mismatches).Error
+	return mismatches, err
+}
+
+// FixQuotaLedger records the difference between the quota and the ledger of the user as
+// an entry, so the ledger matches the quota again
+func FixQuotaLedger(userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		user := User{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota").First(&user, "id = ?", userId).Error
+		if err != nil {
+			return err
+		}
+		var ledgerQuota int
+		err = tx.Model(&QuotaLedgerEntry{}).Where("user_id = ?", userId).Select("coalesce(sum(delta), 0)").Scan(&ledgerQuota).Error
+		if err != nil {
+			return err
+		}
+		if user.Quota == ledgerQuota {
+			return nil
+		}
+		return tx.Create(&QuotaLedgerEntry{
+			UserId:       userId,
+			Delta:        user.Quota - ledgerQuota,
+			BalanceAfter: user.Quota,
+			Reason:       LedgerReasonReconcileDiff,
+			CreatedTime:  common.GetTimestamp(),
+		}).Error
+	})
+}
+
+// RunQuotaLedgerReconciliation reports the users whose quota does not match the ledger,
+// it returns true if everything matches or all the differences are fixed
+func RunQuotaLedgerReconciliation(fix bool) bool {
+	mismatches, err := ReconcileQuotaLedger()
+	if err != nil {
+		common.SysError("failed to reconcile quota ledger: " + err.Error())
+		return false
+	}
+	for _, mismatch := range mismatches {
+		common.SysError(fmt.Sprintf("user %d (%s): quota is %d, but the ledger sums to %d", mismatch.UserId, mismatch.Username, mismatch.Quota, mismatch.LedgerQuota))
+		if fix {
+			err = FixQuotaLedger(mismatch.UserId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to fix quota ledger of user %d: %s", mismatch.UserId, err.Error()))
+				return false
+			}
+		}
+	}
+	common.SysLog(fmt.Sprintf("quota ledger reconciled, %d mismatches found", len(mismatches)))
+	return len(mismatches) == 0 || fix
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gorm.io/gorm"
 	"one-api/common"
+	"strconv"
 )
 
 type Log struct {
@@ -18,6 +19,8 @@ type Log struct {
 	TokenName        string `json:"token_name" gorm:"index;default:''"`
 	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota            int    `json:"quota" gorm:"default:0"`
+	Cost             int    `json:"cost" gorm:"default:0"` // the quota charged by the upstream of the channel
+	Group            string `json:"group" gorm:"type:varchar(32);default:''"`
 	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
 	ChannelId        int    `json:"channel" gorm:"index"`
@@ -49,8 +52,8 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
-func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int, content string) {
-	common.LogInfo(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, group string, quota int, cost int, content string) {
+	common.LogInfo(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, group=%s, quota=%d, cost=%d, content=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, group, quota, cost, content))
 	if !common.LogConsumeEnabled {
 		return
 	}
@@ -65,9 +68,17 @@ func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptToke
 		TokenName:        tokenName,
 		ModelName:        modelName,
 		Quota:            quota,
+		Cost:             cost,
+		Group:            group,
 		ChannelId:        channelId,
 	}
-	err := DB.Create(log).Error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(log).Error
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventConsumeLog, log)
+	})
 	if err != nil {
 		common.LogError(ctx, "failed to record log: "+err.Error())
 	}
@@ -121,7 +132,7 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if endTimestamp != 0 {
 		tx = tx.Where("created_at <= ?", endTimestamp)
 	}
-	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id").Find(&logs).Error
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id", "cost").Find(&logs).Error
 	return logs, err
 }
 
@@ -131,7 +142,7 @@ func SearchAllLogs(keyword string) (logs []*Log, err error) {
 }
 
 func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
-	err = DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(common.MaxRecentItems).Omit("id").Find(&logs).Error
+	err = DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(common.MaxRecentItems).Omit("id", "cost").Find(&logs).Error
 	return logs, err
 }
 
@@ -180,6 +191,61 @@ func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return token
 }
 
+type MarginReport struct {
+	Name        string `json:"name"`                   // the channel id, model name or group
+	ChannelName string `json:"channel_name,omitempty"` // only for reports by channel
+	Requests    int    `json:"requests"`
+	Revenue     int64  `json:"revenue"`
+	Cost        int64  `json:"cost"`
+	Margin      int64  `json:"margin"`
+}
+
+// GetMarginReport sums the revenue and the upstream cost of the consume logs by channel, model or group
+func GetMarginReport(groupBy string, startTimestamp int64, endTimestamp int64) (reports []*MarginReport, err error) {
+	var column string
+	switch groupBy {
+	case "channel":
+		column = "channel_id"
+	case "model":
+		column = "model_name"
+	case "group":
+		column = "`group`"
+		if common.UsingPostgreSQL {
+			column = `"group"`
+		}
+	default:
+		return nil, fmt.Errorf("unknown group by: %s", groupBy)
+	}
+	tx := DB.Table("logs").Where("type = ?", LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Select(column + " as name, count(*) as requests, coalesce(sum(quota), 0) as revenue, coalesce(sum(cost), 0) as cost").
+		Group("name").Order("revenue desc").Scan(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	channelNames := make(map[string]string)
+	if groupBy == "channel" {
+		var channels []*Channel
+		err = DB.Select("id", "name").Find(&channels).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range channels {
+			channelNames[strconv.Itoa(channel.Id)] = channel.Name
+		}
+	}
+	for _, report := range reports {
+		report.Margin = report.Revenue - report.Cost
+		report.ChannelName = channelNames[report.Name]
+	}
+	return reports, nil
+}
+
 func DeleteOldLog(targetTimestamp int64) (int64, error) {
 	result := DB.Where("created_at < ?", targetTimestamp).Delete(&Log{})
 	return result.RowsAffected, result.Error
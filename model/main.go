@@ -30,9 +30,12 @@ func createRootAccountIfNeed() error {
 			Status:      common.UserStatusEnabled,
 			DisplayName: "Root User",
 			AccessToken: common.GetUUID(),
-			Quota:       100000000,
 		}
-		DB.Create(&rootUser)
+		err = DB.Create(&rootUser).Error
+		if err != nil {
+			return err
+		}
+		return ChangeUserQuota(rootUser.Id, 100000000, LedgerReasonOpening, "")
 	}
 	return nil
 }
@@ -113,6 +116,37 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&WebhookSubscription{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&WebhookDelivery{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&Plan{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&UserPlan{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&TopUpOrder{})
+		if err != nil {
+			return err
+		}
+		ledgerExists := db.Migrator().HasTable(&QuotaLedgerEntry{})
+		err = db.AutoMigrate(&QuotaLedgerEntry{})
+		if err != nil {
+			return err
+		}
+		if !ledgerExists {
+			err = initQuotaLedger(db)
+			if err != nil {
+				return err
+			}
+		}
 		common.SysLog("database migrated")
 		err = createRootAccountIfNeed()
 		return err
@@ -40,6 +40,8 @@ func InitOptionMap() {
 	common.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(common.DisplayInCurrencyEnabled)
 	common.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(common.DisplayTokenStatEnabled)
 	common.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(common.ChannelDisableThreshold, 'f', -1, 64)
+	common.OptionMap["ChannelExhaustionWarningHours"] = strconv.FormatFloat(common.ChannelExhaustionWarningHours, 'f', -1, 64)
+	common.OptionMap["USD2RMB"] = strconv.FormatFloat(common.USD2RMB, 'f', -1, 64)
 	common.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(common.EmailDomainRestrictionEnabled)
 	common.OptionMap["EmailDomainWhitelist"] = strings.Join(common.EmailDomainWhitelist, ",")
 	common.OptionMap["SMTPServer"] = ""
@@ -47,6 +49,17 @@ func InitOptionMap() {
 	common.OptionMap["SMTPPort"] = strconv.Itoa(common.SMTPPort)
 	common.OptionMap["SMTPAccount"] = ""
 	common.OptionMap["SMTPToken"] = ""
+	common.OptionMap["NotifyWebhookURL"] = ""
+	common.OptionMap["NotifyWebhookSecret"] = ""
+	common.OptionMap["NotifySlackWebhookURL"] = ""
+	common.OptionMap["NotifyTelegramBotToken"] = ""
+	common.OptionMap["NotifyTelegramChatId"] = ""
+	common.OptionMap["NotifyDingTalkWebhookURL"] = ""
+	common.OptionMap["NotifyDingTalkSecret"] = ""
+	common.OptionMap["NotifyFeishuWebhookURL"] = ""
+	common.OptionMap["NotifyFeishuSecret"] = ""
+	common.OptionMap["NotifyWeComWebhookURL"] = ""
+	common.OptionMap["NotificationRouting"] = common.NotificationRouting2JSONString()
 	common.OptionMap["Notice"] = ""
 	common.OptionMap["About"] = ""
 	common.OptionMap["HomePageContent"] = ""
@@ -61,13 +74,23 @@ func InitOptionMap() {
 	common.OptionMap["WeChatAccountQRCodeImageURL"] = ""
 	common.OptionMap["TurnstileSiteKey"] = ""
 	common.OptionMap["TurnstileSecretKey"] = ""
+	common.OptionMap["StripeSecretKey"] = ""
+	common.OptionMap["StripeWebhookSecret"] = ""
+	common.OptionMap["PaymentCurrency"] = common.PaymentCurrency
+	common.OptionMap["PaymentPrice"] = strconv.FormatFloat(common.PaymentPrice, 'f', -1, 64)
+	common.OptionMap["PaymentMinTopUp"] = strconv.Itoa(common.PaymentMinTopUp)
 	common.OptionMap["QuotaForNewUser"] = strconv.Itoa(common.QuotaForNewUser)
 	common.OptionMap["QuotaForInviter"] = strconv.Itoa(common.QuotaForInviter)
 	common.OptionMap["QuotaForInvitee"] = strconv.Itoa(common.QuotaForInvitee)
 	common.OptionMap["QuotaRemindThreshold"] = strconv.Itoa(common.QuotaRemindThreshold)
 	common.OptionMap["PreConsumedQuota"] = strconv.Itoa(common.PreConsumedQuota)
 	common.OptionMap["ModelRatio"] = common.ModelRatio2JSONString()
+	common.OptionMap["CompletionRatio"] = common.CompletionRatio2JSONString()
 	common.OptionMap["GroupRatio"] = common.GroupRatio2JSONString()
+	common.OptionMap["ModelPrices"] = common.ModelPrices2JSONString()
+	common.OptionMap["ModelPriceCurrency"] = common.ModelPriceCurrency
+	common.OptionMap["ModelPriceExchangeRate"] = strconv.FormatFloat(common.ModelPriceExchangeRate, 'f', -1, 64)
+	common.OptionMap["BaiduModelEndpoints"] = common.BaiduModelEndpoints2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	common.OptionMap["ChatLink"] = common.ChatLink
 	common.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(common.QuotaPerUnit, 'f', -1, 64)
@@ -174,6 +197,28 @@ func updateOptionMap(key string, value string) (err error) {
 		common.SMTPFrom = value
 	case "SMTPToken":
 		common.SMTPToken = value
+	case "NotifyWebhookURL":
+		common.NotifyWebhookURL = value
+	case "NotifyWebhookSecret":
+		common.NotifyWebhookSecret = value
+	case "NotifySlackWebhookURL":
+		common.NotifySlackWebhookURL = value
+	case "NotifyTelegramBotToken":
+		common.NotifyTelegramBotToken = value
+	case "NotifyTelegramChatId":
+		common.NotifyTelegramChatId = value
+	case "NotifyDingTalkWebhookURL":
+		common.NotifyDingTalkWebhookURL = value
+	case "NotifyDingTalkSecret":
+		common.NotifyDingTalkSecret = value
+	case "NotifyFeishuWebhookURL":
+		common.NotifyFeishuWebhookURL = value
+	case "NotifyFeishuSecret":
+		common.NotifyFeishuSecret = value
+	case "NotifyWeComWebhookURL":
+		common.NotifyWeComWebhookURL = value
+	case "NotificationRouting":
+		err = common.UpdateNotificationRoutingByJSONString(value)
 	case "ServerAddress":
 		common.ServerAddress = value
 	case "GitHubClientId":
@@ -196,6 +241,16 @@ func updateOptionMap(key string, value string) (err error) {
 		common.TurnstileSiteKey = value
 	case "TurnstileSecretKey":
 		common.TurnstileSecretKey = value
+	case "StripeSecretKey":
+		common.StripeSecretKey = value
+	case "StripeWebhookSecret":
+		common.StripeWebhookSecret = value
+	case "PaymentCurrency":
+		common.PaymentCurrency = strings.ToLower(value)
+	case "PaymentPrice":
+		common.PaymentPrice, _ = strconv.ParseFloat(value, 64)
+	case "PaymentMinTopUp":
+		common.PaymentMinTopUp, _ = strconv.Atoi(value)
 	case "QuotaForNewUser":
 		common.QuotaForNewUser, _ = strconv.Atoi(value)
 	case "QuotaForInviter":
@@ -210,14 +265,28 @@ func updateOptionMap(key string, value string) (err error) {
 		common.RetryTimes, _ = strconv.Atoi(value)
 	case "ModelRatio":
 		err = common.UpdateModelRatioByJSONString(value)
+	case "CompletionRatio":
+		err = common.UpdateCompletionRatioByJSONString(value)
 	case "GroupRatio":
 		err = common.UpdateGroupRatioByJSONString(value)
+	case "ModelPrices":
+		err = common.UpdateModelPricesByJSONString(value)
+	case "ModelPriceCurrency":
+		common.ModelPriceCurrency = strings.ToUpper(value)
+	case "ModelPriceExchangeRate":
+		common.ModelPriceExchangeRate, _ = strconv.ParseFloat(value, 64)
+	case "BaiduModelEndpoints":
+		err = common.UpdateBaiduModelEndpointsByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	case "ChatLink":
 		common.ChatLink = value
 	case "ChannelDisableThreshold":
 		common.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
+	case "ChannelExhaustionWarningHours":
+		common.ChannelExhaustionWarningHours, _ = strconv.ParseFloat(value, 64)
+	case "USD2RMB":
+		common.USD2RMB, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
 		common.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"one-api/common"
+	"strings"
+)
+
+// TopUpOrder is an online payment of quota, Amount is in the minor unit of Currency
+type TopUpOrder struct {
+	Id              int    `json:"id"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	TradeNo         string `json:"trade_no" gorm:"type:varchar(64);uniqueIndex"`
+	Provider        string `json:"provider" gorm:"type:varchar(32)"`
+	ProviderOrderId string `json:"provider_order_id" gorm:"type:varchar(255);default:''"`
+	Quota           int    `json:"quota"`
+	Amount          int64  `json:"amount"`
+	Currency        string `json:"currency" gorm:"type:varchar(8)"`
+	Status          int    `json:"status" gorm:"default:1"`
+	CreatedTime     int64  `json:"created_time" gorm:"bigint"`
+	PaidTime        int64  `json:"paid_time" gorm:"bigint"`
+}
+
+func GetAllTopUpOrders(startIdx int, num int) (orders []*TopUpOrder, err error) {
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orders).Error
+	return orders, err
+}
+
+func GetUserTopUpOrders(userId int, startIdx int, num int) (orders []*TopUpOrder, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&orders).Error
+	return orders, err
+}
+
+func GetTopUpOrderByTradeNo(tradeNo string) (*TopUpOrder, error) {
+	if tradeNo == "" {
+		return nil, errors.New("订单号为空！")
+	}
+	order := TopUpOrder{}
+	err := DB.First(&order, "trade_no = ?", tradeNo).Error
+	return &order, err
+}
+
+func (order *TopUpOrder) Insert() error {
+	return DB.Create(order).Error
+}
+
+func (order *TopUpOrder) UpdateProviderOrderId(providerOrderId string) error {
+	order.ProviderOrderId = providerOrderId
+	return DB.Model(order).Update("provider_order_id", providerOrderId).Error
+}
+
+// CompleteTopUpOrder credits the quota of a paid order, notifications are retried by
+// the providers, so the quota of an order is only credited the first time
+func CompleteTopUpOrder(provider string, tradeNo string, amount int64, currency string) (credited bool, err error) {
+	order, err := GetTopUpOrderByTradeNo(tradeNo)
+	if err != nil {
+		return false, err
+	}
+	if order.Provider != provider {
+		return false, fmt.Errorf("订单 %s 不属于支付渠道 %s", tradeNo, provider)
+	}
+	if amount < order.Amount || !strings.EqualFold(currency, order.Currency) {
+		return false, fmt.Errorf("支付金额 %d %s 与订单金额 %d %s 不符", amount, currency, order.Amount, order.Currency)
+	}
+	now := common.GetTimestamp()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TopUpOrder{}).Where("id = ? and status <> ?", order.Id, common.TopUpOrderStatusPaid).Updates(map[string]any{
+			"status":    common.TopUpOrderStatusPaid,
+			"paid_time": now,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		credited = true
+		err := changeUserQuota(tx, order.UserId, order.Quota, LedgerReasonPayment, "order:"+order.TradeNo)
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventUserTopup, map[string]any{
+			"user_id":  order.UserId,
+			"quota":    order.Quota,
+			"source":   "payment",
+			"provider": order.Provider,
+			"trade_no": order.TradeNo,
+			"amount":   order.Amount,
+			"currency": order.Currency,
+		})
+	})
+	if err != nil || !credited {
+		return false, err
+	}
+	err = CacheUpdateUserQuota(order.UserId)
+	if err != nil {
+		common.SysError("failed to update user quota cache: " + err.Error())
+	}
+	RecordLog(order.UserId, LogTypeTopup, fmt.Sprintf("通过 %s 在线充值 %s，支付金额 %.*f %s，订单号 %s", order.Provider, common.LogQuota(order.Quota), common.GetCurrencyMinorUnitExponent(order.Currency), common.PaymentMinorUnit2Amount(order.Amount, order.Currency), strings.ToUpper(order.Currency), order.TradeNo))
+	return true, nil
+}
+
+// FailTopUpOrder marks a pending order as failed, e.g. the checkout session expired
+func FailTopUpOrder(provider string, tradeNo string) error {
+	return DB.Model(&TopUpOrder{}).Where("trade_no = ? and provider = ? and status = ?", tradeNo, provider, common.TopUpOrderStatusPending).Update("status", common.TopUpOrderStatusFailed).Error
+}
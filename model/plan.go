@@ -0,0 +1,369 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"one-api/common"
+	"strings"
+	"time"
+)
+
+const (
+	PlanPeriodDay   = "day"
+	PlanPeriodMonth = "month"
+)
+
+const (
+	PlanResetModeReset  = "reset"  // the quota is set to the allowance at the start of each period
+	PlanResetModeRefill = "refill" // the allowance is added to the remaining quota
+)
+
+type Plan struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name" gorm:"index"`
+	Price         float64 `json:"price" gorm:"default:0"`
+	Quota         int     `json:"quota" gorm:"default:0"` // allowance of each period
+	Period        string  `json:"period" gorm:"type:varchar(16);default:'month'"`
+	ResetMode     string  `json:"reset_mode" gorm:"type:varchar(16);default:'reset'"`
+	AllowedGroups string  `json:"allowed_groups" gorm:"default:''"` // comma separated, empty means no restriction
+	AllowedModels string  `json:"allowed_models" gorm:"default:''"` // comma separated, empty means no restriction
+	Status        int     `json:"status" gorm:"default:1"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+}
+
+// UserPlan is the plan assigned to a user, a user has at most one plan
+type UserPlan struct {
+	Id            int   `json:"id"`
+	UserId        int   `json:"user_id" gorm:"uniqueIndex"`
+	PlanId        int   `json:"plan_id" gorm:"index"`
+	StartTime     int64 `json:"start_time" gorm:"bigint"`
+	EndTime       int64 `json:"end_time" gorm:"bigint"` // 0 means never expires
+	NextResetTime int64 `json:"next_reset_time" gorm:"bigint;index"`
+	CreatedTime   int64 `json:"created_time" gorm:"bigint"`
+}
+
+func splitPlanList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (plan *Plan) GetAllowedGroups() []string {
+	return splitPlanList(plan.AllowedGroups)
+}
+
+func (plan *Plan) AllowsGroup(group string) bool {
+	groups := plan.GetAllowedGroups()
+	if len(groups) == 0 {
+		return true
+	}
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (plan *Plan) AllowsModel(model string) bool {
+	models := splitPlanList(plan.AllowedModels)
+	if len(models) == 0 {
+		return true
+	}
+	for _, m := range models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func GetAllPlans() (plans []*Plan, err error) {
+	err = DB.Order("id desc").Find(&plans).Error
+	return plans, err
+}
+
+func GetPlanById(id int) (*Plan, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	plan := Plan{}
+	err := DB.First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func (plan *Plan) Insert() error {
+	return DB.Create(plan).Error
+}
+
+func (plan *Plan) Update() error {
+	// This can update zero values
+	return DB.Model(plan).Select("name", "price", "quota", "period", "reset_mode", "allowed_groups", "allowed_models", "status").Updates(plan).Error
+}
+
+func DeletePlanById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	var count int64
+	err := DB.Model(&UserPlan{}).Where("plan_id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐仍有用户在使用，无法删除")
+	}
+	return DB.Delete(&Plan{}, "id = ?", id).Error
+}
+
+func GetUserPlanByUserId(userId int) (*UserPlan, error) {
+	userPlan := UserPlan{}
+	err := DB.First(&userPlan, "user_id = ?", userId).Error
+	return &userPlan, err
+}
+
+// GetActivePlanOfUser returns the plan of the user if it is in effect now, otherwise nil
+func GetActivePlanOfUser(userId int) (*Plan, error) {
+	now := common.GetTimestamp()
+	var userPlans []*UserPlan
+	err := DB.Where("user_id = ? and start_time <= ? and (end_time = 0 or end_time > ?)", userId, now, now).Limit(1).Find(&userPlans).Error
+	if err != nil || len(userPlans) == 0 {
+		return nil, err
+	}
+	return GetPlanById(userPlans[0].PlanId)
+}
+
+func CacheGetActivePlanOfUser(userId int) (*Plan, error) {
+	if !common.RedisEnabled {
+		return GetActivePlanOfUser(userId)
+	}
+	key := fmt.Sprintf("user_plan:%d", userId)
+	planString, err := common.RedisGet(key)
+	if err == nil {
+		var plan *Plan
+		err = json.Unmarshal([]byte(planString), &plan)
+		return plan, err
+	}
+	plan, err := GetActivePlanOfUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+	err = common.RedisSet(key, string(jsonBytes), time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	if err != nil {
+		common.SysError("Redis set user plan error: " + err.Error())
+	}
+	return plan, nil
+}
+
+func cacheDeleteUserPlan(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	err := common.RedisDel(fmt.Sprintf("user_plan:%d", userId))
+	if err != nil {
+		common.SysError("Redis delete user plan error: " + err.Error())
+	}
+	err = common.RedisDel(fmt.Sprintf("user_group:%d", userId))
+	if err != nil {
+		common.SysError("Redis delete user group error: " + err.Error())
+	}
+}
+
+// addPlanMonths adds n months to t, the day is clamped to the last day of the target
+// month, e.g. Jan 31 + 1 month is Feb 28 (or 29) instead of AddDate's Mar 2 (or 3)
+func addPlanMonths(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	firstOfMonth := time.Date(year, month+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// getNextPlanResetTime counts the periods from the start time, so monthly plans
+// starting at the end of a month do not drift
+func getNextPlanResetTime(period string, startTime int64, now int64) int64 {
+	start := time.Unix(startTime, 0)
+	for n := 1; ; n++ {
+		var next time.Time
+		if period == PlanPeriodDay {
+			next = start.AddDate(0, 0, n)
+		} else {
+			next = addPlanMonths(start, n)
+		}
+		if next.Unix() > now {
+			return next.Unix()
+		}
+	}
+}
+
+// AssignUserPlan replaces the plan of the user, if the user's group is not allowed
+// by the plan, the user is moved to the first allowed group
+func AssignUserPlan(userId int, planId int, startTime int64, endTime int64) error {
+	plan, err := GetPlanById(planId)
+	if err != nil {
+		return err
+	}
+	if plan.Status != common.PlanStatusEnabled {
+		return errors.New("该套餐已被禁用")
+	}
+	if startTime == 0 {
+		startTime = common.GetTimestamp()
+	}
+	if endTime != 0 && endTime <= startTime {
+		return errors.New("套餐结束时间必须晚于开始时间")
+	}
+	group, err := GetUserGroup(userId)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&UserPlan{}, "user_id = ?", userId).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&UserPlan{
+			UserId:        userId,
+			PlanId:        planId,
+			StartTime:     startTime,
+			EndTime:       endTime,
+			NextResetTime: startTime,
+			CreatedTime:   common.GetTimestamp(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if !plan.AllowsGroup(group) {
+			return tx.Model(&User{}).Where("id = ?", userId).Update("group", plan.GetAllowedGroups()[0]).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cacheDeleteUserPlan(userId)
+	expiration := "永久"
+	if endTime != 0 {
+		expiration = time.Unix(endTime, 0).Format("2006-01-02 15:04:05")
+	}
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("管理员将用户套餐设置为 %s，到期时间：%s", plan.Name, expiration))
+	if !plan.AllowsGroup(group) {
+		RecordLog(userId, LogTypeManage, fmt.Sprintf("套餐 %s 不支持分组 %s，用户分组已调整为 %s", plan.Name, group, plan.GetAllowedGroups()[0]))
+	}
+	if startTime <= common.GetTimestamp() {
+		userPlan, err := GetUserPlanByUserId(userId)
+		if err == nil {
+			err = userPlan.refresh(common.GetTimestamp())
+		}
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to refresh plan of user %d: %s", userId, err.Error()))
+		}
+	}
+	return nil
+}
+
+func CancelUserPlan(userId int) error {
+	result := DB.Delete(&UserPlan{}, "user_id = ?", userId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该用户没有套餐")
+	}
+	cacheDeleteUserPlan(userId)
+	RecordLog(userId, LogTypeManage, "管理员取消了用户的套餐")
+	return nil
+}
+
+// refresh expires the plan or grants the allowance of the current period, the
+// next reset time works as an optimistic lock so the allowance is granted once
+// even when several nodes run the job
+func (userPlan *UserPlan) refresh(now int64) error {
+	plan, err := GetPlanById(userPlan.PlanId)
+	if err != nil {
+		return err
+	}
+	if userPlan.EndTime != 0 && userPlan.EndTime <= now {
+		result := DB.Delete(&UserPlan{}, "id = ? and next_reset_time = ?", userPlan.Id, userPlan.NextResetTime)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		cacheDeleteUserPlan(userPlan.UserId)
+		RecordLog(userPlan.UserId, LogTypeManage, fmt.Sprintf("套餐 %s 已到期", plan.Name))
+		return nil
+	}
+	nextResetTime := getNextPlanResetTime(plan.Period, userPlan.StartTime, now)
+	if userPlan.EndTime != 0 && nextResetTime > userPlan.EndTime {
+		// let the job expire the plan at the end time
+		nextResetTime = userPlan.EndTime
+	}
+	granted := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&UserPlan{}).Where("id = ? and next_reset_time = ?", userPlan.Id, userPlan.NextResetTime).Update("next_reset_time", nextResetTime)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		granted = true
+		var err error
+		if plan.ResetMode == PlanResetModeRefill {
+			err = changeUserQuota(tx, userPlan.UserId, plan.Quota, LedgerReasonPlan, fmt.Sprintf("plan:%d", plan.Id))
+		} else {
+			err = setUserQuota(tx, userPlan.UserId, plan.Quota, LedgerReasonPlan, fmt.Sprintf("plan:%d", plan.Id))
+		}
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventUserTopup, map[string]any{
+			"user_id":    userPlan.UserId,
+			"quota":      plan.Quota,
+			"source":     "plan",
+			"plan_id":    plan.Id,
+			"reset_mode": plan.ResetMode,
+		})
+	})
+	if err != nil || !granted {
+		return err
+	}
+	userPlan.NextResetTime = nextResetTime
+	cacheDeleteUserPlan(userPlan.UserId)
+	err = CacheUpdateUserQuota(userPlan.UserId)
+	if err != nil {
+		common.SysError("failed to update user quota cache: " + err.Error())
+	}
+	if plan.ResetMode == PlanResetModeRefill {
+		RecordLog(userPlan.UserId, LogTypeTopup, fmt.Sprintf("套餐 %s 补充额度 %s", plan.Name, common.LogQuota(plan.Quota)))
+	} else {
+		RecordLog(userPlan.UserId, LogTypeTopup, fmt.Sprintf("套餐 %s 额度重置为 %s", plan.Name, common.LogQuota(plan.Quota)))
+	}
+	return nil
+}
+
+// RefreshDueUserPlans grants the allowances of the plans whose period has started
+// and expires the plans whose end time has passed
+func RefreshDueUserPlans() {
+	now := common.GetTimestamp()
+	var userPlans []*UserPlan
+	err := DB.Where("next_reset_time <= ?", now).Find(&userPlans).Error
+	if err != nil {
+		common.SysError("failed to get due user plans: " + err.Error())
+		return
+	}
+	for _, userPlan := range userPlans {
+		err = userPlan.refresh(now)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to refresh plan of user %d: %s", userPlan.UserId, err.Error()))
+		}
+	}
+}
@@ -64,18 +64,38 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if redemption.Status != common.RedemptionCodeStatusEnabled {
 			return errors.New("该兑换码已被使用")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		err = changeUserQuota(tx, userId, redemption.Quota, LedgerReasonRedemption, fmt.Sprintf("redemption:%d", redemption.Id))
 		if err != nil {
 			return err
 		}
 		redemption.RedeemedTime = common.GetTimestamp()
 		redemption.Status = common.RedemptionCodeStatusUsed
 		err = tx.Save(redemption).Error
-		return err
+		if err != nil {
+			return err
+		}
+		err = PublishWebhookEvent(tx, WebhookEventRedemptionUsed, map[string]any{
+			"redemption_id": redemption.Id,
+			"name":          redemption.Name,
+			"user_id":       userId,
+			"quota":         redemption.Quota,
+		})
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventUserTopup, map[string]any{
+			"user_id": userId,
+			"quota":   redemption.Quota,
+			"source":  "redemption",
+		})
 	})
 	if err != nil {
 		return 0, errors.New("兑换失败，" + err.Error())
 	}
+	err = CacheUpdateUserQuota(userId)
+	if err != nil {
+		common.SysError("failed to update user quota cache: " + err.Error())
+	}
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码 %s*****%s 充值 %s", key[0:4], key[len(key)-4:], common.LogQuota(redemption.Quota)))
 	return redemption.Quota, nil
 }
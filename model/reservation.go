@@ -0,0 +1,275 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var ErrInsufficientUserQuota = errors.New("user quota is not enough")
+
+// With Redis enabled, the quota of a request is reserved in Redis instead of being
+// deducted in the database, both from the user and, unless its quota is unlimited, from
+// the token:
+//   - user_quota:<id> caches the quota in the database, it is deleted after the quota is
+//     changed in the database and reloaded by the next reservation
+//   - user_quota_version:<id> is increased on every deletion, so a reload that read the
+//     database before a change cannot overwrite the cache after it
+//   - user_quota_reservations:<id> is a sorted set of "<reservation id>:<quota>" scored
+//     by the expiration time, so the reservations of crashed requests are dropped
+// token_quota:<id>, token_quota_version:<id> and token_quota_reservations:<id> do the same
+// for the remaining quota of a token. The available quota is the cached quota minus the
+// reserved quota, it is checked and reserved by a single script for the user and the
+// token, so concurrent requests cannot reserve more than either quota.
+
+const (
+	quotaReserveOK           = 1
+	quotaReserveInsufficient = -1
+	quotaReserveNotLoaded    = -2
+)
+
+const quotaVersionExpiration = 24 * time.Hour
+
+// KEYS: quota, version, reservations of the user, then of the token if its quota is limited
+// ARGV: member, quota, now, expire at, cache seconds, reservation seconds, then the loaded
+// quota ("" if not loaded) and the version of the loaded quota of every account in KEYS
+var reserveQuotaScript = redis.NewScript(`
+local count = #KEYS / 3
+local available = {}
+for i = 1, count do
+	local balance = redis.call('GET', KEYS[i * 3 - 2])
+	if not balance then
+		if ARGV[5 + i * 2] == '' or (redis.call('GET', KEYS[i * 3 - 1]) or '0') ~= ARGV[6 + i * 2] then
+			return {-2, i}
+		end
+		balance = ARGV[5 + i * 2]
+		redis.call('SET', KEYS[i * 3 - 2], balance, 'EX', ARGV[5])
+	end
+	redis.call('ZREMRANGEBYSCORE', KEYS[i * 3], '-inf', ARGV[3])
+	local reserved = 0
+	for _, member in ipairs(redis.call('ZRANGE', KEYS[i * 3], 0, -1)) do
+		reserved = reserved + tonumber(string.match(member, ':(%-?%d+)$'))
+	end
+	available[i] = tonumber(balance) - reserved
+	if available[i] < tonumber(ARGV[2]) then
+		return {-1, i}
+	end
+end
+for i = 1, count do
+	redis.call('ZADD', KEYS[i * 3], ARGV[4], ARGV[1])
+	redis.call('EXPIRE', KEYS[i * 3], ARGV[6])
+end
+return {1, available[1]}
+`)
+
+// KEYS: quota, version
+// ARGV: loaded quota, version of the loaded quota, cache seconds
+var loadUserQuotaScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') == ARGV[2] then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[3], 'NX')
+end
+return 1
+`)
+
+// KEYS: quota, version, reservations of every account
+// ARGV: member ("" if none), version seconds
+var invalidateQuotaScript = redis.NewScript(`
+for i = 1, #KEYS / 3 do
+	if ARGV[1] ~= '' then
+		redis.call('ZREM', KEYS[i * 3], ARGV[1])
+	end
+	redis.call('DEL', KEYS[i * 3 - 2])
+	redis.call('INCR', KEYS[i * 3 - 1])
+	redis.call('EXPIRE', KEYS[i * 3 - 1], ARGV[2])
+end
+return 1
+`)
+
+func getUserQuotaCacheKeys(userId int) []string {
+	return []string{
+		fmt.Sprintf("user_quota:%d", userId),
+		fmt.Sprintf("user_quota_version:%d", userId),
+		fmt.Sprintf("user_quota_reservations:%d", userId),
+	}
+}
+
+func getTokenQuotaCacheKeys(tokenId int) []string {
+	return []string{
+		fmt.Sprintf("token_quota:%d", tokenId),
+		fmt.Sprintf("token_quota_version:%d", tokenId),
+		fmt.Sprintf("token_quota_reservations:%d", tokenId),
+	}
+}
+
+// loadQuotaCache reads the quota from the database, the version is read first, so the
+// quota is only cached if no change happened since the version was read
+func loadQuotaCache(keys []string, getQuota func() (int, error)) (quota int, version string, err error) {
+	version, err = common.RedisGet(keys[1])
+	if errors.Is(err, redis.Nil) {
+		version = "0"
+	} else if err != nil {
+		return 0, "", err
+	}
+	quota, err = getQuota()
+	return quota, version, err
+}
+
+func loadUserQuotaCache(userId int) (quota int, version string, err error) {
+	return loadQuotaCache(getUserQuotaCacheKeys(userId), func() (int, error) {
+		return GetUserQuota(userId)
+	})
+}
+
+func loadTokenQuotaCache(tokenId int) (quota int, version string, err error) {
+	return loadQuotaCache(getTokenQuotaCacheKeys(tokenId), func() (int, error) {
+		token, err := GetTokenById(tokenId)
+		if err != nil {
+			return 0, err
+		}
+		return token.RemainQuota, nil
+	})
+}
+
+// invalidateQuotaCache must be called after the quota is changed in the database
+func invalidateQuotaCache(keys []string, member string) error {
+	return invalidateQuotaScript.Run(context.Background(), common.RDB, keys,
+		member, int(quotaVersionExpiration.Seconds())).Err()
+}
+
+func invalidateUserQuotaCache(userId int, member string) error {
+	return invalidateQuotaCache(getUserQuotaCacheKeys(userId), member)
+}
+
+func invalidateTokenQuotaCache(tokenId int, member string) error {
+	return invalidateQuotaCache(getTokenQuotaCacheKeys(tokenId), member)
+}
+
+// QuotaReservation is the quota held for a request until the request is settled
+type QuotaReservation struct {
+	Id      string
+	UserId  int
+	TokenId int
+	Quota   int
+
+	// the cache keys of the accounts the quota is reserved from in Redis
+	cacheKeys []string
+}
+
+func (reservation *QuotaReservation) member() string {
+	return fmt.Sprintf("%s:%d", reservation.Id, reservation.Quota)
+}
+
+// ReserveQuota holds quota for a request, without Redis the quota is pre-consumed in
+// the database, the reservation must be settled once the usage is known
+func ReserveQuota(userId int, tokenId int, quota int) (*QuotaReservation, error) {
+	if quota < 0 {
+		return nil, errors.New("quota cannot be a negative number")
+	}
+	reservation := &QuotaReservation{
+		Id:      common.GetUUID(),
+		UserId:  userId,
+		TokenId: tokenId,
+		Quota:   quota,
+	}
+	if !common.RedisEnabled {
+		err := PreConsumeTokenQuota(tokenId, quota)
+		if err != nil {
+			return nil, err
+		}
+		return reservation, nil
+	}
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return nil, err
+	}
+	reservation.cacheKeys = getUserQuotaCacheKeys(userId)
+	loaders := []func() (int, string, error){
+		func() (int, string, error) { return loadUserQuotaCache(userId) },
+	}
+	if !token.UnlimitedQuota {
+		reservation.cacheKeys = append(reservation.cacheKeys, getTokenQuotaCacheKeys(tokenId)...)
+		loaders = append(loaders, func() (int, string, error) { return loadTokenQuotaCache(tokenId) })
+	}
+	now := time.Now()
+	args := []any{
+		reservation.member(),
+		quota,
+		now.Unix(),
+		now.Add(time.Duration(common.QuotaReservationTimeout) * time.Second).Unix(),
+		UserId2QuotaCacheSeconds,
+		common.QuotaReservationTimeout,
+	}
+	for range loaders {
+		args = append(args, "", "")
+	}
+	for i := 0; i < 3; i++ {
+		result, err := reserveQuotaScript.Run(context.Background(), common.RDB, reservation.cacheKeys, args...).Int64Slice()
+		if err != nil {
+			return nil, err
+		}
+		switch result[0] {
+		case quotaReserveOK:
+			remindUserQuota(userId, int(result[1]), quota)
+			return reservation, nil
+		case quotaReserveInsufficient:
+			if result[1] == 1 {
+				return nil, ErrInsufficientUserQuota
+			}
+			return nil, errors.New("insufficient token balance")
+		case quotaReserveNotLoaded:
+			account := int(result[1]) - 1
+			loadedQuota, version, err := loaders[account]()
+			if err != nil {
+				return nil, err
+			}
+			args[6+account*2] = loadedQuota
+			args[7+account*2] = version
+		}
+	}
+	return nil, errors.New("quota keeps changing, please try again")
+}
+
+// Settle consumes the quota actually used by the request and releases the reservation,
+// the quota may be more than the reserved quota
+func (reservation *QuotaReservation) Settle(quota int) error {
+	if !common.RedisEnabled {
+		return PostConsumeTokenQuota(reservation.TokenId, quota-reservation.Quota)
+	}
+	var err error
+	if quota != 0 {
+		err = consumeReservedQuota(reservation, quota)
+	}
+	// the reservation is released even if consuming failed, the error is logged by the caller
+	invalidateErr := invalidateQuotaCache(reservation.cacheKeys, reservation.member())
+	if err != nil {
+		return err
+	}
+	return invalidateErr
+}
+
+// consumeReservedQuota does not go through the batch updater, since the cache is reloaded
+// from the database right after the reservation is released
+func consumeReservedQuota(reservation *QuotaReservation, quota int) error {
+	token, err := GetTokenById(reservation.TokenId)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		return changeUserQuota(tx, reservation.UserId, -quota, LedgerReasonConsume, fmt.Sprintf("token:%d", reservation.TokenId))
+	})
+	if err != nil {
+		return err
+	}
+	if !token.UnlimitedQuota {
+		if quota > 0 {
+			return decreaseTokenQuota(reservation.TokenId, quota)
+		}
+		return increaseTokenQuota(reservation.TokenId, -quota)
+	}
+	return nil
+}
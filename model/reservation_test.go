@@ -0,0 +1,108 @@
+package model
+
+import (
+	"one-api/common"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func setupReservationTest(t *testing.T) {
+	common.SQLitePath = filepath.Join(t.TempDir(), "one-api.db")
+	common.RedisEnabled = false
+	err := InitDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = CloseDB()
+	})
+	server := miniredis.RunT(t)
+	common.RDB = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		common.RedisEnabled = false
+		_ = common.RDB.Close()
+	})
+}
+
+func TestReserveQuotaConcurrently(t *testing.T) {
+	tests := []struct {
+		name           string
+		userQuota      int
+		tokenQuota     int
+		unlimitedToken bool
+	}{
+		{"user balance", 1000, 0, true},
+		{"token balance", 1000, 600, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupReservationTest(t)
+			user := &User{Username: "reserver", Password: "12345678", DisplayName: "reserver"}
+			err := user.Insert(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = DB.Model(user).Update("quota", test.userQuota).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			token := &Token{UserId: user.Id, Key: common.GetUUID(), Name: "reserver", RemainQuota: test.tokenQuota, UnlimitedQuota: test.unlimitedToken}
+			err = token.Insert()
+			if err != nil {
+				t.Fatal(err)
+			}
+			balance := test.userQuota
+			if !test.unlimitedToken {
+				balance = test.tokenQuota
+			}
+
+			const requests = 50
+			const quota = 30
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			settled := 0
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					reservation, err := ReserveQuota(user.Id, token.Id, quota)
+					if err != nil {
+						return
+					}
+					err = reservation.Settle(quota)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mutex.Lock()
+					settled++
+					mutex.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			if settled == 0 {
+				t.Fatal("no reservation succeeded")
+			}
+			userQuota, err := GetUserQuota(user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spent := test.userQuota - userQuota; spent != settled*quota || spent > balance {
+				t.Errorf("spent %d of the user quota for %d settled requests, the balance is %d", spent, settled, balance)
+			}
+			token, err = GetTokenById(token.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.unlimitedToken && token.RemainQuota < 0 {
+				t.Errorf("the token quota went negative: %d", token.RemainQuota)
+			}
+		})
+	}
+}
@@ -96,7 +96,20 @@ func GetTokenById(id int) (*Token, error) {
 
 func (token *Token) Insert() error {
 	var err error
-	err = DB.Create(token).Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(token).Error
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventTokenCreated, map[string]any{
+			"id":              token.Id,
+			"user_id":         token.UserId,
+			"name":            token.Name,
+			"expired_time":    token.ExpiredTime,
+			"remain_quota":    token.RemainQuota,
+			"unlimited_quota": token.UnlimitedQuota,
+		})
+	})
 	return err
 }
 
@@ -104,7 +117,10 @@ func (token *Token) Insert() error {
 func (token *Token) Update() error {
 	var err error
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota").Updates(token).Error
-	return err
+	if err != nil {
+		return err
+	}
+	return CacheUpdateTokenQuota(token.Id)
 }
 
 func (token *Token) SelectUpdate() error {
@@ -114,7 +130,17 @@ func (token *Token) SelectUpdate() error {
 
 func (token *Token) Delete() error {
 	var err error
-	err = DB.Delete(token).Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(token).Error
+		if err != nil {
+			return err
+		}
+		return PublishWebhookEvent(tx, WebhookEventTokenDeleted, map[string]any{
+			"id":      token.Id,
+			"user_id": token.UserId,
+			"name":    token.Name,
+		})
+	})
 	return err
 }
 
@@ -191,46 +217,50 @@ func PreConsumeTokenQuota(tokenId int, quota int) (err error) {
 		return err
 	}
 	if userQuota < quota {
-		return errors.New("insufficient user balance")
+		return ErrInsufficientUserQuota
 	}
+	remindUserQuota(token.UserId, userQuota, quota)
+	if !token.UnlimitedQuota {
+		err = DecreaseTokenQuota(tokenId, quota)
+		if err != nil {
+			return err
+		}
+	}
+	err = DecreaseUserQuota(token.UserId, quota, LedgerReasonPreConsume, fmt.Sprintf("token:%d", tokenId))
+	return err
+}
+
+// remindUserQuota notifies the user if the quota is about to be exhausted after consuming quota
+func remindUserQuota(userId int, userQuota int, quota int) {
 	quotaTooLow := userQuota >= common.QuotaRemindThreshold && userQuota-quota < common.QuotaRemindThreshold
 	noMoreQuota := userQuota-quota <= 0
 	if quotaTooLow || noMoreQuota {
 		go func() {
-			email, err := GetUserEmail(token.UserId)
+			user, err := GetUserById(userId, false)
 			if err != nil {
-				common.SysError("failed to fetch user email: " + err.Error())
+				common.SysError("failed to fetch user: " + err.Error())
+				return
 			}
+			event := common.NotifyEventQuotaLow
 			prompt := "Your quota is about to be exhausted"
 			if noMoreQuota {
+				event = common.NotifyEventQuotaExhausted
 				prompt = "Your quota has been fully utilized."
 			}
-			if email != "" {
-				//topUpLink := fmt.Sprintf("%s/topup", common.ServerAddress)
-				err = common.SendEmail(prompt, email,
-					fmt.Sprintf("%s, the current remaining quota is %d. To avoid any disruption to your usage, please recharge in a timely manner.", prompt, userQuota))
-				if err != nil {
-					common.SysError("failed to send email" + err.Error())
-				}
-			}
+			//topUpLink := fmt.Sprintf("%s/topup", common.ServerAddress)
+			content := fmt.Sprintf("%s, the current remaining quota is %d. To avoid any disruption to your usage, please recharge in a timely manner.", prompt, userQuota)
+			NotifyUser(user, event, prompt, content)
+			common.NotifyRoot(event, fmt.Sprintf("用户 %s（#%d）额度不足", user.Username, user.Id), content)
 		}()
 	}
-	if !token.UnlimitedQuota {
-		err = DecreaseTokenQuota(tokenId, quota)
-		if err != nil {
-			return err
-		}
-	}
-	err = DecreaseUserQuota(token.UserId, quota)
-	return err
 }
 
 func PostConsumeTokenQuota(tokenId int, quota int) (err error) {
 	token, err := GetTokenById(tokenId)
 	if quota > 0 {
-		err = DecreaseUserQuota(token.UserId, quota)
+		err = DecreaseUserQuota(token.UserId, quota, LedgerReasonConsume, fmt.Sprintf("token:%d", tokenId))
 	} else {
-		err = IncreaseUserQuota(token.UserId, -quota)
+		err = IncreaseUserQuota(token.UserId, -quota, LedgerReasonConsume, fmt.Sprintf("token:%d", tokenId))
 	}
 	if err != nil {
 		return err
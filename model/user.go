@@ -28,6 +28,9 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	NotifyChannel    string `json:"notify_channel" gorm:"type:varchar(32);default:'email'"` // how the quota alerts are sent
+	NotifyTarget     string `json:"notify_target"`                                          // webhook url or telegram chat id
+	NotifySecret     string `json:"notify_secret"`
 }
 
 func GetMaxUserId() int {
@@ -85,23 +88,43 @@ func (user *User) Insert(inviterId int) error {
 			return err
 		}
 	}
-	user.Quota = common.QuotaForNewUser
+	user.Quota = 0
 	user.AccessToken = common.GetUUID()
 	user.AffCode = common.GetRandomString(4)
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(user).Error
+		if err != nil {
+			return err
+		}
+		if common.QuotaForNewUser > 0 {
+			err = changeUserQuota(tx, user.Id, common.QuotaForNewUser, LedgerReasonRegister, "")
+			if err != nil {
+				return err
+			}
+		}
+		return PublishWebhookEvent(tx, WebhookEventUserRegistered, map[string]any{
+			"id":           user.Id,
+			"username":     user.Username,
+			"display_name": user.DisplayName,
+			"email":        user.Email,
+			"group":        user.Group,
+			"inviter_id":   inviterId,
+		})
+	})
+	if err != nil {
+		return err
 	}
 	if common.QuotaForNewUser > 0 {
+		user.Quota = common.QuotaForNewUser
 		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(common.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, LedgerReasonInviteeBonus, fmt.Sprintf("user:%d", inviterId))
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
-			_ = IncreaseUserQuota(inviterId, common.QuotaForInviter)
+			_ = IncreaseUserQuota(inviterId, common.QuotaForInviter, LedgerReasonInviterBonus, fmt.Sprintf("user:%d", user.Id))
 			RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户赠送 %s", common.LogQuota(common.QuotaForInviter)))
 		}
 	}
@@ -116,10 +139,42 @@ func (user *User) Update(updatePassword bool) error {
 			return err
 		}
 	}
-	err = DB.Model(user).Updates(user).Error
+	// the quota is only changed through the ledger
+	err = DB.Model(user).Omit("quota").Updates(user).Error
 	return err
 }
 
+func (user *User) UpdateNotifySetting() error {
+	return DB.Model(user).Select("notify_channel", "notify_target", "notify_secret").Updates(User{
+		NotifyChannel: user.NotifyChannel,
+		NotifyTarget:  user.NotifyTarget,
+		NotifySecret:  user.NotifySecret,
+	}).Error
+}
+
+// NotifyUser sends the notification through the notify channel chosen by the user
+func NotifyUser(user *User, event string, subject string, content string) {
+	if (user.NotifyChannel == "" || user.NotifyChannel == common.NotifierEmail) && user.Email == "" {
+		return
+	}
+	notifier, err := common.GetUserNotifier(user.NotifyChannel, user.NotifyTarget, user.NotifySecret, user.Email)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get notifier of user %d: %s", user.Id, err.Error()))
+		return
+	}
+	if notifier == nil {
+		return
+	}
+	err = notifier.Send(&common.Notification{
+		Event:   event,
+		Subject: subject,
+		Content: content,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to notify user %d: %s", user.Id, err.Error()))
+	}
+}
+
 func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 为空！")
@@ -275,7 +330,9 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
-func IncreaseUserQuota(id int, quota int) (err error) {
+// IncreaseUserQuota records the change in the ledger, with batch update enabled the
+// changes of a user are aggregated into one batch_update entry
+func IncreaseUserQuota(id int, quota int, reason string, referenceId string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -283,15 +340,10 @@ func IncreaseUserQuota(id int, quota int) (err error) {
 		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
 		return nil
 	}
-	return increaseUserQuota(id, quota)
+	return ChangeUserQuota(id, quota, reason, referenceId)
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	return err
-}
-
-func DecreaseUserQuota(id int, quota int) (err error) {
+func DecreaseUserQuota(id int, quota int, reason string, referenceId string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -299,12 +351,7 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
 		return nil
 	}
-	return decreaseUserQuota(id, quota)
-}
-
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	return err
+	return ChangeUserQuota(id, -quota, reason, referenceId)
 }
 
 func GetRootUserEmail() (email string) {
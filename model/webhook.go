@@ -0,0 +1,222 @@
+package model
+
+import (
+	"encoding/json"
+	"math/rand"
+	"one-api/common"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// webhook events
+const (
+	WebhookEventUserRegistered      = "user.registered"
+	WebhookEventUserTopup           = "user.topup"
+	WebhookEventRedemptionUsed      = "redemption.used"
+	WebhookEventTokenCreated        = "token.created"
+	WebhookEventTokenDeleted        = "token.deleted"
+	WebhookEventChannelStatusChange = "channel.status_changed"
+	WebhookEventConsumeLog          = "log.consume"
+)
+
+var WebhookEvents = []string{
+	WebhookEventUserRegistered,
+	WebhookEventUserTopup,
+	WebhookEventRedemptionUsed,
+	WebhookEventTokenCreated,
+	WebhookEventTokenDeleted,
+	WebhookEventChannelStatusChange,
+	WebhookEventConsumeLog,
+}
+
+const (
+	WebhookDeliveryStatusPending = iota + 1
+	WebhookDeliveryStatusSucceeded
+	WebhookDeliveryStatusFailed
+)
+
+type WebhookSubscription struct {
+	Id          int     `json:"id"`
+	Name        string  `json:"name" gorm:"index"`
+	URL         string  `json:"url" gorm:"column:url"`
+	Secret      string  `json:"secret"`
+	Events      string  `json:"events"` // comma separated, * means all events
+	Status      int     `json:"status" gorm:"default:1"`
+	SampleRate  float64 `json:"sample_rate" gorm:"default:1"` // only applies to consume logs
+	CreatedTime int64   `json:"created_time" gorm:"bigint"`
+}
+
+// WebhookDelivery is the outbox of webhook events, a delivery stays pending until
+// the endpoint accepts it, so events are delivered at least once across restarts
+type WebhookDelivery struct {
+	Id              int    `json:"id"`
+	SubscriptionId  int    `json:"subscription_id" gorm:"index"`
+	EventId         string `json:"event_id" gorm:"type:char(32)"`
+	Event           string `json:"event" gorm:"type:varchar(64)"`
+	Payload         string `json:"payload" gorm:"type:text"`
+	Status          int    `json:"status" gorm:"default:1;index:idx_status_next_attempt,priority:1"`
+	Attempts        int    `json:"attempts" gorm:"default:0"`
+	NextAttemptTime int64  `json:"next_attempt_time" gorm:"bigint;index:idx_status_next_attempt,priority:2"`
+	LastError       string `json:"last_error" gorm:"type:varchar(1024);default:''"`
+	CreatedTime     int64  `json:"created_time" gorm:"bigint"`
+	DeliveredTime   int64  `json:"delivered_time" gorm:"bigint"`
+}
+
+type WebhookPayload struct {
+	Id        string `json:"id"`
+	Event     string `json:"event"`
+	CreatedAt int64  `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+func (subscription *WebhookSubscription) Subscribes(event string) bool {
+	for _, e := range strings.Split(subscription.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+var webhookSubscriptions []*WebhookSubscription
+var webhookSubscriptionsLock sync.RWMutex
+
+// InitWebhookSubscriptionCache loads the enabled subscriptions, so publishing events
+// does not query the database when nobody subscribes
+func InitWebhookSubscriptionCache() {
+	var subscriptions []*WebhookSubscription
+	err := DB.Where("status = ?", common.WebhookStatusEnabled).Find(&subscriptions).Error
+	if err != nil {
+		common.SysError("failed to load webhook subscriptions: " + err.Error())
+		return
+	}
+	webhookSubscriptionsLock.Lock()
+	webhookSubscriptions = subscriptions
+	webhookSubscriptionsLock.Unlock()
+}
+
+func getSubscriptionsOfEvent(event string) []*WebhookSubscription {
+	webhookSubscriptionsLock.RLock()
+	defer webhookSubscriptionsLock.RUnlock()
+	var subscriptions []*WebhookSubscription
+	for _, subscription := range webhookSubscriptions {
+		if subscription.Subscribes(event) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+// PublishWebhookEvent writes the event into the outbox of every subscription of it with
+// a single insert, tx must be the transaction making the change, so the event is stored
+// if and only if the change is committed
+func PublishWebhookEvent(tx *gorm.DB, event string, data any) error {
+	subscriptions := getSubscriptionsOfEvent(event)
+	if len(subscriptions) == 0 {
+		return nil
+	}
+	payload := WebhookPayload{
+		Id:        common.GetUUID(),
+		Event:     event,
+		CreatedAt: common.GetTimestamp(),
+		Data:      data,
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var deliveries []*WebhookDelivery
+	for _, subscription := range subscriptions {
+		if event == WebhookEventConsumeLog && subscription.SampleRate < 1 && rand.Float64() >= subscription.SampleRate {
+			continue
+		}
+		deliveries = append(deliveries, &WebhookDelivery{
+			SubscriptionId:  subscription.Id,
+			EventId:         payload.Id,
+			Event:           event,
+			Payload:         string(jsonData),
+			Status:          WebhookDeliveryStatusPending,
+			NextAttemptTime: payload.CreatedAt,
+			CreatedTime:     payload.CreatedAt,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
+
+func GetAllWebhookSubscriptions() (subscriptions []*WebhookSubscription, err error) {
+	err = DB.Order("id desc").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func GetWebhookSubscriptionById(id int) (*WebhookSubscription, error) {
+	subscription := WebhookSubscription{}
+	err := DB.First(&subscription, "id = ?", id).Error
+	return &subscription, err
+}
+
+func (subscription *WebhookSubscription) Insert() error {
+	err := DB.Create(subscription).Error
+	if err == nil {
+		InitWebhookSubscriptionCache()
+	}
+	return err
+}
+
+func (subscription *WebhookSubscription) Update() error {
+	err := DB.Model(subscription).Select("name", "url", "secret", "events", "status", "sample_rate").Updates(subscription).Error
+	if err == nil {
+		InitWebhookSubscriptionCache()
+	}
+	return err
+}
+
+func DeleteWebhookSubscriptionById(id int) error {
+	err := DB.Delete(&WebhookSubscription{}, "id = ?", id).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Delete(&WebhookDelivery{}, "subscription_id = ? and status = ?", id, WebhookDeliveryStatusPending).Error
+	InitWebhookSubscriptionCache()
+	return err
+}
+
+func GetWebhookDeliveries(subscriptionId int, startIdx int, num int) (deliveries []*WebhookDelivery, err error) {
+	tx := DB.Order("id desc")
+	if subscriptionId != 0 {
+		tx = tx.Where("subscription_id = ?", subscriptionId)
+	}
+	err = tx.Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func GetDueWebhookDeliveries(num int) (deliveries []*WebhookDelivery, err error) {
+	err = DB.Where("status = ? and next_attempt_time <= ?", WebhookDeliveryStatusPending, common.GetTimestamp()).
+		Order("next_attempt_time").Limit(num).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (delivery *WebhookDelivery) SelectUpdate() error {
+	// This can update zero values
+	return DB.Model(delivery).Select("status", "attempts", "next_attempt_time", "last_error", "delivered_time").Updates(delivery).Error
+}
+
+func RetryWebhookDeliveryById(id int) error {
+	return DB.Model(&WebhookDelivery{}).Where("id = ?", id).Updates(map[string]any{
+		"status":            WebhookDeliveryStatusPending,
+		"next_attempt_time": common.GetTimestamp(),
+	}).Error
+}
+
+func SyncWebhookSubscriptionCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		InitWebhookSubscriptionCache()
+	}
+}
@@ -37,10 +37,15 @@ func SetApiRouter(router *gin.Engine) {
 			{
 				selfRoute.GET("/self", controller.GetSelf)
 				selfRoute.PUT("/self", controller.UpdateSelf)
+				selfRoute.PUT("/notify_setting", controller.UpdateSelfNotifySetting)
+				selfRoute.GET("/plan", controller.GetSelfPlan)
+				selfRoute.GET("/statement", controller.GetSelfQuotaStatement)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
+				selfRoute.GET("/order", controller.GetSelfTopUpOrders)
+				selfRoute.POST("/order", controller.CreateTopUpOrder)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -49,12 +54,39 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/statement", controller.GetUserQuotaStatement)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 			}
 		}
+		paymentRoute := apiRouter.Group("/payment")
+		{
+			paymentRoute.POST("/webhook/:provider", controller.PaymentWebhook)
+			paymentRoute.GET("/fake/pay", middleware.AdminAuth(), controller.FakePay)
+			paymentRoute.GET("/order", middleware.AdminAuth(), controller.GetAllTopUpOrders)
+		}
+		planRoute := apiRouter.Group("/plan")
+		planRoute.Use(middleware.AdminAuth())
+		{
+			planRoute.GET("/", controller.GetAllPlans)
+			planRoute.POST("/", controller.AddPlan)
+			planRoute.PUT("/", controller.UpdatePlan)
+			planRoute.DELETE("/:id", controller.DeletePlan)
+			planRoute.GET("/user/:id", controller.GetUserPlan)
+			planRoute.POST("/user", controller.AssignUserPlan)
+		}
+		webhookRoute := apiRouter.Group("/webhook")
+		webhookRoute.Use(middleware.RootAuth())
+		{
+			webhookRoute.GET("/", controller.GetAllWebhookSubscriptions)
+			webhookRoute.POST("/", controller.AddWebhookSubscription)
+			webhookRoute.PUT("/", controller.UpdateWebhookSubscription)
+			webhookRoute.DELETE("/:id", controller.DeleteWebhookSubscription)
+			webhookRoute.GET("/delivery", controller.GetWebhookDeliveries)
+			webhookRoute.POST("/delivery/:id/retry", controller.RetryWebhookDelivery)
+		}
 		optionRoute := apiRouter.Group("/option")
 		optionRoute.Use(middleware.RootAuth())
 		{
@@ -71,7 +103,9 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/progress", controller.GetAllChannelsBalanceUpdateProgress)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
+			channelRoute.GET("/fetch_models/:id", controller.FetchChannelModels)
 			channelRoute.POST("/", controller.AddChannel)
 			channelRoute.PUT("/", controller.UpdateChannel)
 			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
@@ -101,6 +135,7 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/margin", middleware.AdminAuth(), controller.GetMarginReport)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
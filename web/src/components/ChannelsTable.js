@@ -43,6 +43,14 @@ function renderBalance(type, balance) {
       return <span>¥{balance.toFixed(2)}</span>;
     case 13: // AIGC2D
       return <span>{renderNumber(balance)}</span>;
+    case 20: // OpenRouter
+      return <span>${balance.toFixed(2)}</span>;
+    case 30: // DeepSeek
+      return <span>¥{balance.toFixed(2)}</span>;
+    case 31: // Moonshot
+      return <span>¥{balance.toFixed(2)}</span>;
+    case 33: // SiliconFlow
+      return <span>¥{balance.toFixed(2)}</span>;
     default:
       return <span>不支持</span>;
   }
@@ -217,15 +225,23 @@ const ChannelsTable = () => {
 
   const testChannel = async (id, name, idx) => {
     const res = await API.get(`/api/channel/test/${id}/`);
-    const { success, message, time } = res.data;
+    const { success, message, time, first_token_time, model } = res.data;
+    if (time === undefined) {
+      showError(message);
+      return;
+    }
+    let newChannels = [...channels];
+    let realIdx = (activePage - 1) * ITEMS_PER_PAGE + idx;
+    newChannels[realIdx].response_time = time * 1000;
+    newChannels[realIdx].test_time = Date.now() / 1000;
     if (success) {
-      let newChannels = [...channels];
-      let realIdx = (activePage - 1) * ITEMS_PER_PAGE + idx;
-      newChannels[realIdx].response_time = time * 1000;
-      newChannels[realIdx].test_time = Date.now() / 1000;
+      newChannels[realIdx].first_token_time = first_token_time * 1000;
+      newChannels[realIdx].test_error = '';
       setChannels(newChannels);
-      showInfo(`通道 ${name} 测试成功，耗时 ${time.toFixed(2)} 秒。`);
+      showInfo(`通道 ${name} 使用模型 ${model} 测试成功，耗时 ${time.toFixed(2)} 秒，首字耗时 ${first_token_time.toFixed(2)} 秒。`);
     } else {
+      newChannels[realIdx].test_error = message;
+      setChannels(newChannels);
       showError(message);
     }
   };
@@ -266,15 +282,35 @@ const ChannelsTable = () => {
     }
   };
 
+  const waitForBalanceUpdate = async () => {
+    while (true) {
+      await new Promise((resolve) => setTimeout(resolve, 2000));
+      const res = await API.get(`/api/channel/update_balance/progress`);
+      const { success, message, data } = res.data;
+      if (!success) {
+        showError(message);
+        return;
+      }
+      if (!data.running) {
+        showInfo(`已更新完毕所有已启用通道余额，成功 ${data.succeeded} 个，失败 ${data.failed} 个！`);
+        await refresh();
+        return;
+      }
+    }
+  };
+
   const updateAllChannelsBalance = async () => {
     setUpdatingBalance(true);
     const res = await API.get(`/api/channel/update_balance`);
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
-      showInfo('已更新完毕所有已启用通道余额！');
+      showInfo(`已开始更新 ${data.total} 个已启用通道的余额，请稍候。`);
     } else {
       showError(message);
     }
+    if (data && data.running) {
+      await waitForBalanceUpdate();
+    }
     setUpdatingBalance(false);
   };
 
@@ -417,7 +453,10 @@ const ChannelsTable = () => {
                   <Table.Cell>{renderStatus(channel.status)}</Table.Cell>
                   <Table.Cell>
                     <Popup
-                      content={channel.test_time ? renderTimestamp(channel.test_time) : '未测试'}
+                      content={channel.test_time ? (
+                        channel.test_error ? `${renderTimestamp(channel.test_time)}，测试失败：${channel.test_error}` :
+                          `${renderTimestamp(channel.test_time)}，首字耗时 ${(channel.first_token_time / 1000).toFixed(2)} 秒`
+                      ) : '未测试'}
                       key={channel.id}
                       trigger={renderResponseTime(channel.response_time)}
                       basic
@@ -430,7 +469,9 @@ const ChannelsTable = () => {
                       }} style={{ cursor: 'pointer' }}>
                       {renderBalance(channel.type, channel.balance)}
                     </span>}
-                      content='点击更新'
+                      content={channel.exhaustion_time ?
+                        `点击更新，每小时消耗 ${channel.burn_rate.toFixed(2)}，预计 ${timestamp2string(channel.exhaustion_time)} 耗尽` :
+                        '点击更新'}
                       basic
                     />
                   </Table.Cell>
@@ -0,0 +1,90 @@
+import React, { useState } from 'react';
+import { Form, Header, Segment, Table } from 'semantic-ui-react';
+import { API, showError, timestamp2string } from '../helpers';
+import { renderQuota } from '../helpers/render';
+
+const GROUP_BY_OPTIONS = [
+  { key: 'channel', text: '渠道', value: 'channel' },
+  { key: 'model', text: '模型', value: 'model' },
+  { key: 'group', text: '分组', value: 'group' }
+];
+
+function renderName(report, groupBy) {
+  if (groupBy === 'channel') {
+    return report.channel_name ? `${report.name} - ${report.channel_name}` : report.name;
+  }
+  return report.name === '' ? '无' : report.name;
+}
+
+const MarginReport = () => {
+  const [reports, setReports] = useState([]);
+  const [loading, setLoading] = useState(false);
+  let now = new Date();
+  const [inputs, setInputs] = useState({
+    group_by: 'channel',
+    start_timestamp: timestamp2string(now.getTime() / 1000 - 30 * 86400),
+    end_timestamp: timestamp2string(now.getTime() / 1000 + 3600)
+  });
+  const [groupBy, setGroupBy] = useState(inputs.group_by);
+  const { group_by, start_timestamp, end_timestamp } = inputs;
+
+  const handleInputChange = (e, { name, value }) => {
+    setInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+
+  const loadReports = async () => {
+    setLoading(true);
+    let localStartTimestamp = Date.parse(start_timestamp) / 1000;
+    let localEndTimestamp = Date.parse(end_timestamp) / 1000;
+    const res = await API.get(`/api/log/margin?group_by=${group_by}&start_timestamp=${localStartTimestamp}&end_timestamp=${localEndTimestamp}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setReports(data || []);
+      setGroupBy(group_by);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  return (
+    <Segment>
+      <Header as='h3'>渠道毛利</Header>
+      <Form>
+        <Form.Group>
+          <Form.Select fluid label='统计维度' width={3} options={GROUP_BY_OPTIONS} value={group_by}
+                       name='group_by' onChange={handleInputChange} />
+          <Form.Input fluid label='起始时间' width={4} value={start_timestamp} type='datetime-local'
+                      name='start_timestamp' onChange={handleInputChange} />
+          <Form.Input fluid label='结束时间' width={4} value={end_timestamp} type='datetime-local'
+                      name='end_timestamp' onChange={handleInputChange} />
+          <Form.Button fluid label='操作' width={2} loading={loading} onClick={loadReports}>查询</Form.Button>
+        </Form.Group>
+      </Form>
+      <Table basic compact size='small'>
+        <Table.Header>
+          <Table.Row>
+            <Table.HeaderCell>{GROUP_BY_OPTIONS.find((option) => option.value === groupBy).text}</Table.HeaderCell>
+            <Table.HeaderCell>请求次数</Table.HeaderCell>
+            <Table.HeaderCell>收入</Table.HeaderCell>
+            <Table.HeaderCell>成本</Table.HeaderCell>
+            <Table.HeaderCell>毛利</Table.HeaderCell>
+          </Table.Row>
+        </Table.Header>
+        <Table.Body>
+          {reports.map((report) => (
+            <Table.Row key={report.name}>
+              <Table.Cell>{renderName(report, groupBy)}</Table.Cell>
+              <Table.Cell>{report.requests}</Table.Cell>
+              <Table.Cell>{renderQuota(report.revenue)}</Table.Cell>
+              <Table.Cell>{renderQuota(report.cost)}</Table.Cell>
+              <Table.Cell>{renderQuota(report.margin)}</Table.Cell>
+            </Table.Row>
+          ))}
+        </Table.Body>
+      </Table>
+    </Segment>
+  );
+};
+
+export default MarginReport;
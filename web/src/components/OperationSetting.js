@@ -11,13 +11,20 @@ const OperationSetting = () => {
     QuotaRemindThreshold: 0,
     PreConsumedQuota: 0,
     ModelRatio: '',
+    CompletionRatio: '',
     GroupRatio: '',
+    ModelPrices: '',
+    ModelPriceCurrency: '',
+    ModelPriceExchangeRate: 0,
+    BaiduModelEndpoints: '',
     TopUpLink: '',
     ChatLink: '',
     QuotaPerUnit: 0,
     AutomaticDisableChannelEnabled: '',
     AutomaticEnableChannelEnabled: '',
     ChannelDisableThreshold: 0,
+    ChannelExhaustionWarningHours: 0,
+    USD2RMB: 0,
     LogConsumeEnabled: '',
     DisplayInCurrencyEnabled: '',
     DisplayTokenStatEnabled: '',
@@ -34,7 +41,7 @@ const OperationSetting = () => {
     if (success) {
       let newInputs = {};
       data.forEach((item) => {
-        if (item.key === 'ModelRatio' || item.key === 'GroupRatio') {
+        if (['ModelRatio', 'CompletionRatio', 'GroupRatio', 'ModelPrices', 'BaiduModelEndpoints'].includes(item.key)) {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
         newInputs[item.key] = item.value;
@@ -85,6 +92,12 @@ const OperationSetting = () => {
         if (originInputs['QuotaRemindThreshold'] !== inputs.QuotaRemindThreshold) {
           await updateOption('QuotaRemindThreshold', inputs.QuotaRemindThreshold);
         }
+        if (originInputs['ChannelExhaustionWarningHours'] !== inputs.ChannelExhaustionWarningHours) {
+          await updateOption('ChannelExhaustionWarningHours', inputs.ChannelExhaustionWarningHours);
+        }
+        if (originInputs['USD2RMB'] !== inputs.USD2RMB) {
+          await updateOption('USD2RMB', inputs.USD2RMB);
+        }
         break;
       case 'ratio':
         if (originInputs['ModelRatio'] !== inputs.ModelRatio) {
@@ -94,6 +107,13 @@ const OperationSetting = () => {
           }
           await updateOption('ModelRatio', inputs.ModelRatio);
         }
+        if (originInputs['CompletionRatio'] !== inputs.CompletionRatio) {
+          if (!verifyJSON(inputs.CompletionRatio)) {
+            showError('补全倍率不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('CompletionRatio', inputs.CompletionRatio);
+        }
         if (originInputs['GroupRatio'] !== inputs.GroupRatio) {
           if (!verifyJSON(inputs.GroupRatio)) {
             showError('分组倍率不是合法的 JSON 字符串');
@@ -102,6 +122,30 @@ const OperationSetting = () => {
           await updateOption('GroupRatio', inputs.GroupRatio);
         }
         break;
+      case 'price':
+        if (originInputs['ModelPrices'] !== inputs.ModelPrices) {
+          if (!verifyJSON(inputs.ModelPrices)) {
+            showError('模型价格不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ModelPrices', inputs.ModelPrices);
+        }
+        if (originInputs['ModelPriceCurrency'] !== inputs.ModelPriceCurrency) {
+          await updateOption('ModelPriceCurrency', inputs.ModelPriceCurrency);
+        }
+        if (originInputs['ModelPriceExchangeRate'] !== inputs.ModelPriceExchangeRate) {
+          await updateOption('ModelPriceExchangeRate', inputs.ModelPriceExchangeRate);
+        }
+        break;
+      case 'endpoint':
+        if (originInputs['BaiduModelEndpoints'] !== inputs.BaiduModelEndpoints) {
+          if (!verifyJSON(inputs.BaiduModelEndpoints)) {
+            showError('百度模型接口不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('BaiduModelEndpoints', inputs.BaiduModelEndpoints);
+        }
+        break;
       case 'quota':
         if (originInputs['QuotaForNewUser'] !== inputs.QuotaForNewUser) {
           await updateOption('QuotaForNewUser', inputs.QuotaForNewUser);
@@ -241,7 +285,7 @@ const OperationSetting = () => {
           <Header as='h3'>
             监控设置
           </Header>
-          <Form.Group widths={3}>
+          <Form.Group widths={4}>
             <Form.Input
               label='最长响应时间'
               name='ChannelDisableThreshold'
@@ -262,6 +306,27 @@ const OperationSetting = () => {
               min='0'
               placeholder='低于此额度时将发送邮件提醒用户'
             />
+            <Form.Input
+              label='渠道余额预警时间'
+              name='ChannelExhaustionWarningHours'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.ChannelExhaustionWarningHours}
+              type='number'
+              min='0'
+              placeholder='单位小时，预计在此时间内耗尽余额的渠道将发送提醒并降低优先级'
+            />
+            <Form.Input
+              label='人民币汇率（1 美元兑换的人民币数量）'
+              name='USD2RMB'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.USD2RMB}
+              type='number'
+              step='0.01'
+              min='0'
+              placeholder='用于换算以人民币计价的渠道余额，估算消耗速度与耗尽时间'
+            />
           </Form.Group>
           <Form.Group inline>
             <Form.Checkbox
@@ -344,6 +409,17 @@ const OperationSetting = () => {
               placeholder='为一个 JSON 文本，键为模型名称，值为倍率'
             />
           </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='补全倍率'
+              name='CompletionRatio'
+              onChange={handleInputChange}
+              style={{ minHeight: 250, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.CompletionRatio}
+              placeholder='为一个 JSON 文本，键为模型名称，值为补全价格相对于提示价格的倍率，名称中的 * 匹配任意字符，未列出的模型使用匹配的最长名称，没有匹配的模型为 1'
+            />
+          </Form.Group>
           <Form.Group widths='equal'>
             <Form.TextArea
               label='分组倍率'
@@ -358,6 +434,64 @@ const OperationSetting = () => {
           <Form.Button onClick={() => {
             submitConfig('ratio').then();
           }}>保存倍率设置</Form.Button>
+          <Divider />
+          <Header as='h3'>
+            价格设置
+            <Header.Subheader>设置了价格的模型按价格计费，不再使用模型倍率与补全倍率，分组倍率仍然生效</Header.Subheader>
+          </Header>
+          <Form.Group widths={2}>
+            <Form.Input
+              label='价格货币'
+              name='ModelPriceCurrency'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.ModelPriceCurrency}
+              placeholder='例如：USD'
+            />
+            <Form.Input
+              label='汇率（1 美元兑换的价格货币数量）'
+              name='ModelPriceExchangeRate'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.ModelPriceExchangeRate}
+              type='number'
+              step='0.01'
+              min='0'
+              placeholder='例如：7.2'
+            />
+          </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='模型价格'
+              name='ModelPrices'
+              onChange={handleInputChange}
+              style={{ minHeight: 250, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.ModelPrices}
+              placeholder={'为一个 JSON 文本，键为模型名称，值为价格，例如：{"gpt-4o": {"input": 5, "output": 15, "cached_input": 2.5, "per_request": 0}}，input、output 与 cached_input 为每百万 tokens 的价格，per_request 为每次请求（图片模型为每张图片）的固定费用'}
+            />
+          </Form.Group>
+          <Form.Button onClick={() => {
+            submitConfig('price').then();
+          }}>保存价格设置</Form.Button>
+          <Divider />
+          <Header as='h3'>
+            模型接口设置
+          </Header>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='百度文心千帆模型接口'
+              name='BaiduModelEndpoints'
+              onChange={handleInputChange}
+              style={{ minHeight: 250, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.BaiduModelEndpoints}
+              placeholder='为一个 JSON 文本，键为模型名称，值为接口路径（例如 chat/completions_pro）或完整的接口地址，自行部署的模型也在此配置'
+            />
+          </Form.Group>
+          <Form.Button onClick={() => {
+            submitConfig('endpoint').then();
+          }}>保存模型接口设置</Form.Button>
         </Form>
       </Grid.Column>
     </Grid>
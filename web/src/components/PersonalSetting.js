@@ -14,7 +14,10 @@ const PersonalSetting = () => {
     wechat_verification_code: '',
     email_verification_code: '',
     email: '',
-    self_account_deletion_confirmation: ''
+    self_account_deletion_confirmation: '',
+    notify_channel: 'email',
+    notify_target: '',
+    notify_secret: ''
   });
   const [status, setStatus] = useState({});
   const [showWeChatBindModal, setShowWeChatBindModal] = useState(false);
@@ -39,8 +42,36 @@ const PersonalSetting = () => {
         setTurnstileSiteKey(status.turnstile_site_key);
       }
     }
+    loadNotifySetting().then();
   }, []);
 
+  const loadNotifySetting = async () => {
+    const res = await API.get('/api/user/self');
+    const { success, data } = res.data;
+    if (success) {
+      setInputs((inputs) => ({
+        ...inputs,
+        notify_channel: data.notify_channel || 'email',
+        notify_target: data.notify_target || '',
+        notify_secret: data.notify_secret || ''
+      }));
+    }
+  };
+
+  const updateNotifySetting = async () => {
+    const res = await API.put('/api/user/notify_setting', {
+      notify_channel: inputs.notify_channel,
+      notify_target: inputs.notify_target,
+      notify_secret: inputs.notify_secret
+    });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('通知设置已更新！');
+    } else {
+      showError(message);
+    }
+  };
+
   useEffect(() => {
     let countdownInterval = null;
     if (disableButton && countdown > 0) {
@@ -201,6 +232,49 @@ const PersonalSetting = () => {
         />
       )}
       <Divider />
+      <Header as='h3'>额度提醒</Header>
+      <Form>
+        <Form.Group widths='equal'>
+          <Form.Select
+            label='通知方式'
+            name='notify_channel'
+            options={[
+              { key: 'email', text: '邮件', value: 'email' },
+              { key: 'webhook', text: 'Webhook', value: 'webhook' },
+              { key: 'slack', text: 'Slack', value: 'slack' },
+              { key: 'telegram', text: 'Telegram', value: 'telegram' },
+              { key: 'dingtalk', text: '钉钉机器人', value: 'dingtalk' },
+              { key: 'feishu', text: '飞书机器人', value: 'feishu' },
+              { key: 'wecom', text: '企业微信机器人', value: 'wecom' },
+              { key: 'none', text: '不通知', value: 'none' }
+            ]}
+            value={inputs.notify_channel}
+            onChange={handleInputChange}
+          />
+          {inputs.notify_channel !== 'email' && inputs.notify_channel !== 'none' && (
+            <Form.Input
+              label={inputs.notify_channel === 'telegram' ? 'Chat ID' : 'Webhook 地址'}
+              name='notify_target'
+              placeholder={inputs.notify_channel === 'telegram' ? '' : '仅支持公网可访问的 https 地址'}
+              value={inputs.notify_target}
+              onChange={handleInputChange}
+              autoComplete='new-password'
+            />
+          )}
+          {['webhook', 'dingtalk', 'feishu'].includes(inputs.notify_channel) && (
+            <Form.Input
+              label='签名密钥'
+              name='notify_secret'
+              type='password'
+              value={inputs.notify_secret}
+              onChange={handleInputChange}
+              autoComplete='new-password'
+            />
+          )}
+        </Form.Group>
+        <Button onClick={updateNotifySetting}>保存通知设置</Button>
+      </Form>
+      <Divider />
       <Header as='h3'>账号绑定</Header>
       {
         status.wechat_login && (
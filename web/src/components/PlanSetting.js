@@ -0,0 +1,179 @@
+import React, { useEffect, useState } from 'react';
+import { Button, Form, Header, Label, Table } from 'semantic-ui-react';
+import { API, showError, showSuccess } from '../helpers';
+import { renderQuota, renderQuotaWithPrompt } from '../helpers/render';
+
+const originPlan = {
+  id: 0,
+  name: '',
+  price: 0,
+  quota: 0,
+  period: 'month',
+  reset_mode: 'reset',
+  allowed_groups: '',
+  allowed_models: '',
+  status: 1
+};
+
+const periodOptions = [
+  { key: 'month', text: '每月', value: 'month' },
+  { key: 'day', text: '每天', value: 'day' }
+];
+
+const resetModeOptions = [
+  { key: 'reset', text: '重置为套餐额度', value: 'reset' },
+  { key: 'refill', text: '在剩余额度上累加', value: 'refill' }
+];
+
+const PlanSetting = () => {
+  const [plans, setPlans] = useState([]);
+  const [inputs, setInputs] = useState(originPlan);
+  const [loading, setLoading] = useState(false);
+
+  const loadPlans = async () => {
+    const res = await API.get('/api/plan/');
+    const { success, message, data } = res.data;
+    if (success) {
+      setPlans(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    loadPlans().then();
+  }, []);
+
+  const handleInputChange = (e, { name, value }) => {
+    setInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+
+  const submitPlan = async (plan) => {
+    setLoading(true);
+    plan = {
+      ...plan,
+      price: parseFloat(plan.price) || 0,
+      quota: parseInt(plan.quota) || 0
+    };
+    let res;
+    if (plan.id) {
+      res = await API.put('/api/plan/', plan);
+    } else {
+      res = await API.post('/api/plan/', plan);
+    }
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('保存成功！');
+      setInputs(originPlan);
+      await loadPlans();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const deletePlan = async (id) => {
+    const res = await API.delete(`/api/plan/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('删除成功！');
+      await loadPlans();
+    } else {
+      showError(message);
+    }
+  };
+
+  return (
+    <div>
+      <Header as='h3'>
+        套餐设置
+        <Header.Subheader>
+          为用户分配套餐后，系统会在每个周期开始时重置或补充用户额度；允许的分组和模型留空表示不做限制，多个值以英文逗号分隔
+        </Header.Subheader>
+      </Header>
+      <Form loading={loading}>
+        <Form.Group widths='equal'>
+          <Form.Input label='名称' name='name' value={inputs.name} onChange={handleInputChange} />
+          <Form.Input label='价格' name='price' type='number' min='0' value={inputs.price} onChange={handleInputChange} />
+          <Form.Input
+            label={`周期额度${renderQuotaWithPrompt(inputs.quota)}`}
+            name='quota'
+            type='number'
+            min='0'
+            value={inputs.quota}
+            onChange={handleInputChange}
+          />
+        </Form.Group>
+        <Form.Group widths='equal'>
+          <Form.Select label='周期' name='period' options={periodOptions} value={inputs.period} onChange={handleInputChange} />
+          <Form.Select
+            label='额度重置方式'
+            name='reset_mode'
+            options={resetModeOptions}
+            value={inputs.reset_mode}
+            onChange={handleInputChange}
+          />
+        </Form.Group>
+        <Form.Group widths='equal'>
+          <Form.Input
+            label='允许的分组'
+            name='allowed_groups'
+            value={inputs.allowed_groups}
+            onChange={handleInputChange}
+            placeholder='例如：vip,svip'
+          />
+          <Form.Input
+            label='允许的模型'
+            name='allowed_models'
+            value={inputs.allowed_models}
+            onChange={handleInputChange}
+            placeholder='例如：gpt-3.5-turbo,gpt-4'
+          />
+        </Form.Group>
+        <Button onClick={() => submitPlan(inputs)}>{inputs.id ? '更新套餐' : '添加套餐'}</Button>
+        {inputs.id ? <Button onClick={() => setInputs(originPlan)}>取消编辑</Button> : null}
+      </Form>
+      <Table basic compact size='small'>
+        <Table.Header>
+          <Table.Row>
+            <Table.HeaderCell>ID</Table.HeaderCell>
+            <Table.HeaderCell>名称</Table.HeaderCell>
+            <Table.HeaderCell>价格</Table.HeaderCell>
+            <Table.HeaderCell>周期额度</Table.HeaderCell>
+            <Table.HeaderCell>允许的分组</Table.HeaderCell>
+            <Table.HeaderCell>允许的模型</Table.HeaderCell>
+            <Table.HeaderCell>状态</Table.HeaderCell>
+            <Table.HeaderCell>操作</Table.HeaderCell>
+          </Table.Row>
+        </Table.Header>
+        <Table.Body>
+          {plans.map((plan) => (
+            <Table.Row key={plan.id}>
+              <Table.Cell>{plan.id}</Table.Cell>
+              <Table.Cell>{plan.name}</Table.Cell>
+              <Table.Cell>{plan.price}</Table.Cell>
+              <Table.Cell>
+                {renderQuota(plan.quota)} / {plan.period === 'day' ? '天' : '月'}
+                {plan.reset_mode === 'refill' ? '（累加）' : '（重置）'}
+              </Table.Cell>
+              <Table.Cell>{plan.allowed_groups || '不限'}</Table.Cell>
+              <Table.Cell>{plan.allowed_models || '不限'}</Table.Cell>
+              <Table.Cell>
+                {plan.status === 1 ? <Label basic color='green'>已启用</Label> : <Label basic color='red'>已禁用</Label>}
+              </Table.Cell>
+              <Table.Cell>
+                <Button size='small' onClick={() => setInputs(plan)}>编辑</Button>
+                <Button size='small' onClick={() => submitPlan({ ...plan, status: plan.status === 1 ? 2 : 1 })}>
+                  {plan.status === 1 ? '禁用' : '启用'}
+                </Button>
+                <Button size='small' negative onClick={() => deletePlan(plan.id)}>删除</Button>
+              </Table.Cell>
+            </Table.Row>
+          ))}
+        </Table.Body>
+      </Table>
+    </div>
+  );
+};
+
+export default PlanSetting;
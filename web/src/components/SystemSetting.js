@@ -1,6 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { Button, Divider, Form, Grid, Header, Modal, Message } from 'semantic-ui-react';
-import { API, removeTrailingSlash, showError } from '../helpers';
+import { API, removeTrailingSlash, showError, verifyJSON } from '../helpers';
 
 const SystemSetting = () => {
   let [inputs, setInputs] = useState({
@@ -16,6 +16,17 @@ const SystemSetting = () => {
     SMTPAccount: '',
     SMTPFrom: '',
     SMTPToken: '',
+    NotifyWebhookURL: '',
+    NotifyWebhookSecret: '',
+    NotifySlackWebhookURL: '',
+    NotifyTelegramBotToken: '',
+    NotifyTelegramChatId: '',
+    NotifyDingTalkWebhookURL: '',
+    NotifyDingTalkSecret: '',
+    NotifyFeishuWebhookURL: '',
+    NotifyFeishuSecret: '',
+    NotifyWeComWebhookURL: '',
+    NotificationRouting: '',
     ServerAddress: '',
     Footer: '',
     WeChatAuthEnabled: '',
@@ -25,6 +36,11 @@ const SystemSetting = () => {
     TurnstileCheckEnabled: '',
     TurnstileSiteKey: '',
     TurnstileSecretKey: '',
+    StripeSecretKey: '',
+    StripeWebhookSecret: '',
+    PaymentCurrency: '',
+    PaymentPrice: '',
+    PaymentMinTopUp: '',
     RegisterEnabled: '',
     EmailDomainRestrictionEnabled: '',
     EmailDomainWhitelist: ''
@@ -41,6 +57,9 @@ const SystemSetting = () => {
     if (success) {
       let newInputs = {};
       data.forEach((item) => {
+        if (item.key === 'NotificationRouting') {
+          item.value = JSON.stringify(JSON.parse(item.value), null, 2);
+        }
         newInputs[item.key] = item.value;
       });
       setInputs({
@@ -104,6 +123,7 @@ const SystemSetting = () => {
     if (
       name === 'Notice' ||
       name.startsWith('SMTP') ||
+      name.startsWith('Notif') ||
       name === 'ServerAddress' ||
       name === 'GitHubClientId' ||
       name === 'GitHubClientSecret' ||
@@ -149,6 +169,25 @@ const SystemSetting = () => {
     }
   };
 
+  const submitNotification = async () => {
+    const keys = ['NotifyWebhookURL', 'NotifyWebhookSecret', 'NotifySlackWebhookURL', 'NotifyTelegramBotToken', 'NotifyTelegramChatId', 'NotifyDingTalkWebhookURL', 'NotifyDingTalkSecret', 'NotifyFeishuWebhookURL', 'NotifyFeishuSecret', 'NotifyWeComWebhookURL'];
+    for (const key of keys) {
+      // secrets are not sent to the frontend, only update them when filled in
+      if (originInputs[key] === undefined && inputs[key] === '') {
+        continue;
+      }
+      if (originInputs[key] !== inputs[key]) {
+        await updateOption(key, inputs[key]);
+      }
+    }
+    if (originInputs['NotificationRouting'] !== inputs.NotificationRouting) {
+      if (!verifyJSON(inputs.NotificationRouting)) {
+        showError('通知路由不是合法的 JSON 字符串');
+        return;
+      }
+      await updateOption('NotificationRouting', inputs.NotificationRouting);
+    }
+  };
 
   const submitEmailDomainWhitelist = async () => {
     if (
@@ -207,6 +246,18 @@ const SystemSetting = () => {
     }
   };
 
+  const submitPayment = async () => {
+    const keys = ['PaymentCurrency', 'PaymentPrice', 'PaymentMinTopUp', 'StripeSecretKey', 'StripeWebhookSecret'];
+    for (const key of keys) {
+      if (originInputs[key] === undefined && inputs[key] === '') {
+        continue;
+      }
+      if (originInputs[key] !== inputs[key]) {
+        await updateOption(key, inputs[key]);
+      }
+    }
+  };
+
   const submitNewRestrictedDomain = () => {
     const localDomainList = inputs.EmailDomainWhitelist;
     if (restrictedDomainInput !== '' && !localDomainList.includes(restrictedDomainInput)) {
@@ -414,6 +465,113 @@ const SystemSetting = () => {
           </Form.Group>
           <Form.Button onClick={submitSMTP}>保存 SMTP 设置</Form.Button>
           <Divider />
+          <Header as='h3'>
+            配置通知渠道
+            <Header.Subheader>用以发送通道禁用、启用、测试完成以及额度不足等通知，邮件通知使用上方的 SMTP 设置</Header.Subheader>
+          </Header>
+          <Form.Group widths={2}>
+            <Form.Input
+              label='Webhook 地址'
+              name='NotifyWebhookURL'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.NotifyWebhookURL}
+              placeholder='以 JSON 格式 POST 通知内容'
+            />
+            <Form.Input
+              label='Webhook 签名密钥'
+              name='NotifyWebhookSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              placeholder='用于 HMAC-SHA256 签名，敏感信息不会发送到前端显示'
+            />
+          </Form.Group>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='Slack Webhook 地址'
+              name='NotifySlackWebhookURL'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.NotifySlackWebhookURL}
+              placeholder='Slack Incoming Webhook 地址'
+            />
+            <Form.Input
+              label='Telegram Bot Token'
+              name='NotifyTelegramBotToken'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              placeholder='敏感信息不会发送到前端显示'
+            />
+            <Form.Input
+              label='Telegram Chat ID'
+              name='NotifyTelegramChatId'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.NotifyTelegramChatId}
+              placeholder='接收通知的会话 ID'
+            />
+          </Form.Group>
+          <Form.Group widths={2}>
+            <Form.Input
+              label='钉钉机器人 Webhook 地址'
+              name='NotifyDingTalkWebhookURL'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.NotifyDingTalkWebhookURL}
+              placeholder='钉钉自定义机器人地址'
+            />
+            <Form.Input
+              label='钉钉机器人加签密钥'
+              name='NotifyDingTalkSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              placeholder='敏感信息不会发送到前端显示'
+            />
+          </Form.Group>
+          <Form.Group widths={2}>
+            <Form.Input
+              label='飞书机器人 Webhook 地址'
+              name='NotifyFeishuWebhookURL'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.NotifyFeishuWebhookURL}
+              placeholder='飞书自定义机器人地址'
+            />
+            <Form.Input
+              label='飞书机器人签名密钥'
+              name='NotifyFeishuSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              placeholder='敏感信息不会发送到前端显示'
+            />
+          </Form.Group>
+          <Form.Group widths={2}>
+            <Form.Input
+              label='企业微信机器人 Webhook 地址'
+              name='NotifyWeComWebhookURL'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.NotifyWeComWebhookURL}
+              placeholder='企业微信群机器人地址'
+            />
+          </Form.Group>
+          <Form.Group widths='equal'>
+            <Form.TextArea
+              label='通知路由'
+              name='NotificationRouting'
+              onChange={handleInputChange}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+              value={inputs.NotificationRouting}
+              placeholder='为一个 JSON 文本，键为事件，值为通知渠道列表，可选 email、webhook、slack、telegram、dingtalk、feishu、wecom'
+            />
+          </Form.Group>
+          <Form.Button onClick={submitNotification}>保存通知设置</Form.Button>
+          <Divider />
           <Header as='h3'>
             配置 GitHub OAuth App
             <Header.Subheader>
@@ -528,6 +686,66 @@ const SystemSetting = () => {
           <Form.Button onClick={submitTurnstile}>
             保存 Turnstile 设置
           </Form.Button>
+          <Divider />
+          <Header as='h3'>
+            配置在线支付
+            <Header.Subheader>
+              用户以 ＄1 额度为单位充值，单价为每单位额度的价格；Stripe 的 Webhook 地址为 {inputs.ServerAddress}/api/payment/webhook/stripe，需要订阅 checkout.session 相关事件
+            </Header.Subheader>
+          </Header>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='货币'
+              name='PaymentCurrency'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.PaymentCurrency}
+              placeholder='例如：usd、jpy'
+            />
+            <Form.Input
+              label='单价'
+              name='PaymentPrice'
+              type='number'
+              step='0.01'
+              min='0'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.PaymentPrice}
+              placeholder='每单位额度的价格'
+            />
+            <Form.Input
+              label='最低充值数量'
+              name='PaymentMinTopUp'
+              type='number'
+              min='1'
+              onChange={handleInputChange}
+              autoComplete='new-password'
+              value={inputs.PaymentMinTopUp}
+            />
+          </Form.Group>
+          <Form.Group widths={3}>
+            <Form.Input
+              label='Stripe Secret Key'
+              name='StripeSecretKey'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              value={inputs.StripeSecretKey}
+              placeholder='敏感信息不会发送到前端显示'
+            />
+            <Form.Input
+              label='Stripe Webhook Secret'
+              name='StripeWebhookSecret'
+              onChange={handleInputChange}
+              type='password'
+              autoComplete='new-password'
+              value={inputs.StripeWebhookSecret}
+              placeholder='敏感信息不会发送到前端显示'
+            />
+          </Form.Group>
+          <Form.Button onClick={submitPayment}>
+            保存在线支付设置
+          </Form.Button>
         </Form>
       </Grid.Column>
     </Grid>
@@ -0,0 +1,249 @@
+import React, { useEffect, useState } from 'react';
+import { Button, Divider, Form, Header, Label, Table } from 'semantic-ui-react';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
+
+const originSubscription = {
+  id: 0,
+  name: '',
+  url: '',
+  secret: '',
+  events: [],
+  status: 1,
+  sample_rate: 1
+};
+
+function renderDeliveryStatus(status) {
+  switch (status) {
+    case 1:
+      return <Label basic color='yellow'>等待投递</Label>;
+    case 2:
+      return <Label basic color='green'>投递成功</Label>;
+    case 3:
+      return <Label basic color='red'>投递失败</Label>;
+    default:
+      return <Label basic color='grey'>未知状态</Label>;
+  }
+}
+
+const WebhookSetting = () => {
+  const [subscriptions, setSubscriptions] = useState([]);
+  const [deliveries, setDeliveries] = useState([]);
+  const [events, setEvents] = useState([]);
+  const [inputs, setInputs] = useState(originSubscription);
+  const [loading, setLoading] = useState(false);
+
+  const loadSubscriptions = async () => {
+    const res = await API.get('/api/webhook/');
+    const { success, message, data, events } = res.data;
+    if (success) {
+      setSubscriptions(data);
+      setEvents(['*', ...events]);
+    } else {
+      showError(message);
+    }
+  };
+
+  const loadDeliveries = async () => {
+    const res = await API.get('/api/webhook/delivery?p=0');
+    const { success, message, data } = res.data;
+    if (success) {
+      setDeliveries(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    loadSubscriptions().then();
+    loadDeliveries().then();
+  }, []);
+
+  const handleInputChange = (e, { name, value }) => {
+    setInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+
+  const submit = async () => {
+    setLoading(true);
+    const subscription = {
+      ...inputs,
+      events: inputs.events.join(','),
+      sample_rate: parseFloat(inputs.sample_rate) || 1
+    };
+    let res;
+    if (inputs.id) {
+      res = await API.put('/api/webhook/', subscription);
+    } else {
+      res = await API.post('/api/webhook/', subscription);
+    }
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('保存成功！');
+      setInputs(originSubscription);
+      await loadSubscriptions();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const editSubscription = (subscription) => {
+    setInputs({
+      ...subscription,
+      events: subscription.events.split(',').filter((event) => event !== '')
+    });
+  };
+
+  const toggleSubscription = async (subscription) => {
+    const res = await API.put('/api/webhook/', {
+      ...subscription,
+      status: subscription.status === 1 ? 2 : 1
+    });
+    const { success, message } = res.data;
+    if (success) {
+      await loadSubscriptions();
+    } else {
+      showError(message);
+    }
+  };
+
+  const deleteSubscription = async (id) => {
+    const res = await API.delete(`/api/webhook/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('删除成功！');
+      await loadSubscriptions();
+    } else {
+      showError(message);
+    }
+  };
+
+  const retryDelivery = async (id) => {
+    const res = await API.post(`/api/webhook/delivery/${id}/retry`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('已重新加入投递队列！');
+      await loadDeliveries();
+    } else {
+      showError(message);
+    }
+  };
+
+  return (
+    <div>
+      <Header as='h3'>
+        事件订阅
+        <Header.Subheader>
+          事件将以 JSON 格式 POST 到订阅地址，签名位于 X-One-API-Signature 请求头，为 HMAC-SHA256(密钥, 时间戳 + "." + 请求体) 的十六进制编码，时间戳位于 X-One-API-Timestamp 请求头；投递失败时将按指数退避重试
+        </Header.Subheader>
+      </Header>
+      <Form loading={loading}>
+        <Form.Group widths='equal'>
+          <Form.Input label='名称' name='name' value={inputs.name} onChange={handleInputChange} />
+          <Form.Input label='地址' name='url' value={inputs.url} onChange={handleInputChange} placeholder='https://' />
+          <Form.Input
+            label='签名密钥'
+            name='secret'
+            type='password'
+            value={inputs.secret}
+            onChange={handleInputChange}
+            autoComplete='new-password'
+          />
+        </Form.Group>
+        <Form.Group widths='equal'>
+          <Form.Dropdown
+            label='事件'
+            name='events'
+            fluid
+            multiple
+            selection
+            options={events.map((event) => ({ key: event, text: event === '*' ? '全部事件' : event, value: event }))}
+            value={inputs.events}
+            onChange={handleInputChange}
+          />
+          <Form.Input
+            label='消费日志采样率'
+            name='sample_rate'
+            type='number'
+            min='0'
+            max='1'
+            step='0.01'
+            value={inputs.sample_rate}
+            onChange={handleInputChange}
+            placeholder='0 到 1 之间，仅对 log.consume 事件生效'
+          />
+        </Form.Group>
+        <Button onClick={submit}>{inputs.id ? '更新订阅' : '添加订阅'}</Button>
+        {inputs.id ? <Button onClick={() => setInputs(originSubscription)}>取消编辑</Button> : null}
+      </Form>
+      <Table basic compact size='small'>
+        <Table.Header>
+          <Table.Row>
+            <Table.HeaderCell>ID</Table.HeaderCell>
+            <Table.HeaderCell>名称</Table.HeaderCell>
+            <Table.HeaderCell>地址</Table.HeaderCell>
+            <Table.HeaderCell>事件</Table.HeaderCell>
+            <Table.HeaderCell>状态</Table.HeaderCell>
+            <Table.HeaderCell>操作</Table.HeaderCell>
+          </Table.Row>
+        </Table.Header>
+        <Table.Body>
+          {subscriptions.map((subscription) => (
+            <Table.Row key={subscription.id}>
+              <Table.Cell>{subscription.id}</Table.Cell>
+              <Table.Cell>{subscription.name}</Table.Cell>
+              <Table.Cell>{subscription.url}</Table.Cell>
+              <Table.Cell>{subscription.events}</Table.Cell>
+              <Table.Cell>
+                {subscription.status === 1 ? <Label basic color='green'>已启用</Label> : <Label basic color='red'>已禁用</Label>}
+              </Table.Cell>
+              <Table.Cell>
+                <Button size='small' onClick={() => editSubscription(subscription)}>编辑</Button>
+                <Button size='small' onClick={() => toggleSubscription(subscription)}>
+                  {subscription.status === 1 ? '禁用' : '启用'}
+                </Button>
+                <Button size='small' negative onClick={() => deleteSubscription(subscription.id)}>删除</Button>
+              </Table.Cell>
+            </Table.Row>
+          ))}
+        </Table.Body>
+      </Table>
+      <Divider />
+      <Header as='h3'>最近投递</Header>
+      <Button size='small' onClick={loadDeliveries}>刷新</Button>
+      <Table basic compact size='small'>
+        <Table.Header>
+          <Table.Row>
+            <Table.HeaderCell>ID</Table.HeaderCell>
+            <Table.HeaderCell>订阅</Table.HeaderCell>
+            <Table.HeaderCell>事件</Table.HeaderCell>
+            <Table.HeaderCell>状态</Table.HeaderCell>
+            <Table.HeaderCell>尝试次数</Table.HeaderCell>
+            <Table.HeaderCell>创建时间</Table.HeaderCell>
+            <Table.HeaderCell>错误</Table.HeaderCell>
+            <Table.HeaderCell>操作</Table.HeaderCell>
+          </Table.Row>
+        </Table.Header>
+        <Table.Body>
+          {deliveries.map((delivery) => (
+            <Table.Row key={delivery.id}>
+              <Table.Cell>{delivery.id}</Table.Cell>
+              <Table.Cell>{delivery.subscription_id}</Table.Cell>
+              <Table.Cell>{delivery.event}</Table.Cell>
+              <Table.Cell>{renderDeliveryStatus(delivery.status)}</Table.Cell>
+              <Table.Cell>{delivery.attempts}</Table.Cell>
+              <Table.Cell>{timestamp2string(delivery.created_time)}</Table.Cell>
+              <Table.Cell>{delivery.last_error}</Table.Cell>
+              <Table.Cell>
+                {delivery.status === 3 ? (
+                  <Button size='small' onClick={() => retryDelivery(delivery.id)}>重试</Button>
+                ) : null}
+              </Table.Cell>
+            </Table.Row>
+          ))}
+        </Table.Body>
+      </Table>
+    </div>
+  );
+};
+
+export default WebhookSetting;
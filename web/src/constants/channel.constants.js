@@ -4,6 +4,15 @@ export const CHANNEL_OPTIONS = [
   { key: 3, text: 'Azure OpenAI', value: 3, color: 'olive' },
   { key: 11, text: 'Google PaLM2', value: 11, color: 'orange' },
   { key: 24, text: 'Google Gemini', value: 24, color: 'orange' },
+  { key: 25, text: 'AWS Bedrock', value: 25, color: 'orange' },
+  { key: 26, text: 'Google Vertex AI', value: 26, color: 'blue' },
+  { key: 27, text: 'Ollama', value: 27, color: 'black' },
+  { key: 28, text: 'Cohere', value: 28, color: 'purple' },
+  { key: 29, text: 'Mistral AI', value: 29, color: 'orange' },
+  { key: 30, text: 'DeepSeek', value: 30, color: 'blue' },
+  { key: 31, text: 'Moonshot AI', value: 31, color: 'black' },
+  { key: 32, text: 'Groq', value: 32, color: 'orange' },
+  { key: 33, text: 'SiliconFlow', value: 33, color: 'purple' },
   { key: 15, text: '百度文心千帆', value: 15, color: 'blue' },
   { key: 17, text: '阿里通义千问', value: 17, color: 'orange' },
   { key: 18, text: '讯飞星火认知', value: 18, color: 'blue' },
@@ -10,6 +10,11 @@ const MODEL_MAPPING_EXAMPLE = {
   'gpt-4-32k-0314': 'gpt-4-32k'
 };
 
+const COST_PRICES_EXAMPLE = {
+  'gpt-4o': { input: 2.5, output: 10, cached_input: 1.25 },
+  'dall-e-3': { input: 0, output: 0, per_request: 0.04 }
+};
+
 function type2secretPrompt(type) {
   // inputs.type === 15 ? '按照如下格式输入：APIKey|SecretKey' : (inputs.type === 18 ? '按照如下格式输入：APPID|APISecret|APIKey' : '请输入渠道对应的鉴权密钥')
   switch (type) {
@@ -20,7 +25,13 @@ function type2secretPrompt(type) {
     case 22:
       return '按照如下格式输入：APIKey-AppId，例如：fastgpt-0sp2gtvfdgyi4k30jwlgwf1i-64f335d84283f05518e9e041';
     case 23:
-      return '按照如下格式输入：AppId|SecretId|SecretKey';
+      return '按照如下格式输入：SecretId|SecretKey，旧版混元接口的渠道请输入：AppId|SecretId|SecretKey';
+    case 25:
+      return '按照如下格式输入：AccessKeyId|SecretAccessKey|Region';
+    case 26:
+      return '请输入服务账号的 JSON 密钥文件内容';
+    case 27:
+      return 'Ollama 默认无需鉴权，可任意填写，部署在需要鉴权的反向代理之后时请输入对应的密钥';
     default:
       return '请输入渠道对应的鉴权密钥';
   }
@@ -43,6 +54,10 @@ const EditChannel = () => {
     base_url: '',
     other: '',
     model_mapping: '',
+    test_model: '',
+    balance_threshold: 0,
+    cost_ratio: 1,
+    cost_prices: '',
     models: [],
     groups: ['default']
   };
@@ -60,31 +75,55 @@ const EditChannel = () => {
       let localModels = [];
       switch (value) {
         case 14:
-          localModels = ['claude-instant-1', 'claude-2', 'claude-2.0', 'claude-2.1'];
+          localModels = ['claude-instant-1', 'claude-2', 'claude-2.0', 'claude-2.1', 'claude-3-haiku-20240307', 'claude-3-sonnet-20240229', 'claude-3-opus-20240229'];
           break;
         case 11:
           localModels = ['PaLM-2'];
           break;
         case 15:
-          localModels = ['ERNIE-Bot', 'ERNIE-Bot-turbo', 'ERNIE-Bot-4', 'Embedding-V1'];
+          localModels = ['ERNIE-4.0-8K', 'ERNIE-4.0-Turbo-8K', 'ERNIE-3.5-8K', 'ERNIE-Speed-8K', 'ERNIE-Speed-128K', 'ERNIE-Lite-8K', 'ERNIE-Tiny-8K', 'ERNIE-Character-8K', 'ERNIE-Bot', 'ERNIE-Bot-turbo', 'ERNIE-Bot-4', 'Embedding-V1', 'bge-large-zh', 'bge-large-en', 'tao-8k'];
           break;
         case 17:
-          localModels = ['qwen-turbo', 'qwen-plus', 'qwen-max', 'qwen-max-longcontext', 'text-embedding-v1'];
+          localModels = ['qwen-turbo', 'qwen-plus', 'qwen-max', 'qwen-max-longcontext', 'qwen-vl-plus', 'qwen-vl-max', 'text-embedding-v1', 'text-embedding-v2', 'gte-rerank'];
           break;
         case 16:
-          localModels = ['chatglm_turbo', 'chatglm_pro', 'chatglm_std', 'chatglm_lite'];
+          localModels = ['chatglm_turbo', 'chatglm_pro', 'chatglm_std', 'chatglm_lite', 'glm-4', 'glm-3-turbo', 'glm-4v', 'embedding-2', 'text_embedding'];
           break;
         case 18:
-          localModels = ['SparkDesk'];
+          localModels = ['SparkDesk', 'SparkDesk-v1.1', 'SparkDesk-v2.1', 'SparkDesk-v3.1', 'SparkDesk-pro-128k', 'SparkDesk-v3.5', 'SparkDesk-v4.0', 'xunfei-embedding'];
           break;
         case 19:
           localModels = ['360GPT_S2_V9', 'embedding-bert-512-v1', 'embedding_s1_v1', 'semantic_similarity_s1_v1'];
           break;
         case 23:
-          localModels = ['hunyuan'];
+          localModels = ['hunyuan-lite', 'hunyuan-standard', 'hunyuan-standard-256K', 'hunyuan-pro', 'hunyuan', 'hunyuan-embedding', 'tencent-tts', 'tencent-asr'];
           break;
         case 24:
-          localModels = ['gemini-pro'];
+          localModels = ['gemini-pro', 'gemini-pro-vision', 'embedding-001', 'text-embedding-004'];
+          break;
+        case 25:
+          localModels = ['claude-instant-1', 'claude-2.1', 'claude-3-haiku-20240307', 'claude-3-sonnet-20240229', 'claude-3-opus-20240229', 'llama2-13b-chat', 'llama2-70b-chat', 'mistral-7b-instruct', 'mixtral-8x7b-instruct', 'mistral-large', 'titan-text-lite', 'titan-text-express'];
+          break;
+        case 26:
+          localModels = ['gemini-pro', 'gemini-pro-vision', 'claude-3-haiku-20240307', 'claude-3-sonnet-20240229', 'claude-3-opus-20240229'];
+          break;
+        case 28:
+          localModels = ['command', 'command-light', 'command-r', 'command-r-plus', 'embed-english-v3.0', 'embed-multilingual-v3.0', 'rerank-english-v3.0', 'rerank-multilingual-v3.0'];
+          break;
+        case 29:
+          localModels = ['open-mistral-7b', 'open-mixtral-8x7b', 'open-mixtral-8x22b', 'mistral-small-latest', 'mistral-medium-latest', 'mistral-large-latest', 'mistral-embed'];
+          break;
+        case 30:
+          localModels = ['deepseek-chat', 'deepseek-coder'];
+          break;
+        case 31:
+          localModels = ['moonshot-v1-8k', 'moonshot-v1-32k', 'moonshot-v1-128k'];
+          break;
+        case 32:
+          localModels = ['llama3-8b-8192', 'llama3-70b-8192', 'mixtral-8x7b-32768', 'gemma-7b-it'];
+          break;
+        case 33:
+          localModels = ['deepseek-ai/DeepSeek-V2-Chat', 'Qwen/Qwen2-72B-Instruct'];
           break;
       }
       setInputs((inputs) => ({ ...inputs, models: localModels }));
@@ -108,6 +147,9 @@ const EditChannel = () => {
       if (data.model_mapping !== '') {
         data.model_mapping = JSON.stringify(JSON.parse(data.model_mapping), null, 2);
       }
+      if (data.cost_prices) {
+        data.cost_prices = JSON.stringify(JSON.parse(data.cost_prices), null, 2);
+      }
       setInputs(data);
     } else {
       showError(message);
@@ -181,6 +223,10 @@ const EditChannel = () => {
       showInfo('模型映射必须是合法的 JSON 格式！');
       return;
     }
+    if (inputs.cost_prices && !verifyJSON(inputs.cost_prices)) {
+      showInfo('上游价格必须是合法的 JSON 格式！');
+      return;
+    }
     let localInputs = inputs;
     if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
       localInputs.base_url = localInputs.base_url.slice(0, localInputs.base_url.length - 1);
@@ -191,6 +237,11 @@ const EditChannel = () => {
     if (localInputs.type === 18 && localInputs.other === '') {
       localInputs.other = 'v2.1';
     }
+    localInputs.balance_threshold = parseFloat(localInputs.balance_threshold) || 0;
+    localInputs.cost_ratio = parseFloat(localInputs.cost_ratio);
+    if (isNaN(localInputs.cost_ratio)) {
+      localInputs.cost_ratio = 1;
+    }
     let res;
     localInputs.models = localInputs.models.join(',');
     localInputs.group = localInputs.groups.join(',');
@@ -212,6 +263,17 @@ const EditChannel = () => {
     }
   };
 
+  const fetchUpstreamModels = async () => {
+    const res = await API.get(`/api/channel/fetch_models/${channelId}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      handleInputChange(null, { name: 'models', value: data });
+      showSuccess(`已从上游获取 ${data.length} 个模型`);
+    } else {
+      showError(message);
+    }
+  };
+
   const addCustomModel = () => {
     if (customModel.trim() === '') return;
     if (inputs.models.includes(customModel)) return;
@@ -318,13 +380,41 @@ const EditChannel = () => {
               options={groupOptions}
             />
           </Form.Field>
+          {
+            inputs.type === 16 && (
+              <Form.Field>
+                <Form.Input
+                  label='接口版本'
+                  name='other'
+                  placeholder={'请输入接口版本，留空则使用 v3 接口，填写 v4 则使用 GLM-4 的 OpenAI 兼容接口'}
+                  onChange={handleInputChange}
+                  value={inputs.other}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )
+          }
+          {
+            inputs.type === 23 && (
+              <Form.Field>
+                <Form.Input
+                  label='地域'
+                  name='other'
+                  placeholder={'请输入地域，例如：ap-beijing，留空则使用 ap-guangzhou'}
+                  onChange={handleInputChange}
+                  value={inputs.other}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )
+          }
           {
             inputs.type === 18 && (
               <Form.Field>
                 <Form.Input
                   label='模型版本'
                   name='other'
-                  placeholder={'请输入星火大模型版本，注意是接口地址中的版本号，例如：v2.1'}
+                  placeholder={'请输入星火大模型版本，注意是接口地址中的版本号，例如：v3.5，Pro-128K 请输入 pro-128k；使用 SparkDesk-v3.5 等模型名时以模型名中的版本为准'}
                   onChange={handleInputChange}
                   value={inputs.other}
                   autoComplete='new-password'
@@ -346,6 +436,20 @@ const EditChannel = () => {
               </Form.Field>
             )
           }
+          {
+            inputs.type === 26 && (
+              <Form.Field>
+                <Form.Input
+                  label='区域'
+                  name='other'
+                  placeholder={'请输入 Vertex AI 的区域，例如：us-central1，留空则使用 us-central1'}
+                  onChange={handleInputChange}
+                  value={inputs.other}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )
+          }
           {
             inputs.type === 17 && (
               <Form.Field>
@@ -385,6 +489,11 @@ const EditChannel = () => {
             <Button type={'button'} onClick={() => {
               handleInputChange(null, { name: 'models', value: [] });
             }}>清除所有模型</Button>
+            {
+              isEdit && (
+                <Button type={'button'} onClick={fetchUpstreamModels}>从上游获取模型</Button>
+              )
+            }
             <Input
               action={
                 <Button type={'button'} onClick={addCustomModel}>填入</Button>
@@ -413,6 +522,52 @@ const EditChannel = () => {
               autoComplete='new-password'
             />
           </Form.Field>
+          <Form.Field>
+            <Form.Input
+              label='测试模型'
+              name='test_model'
+              placeholder={'此项可选，用于渠道测试，留空则使用模型列表中的第一个对话模型'}
+              onChange={handleInputChange}
+              value={inputs.test_model || ''}
+              autoComplete='new-password'
+            />
+          </Form.Field>
+          <Form.Field>
+            <Form.Input
+              label='余额预警阈值'
+              name='balance_threshold'
+              type='number'
+              min='0'
+              placeholder={'此项可选，余额低于此值时将发送提醒，单位与渠道余额一致'}
+              onChange={handleInputChange}
+              value={inputs.balance_threshold || ''}
+              autoComplete='new-password'
+            />
+          </Form.Field>
+          <Form.Field>
+            <Form.Input
+              label='成本倍率'
+              name='cost_ratio'
+              type='number'
+              min='0'
+              step='0.01'
+              placeholder={'上游价格相对于模型价格的倍率，用于统计渠道成本，默认为 1'}
+              onChange={handleInputChange}
+              value={inputs.cost_ratio === null ? '' : inputs.cost_ratio}
+              autoComplete='new-password'
+            />
+          </Form.Field>
+          <Form.Field>
+            <Form.TextArea
+              label='上游价格'
+              placeholder={`此项可选，用于统计渠道成本，格式与价格设置相同，设置了上游价格的模型不使用成本倍率，例如：\n${JSON.stringify(COST_PRICES_EXAMPLE, null, 2)}`}
+              name='cost_prices'
+              onChange={handleInputChange}
+              value={inputs.cost_prices || ''}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete='new-password'
+            />
+          </Form.Field>
           {
             batch ? <Form.Field>
               <Form.TextArea
@@ -448,7 +603,7 @@ const EditChannel = () => {
             )
           }
           {
-            inputs.type !== 3 && inputs.type !== 8 && inputs.type !== 22 && (
+            inputs.type !== 3 && inputs.type !== 8 && inputs.type !== 22 && inputs.type !== 27 && (
               <Form.Field>
                 <Form.Input
                   label='代理'
@@ -475,6 +630,20 @@ const EditChannel = () => {
               </Form.Field>
             )
           }
+          {
+            inputs.type === 27 && (
+              <Form.Field>
+                <Form.Input
+                  label='服务地址'
+                  name='base_url'
+                  placeholder={'请输入 Ollama 的服务地址，留空则使用 http://localhost:11434'}
+                  onChange={handleInputChange}
+                  value={inputs.base_url}
+                  autoComplete='new-password'
+                />
+              </Form.Field>
+            )
+          }
           <Button onClick={handleCancel}>取消</Button>
           <Button type={isEdit ? 'button' : 'submit'} positive onClick={submit}>提交</Button>
         </Form>
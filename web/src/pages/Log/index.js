@@ -1,10 +1,13 @@
 import React from 'react';
 import { Header, Segment } from 'semantic-ui-react';
 import LogsTable from '../../components/LogsTable';
+import MarginReport from '../../components/MarginReport';
+import { isAdmin } from '../../helpers';
 
 const Token = () => (
   <>
     <LogsTable />
+    {isAdmin() && <MarginReport />}
   </>
 );
 
@@ -5,6 +5,8 @@ import { isRoot } from '../../helpers';
 import OtherSetting from '../../components/OtherSetting';
 import PersonalSetting from '../../components/PersonalSetting';
 import OperationSetting from '../../components/OperationSetting';
+import WebhookSetting from '../../components/WebhookSetting';
+import PlanSetting from '../../components/PlanSetting';
 
 const Setting = () => {
   let panes = [
@@ -27,6 +29,14 @@ const Setting = () => {
         </Tab.Pane>
       )
     });
+    panes.push({
+      menuItem: '套餐设置',
+      render: () => (
+        <Tab.Pane attached={false}>
+          <PlanSetting />
+        </Tab.Pane>
+      )
+    });
     panes.push({
       menuItem: '系统设置',
       render: () => (
@@ -35,6 +45,14 @@ const Setting = () => {
         </Tab.Pane>
       )
     });
+    panes.push({
+      menuItem: '事件订阅',
+      render: () => (
+        <Tab.Pane attached={false}>
+          <WebhookSetting />
+        </Tab.Pane>
+      )
+    });
     panes.push({
       menuItem: '其他设置',
       render: () => (
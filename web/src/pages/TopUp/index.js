@@ -1,12 +1,15 @@
 import React, { useEffect, useState } from 'react';
-import { Button, Form, Grid, Header, Segment, Statistic } from 'semantic-ui-react';
-import { API, showError, showInfo, showSuccess } from '../../helpers';
+import { Button, Divider, Form, Grid, Header, Segment, Statistic } from 'semantic-ui-react';
+import { API, isAdmin, showError, showInfo, showSuccess, timestamp2string } from '../../helpers';
 import { renderQuota } from '../../helpers/render';
 
 const TopUp = () => {
   const [redemptionCode, setRedemptionCode] = useState('');
   const [topUpLink, setTopUpLink] = useState('');
   const [userQuota, setUserQuota] = useState(0);
+  const [userPlan, setUserPlan] = useState(null);
+  const [payment, setPayment] = useState({ providers: [], price: 0, currency: '', minTopUp: 1 });
+  const [payAmount, setPayAmount] = useState(1);
   const [isSubmitting, setIsSubmitting] = useState(false);
 
   const topUp = async () => {
@@ -36,6 +39,30 @@ const TopUp = () => {
     }
   };
 
+  const pay = async (provider) => {
+    if (payAmount < payment.minTopUp) {
+      showInfo(`充值数量不能小于 ${payment.minTopUp}`);
+      return;
+    }
+    setIsSubmitting(true);
+    try {
+      const res = await API.post('/api/user/order', {
+        provider,
+        amount: parseInt(payAmount)
+      });
+      const { success, message, data } = res.data;
+      if (success) {
+        window.location.href = data.url;
+      } else {
+        showError(message);
+      }
+    } catch (err) {
+      showError('请求失败');
+    } finally {
+      setIsSubmitting(false);
+    }
+  };
+
   const openTopUpLink = () => {
     if (!topUpLink) {
       showError('超级管理员未设置充值链接！');
@@ -54,6 +81,16 @@ const TopUp = () => {
     }
   }
 
+  const getUserPlan = async () => {
+    let res = await API.get(`/api/user/plan`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setUserPlan(data);
+    } else {
+      showError(message);
+    }
+  };
+
   useEffect(() => {
     let status = localStorage.getItem('status');
     if (status) {
@@ -61,8 +98,22 @@ const TopUp = () => {
       if (status.top_up_link) {
         setTopUpLink(status.top_up_link);
       }
+      if (status.payment_providers) {
+        setPayment({
+          // the fake provider is only for admins
+          providers: status.payment_providers.filter((provider) => provider !== 'fake' || isAdmin()),
+          price: status.payment_price,
+          currency: status.payment_currency,
+          minTopUp: status.payment_min_top_up
+        });
+        setPayAmount(status.payment_min_top_up || 1);
+      }
+    }
+    if (new URLSearchParams(window.location.search).get('trade_no')) {
+      showInfo('支付完成后额度将自动到账，如未到账请稍后刷新页面');
     }
     getUserQuota().then();
+    getUserPlan().then();
   }, []);
 
   return (
@@ -86,6 +137,27 @@ const TopUp = () => {
                 {isSubmitting ? '兑换中...' : '兑换'}
             </Button>
           </Form>
+          {payment.providers.length > 0 && (
+            <>
+              <Divider />
+              <Form>
+                <Form.Input
+                  label={`在线充值数量（单位：＄1 额度），需支付 ${(payAmount * payment.price).toFixed(2)} ${payment.currency.toUpperCase()}`}
+                  type='number'
+                  min={payment.minTopUp}
+                  value={payAmount}
+                  onChange={(e) => {
+                    setPayAmount(e.target.value);
+                  }}
+                />
+                {payment.providers.map((provider) => (
+                  <Button key={provider} color='blue' onClick={() => pay(provider)} disabled={isSubmitting}>
+                    {provider === 'stripe' ? 'Stripe 支付' : provider === 'fake' ? '模拟支付' : provider}
+                  </Button>
+                ))}
+              </Form>
+            </>
+          )}
         </Grid.Column>
         <Grid.Column>
           <Statistic.Group widths='one'>
@@ -94,6 +166,12 @@ const TopUp = () => {
               <Statistic.Label>剩余额度</Statistic.Label>
             </Statistic>
           </Statistic.Group>
+          {userPlan && (
+            <p style={{ textAlign: 'center' }}>
+              当前套餐：{userPlan.plan.name}，每{userPlan.plan.period === 'day' ? '天' : '月'}额度 {renderQuota(userPlan.plan.quota)}，
+              下次发放时间：{timestamp2string(userPlan.next_reset_time)}，到期时间：{userPlan.end_time ? timestamp2string(userPlan.end_time) : '永久'}
+            </p>
+          )}
         </Grid.Column>
       </Grid>
     </Segment>
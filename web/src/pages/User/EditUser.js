@@ -1,7 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import { Button, Form, Header, Segment } from 'semantic-ui-react';
 import { useParams, useNavigate } from 'react-router-dom';
-import { API, showError, showSuccess } from '../../helpers';
+import { API, showError, showSuccess, timestamp2string } from '../../helpers';
 import { renderQuota, renderQuotaWithPrompt } from '../../helpers/render';
 
 const EditUser = () => {
@@ -19,6 +19,13 @@ const EditUser = () => {
     group: 'default'
   });
   const [groupOptions, setGroupOptions] = useState([]);
+  const [planOptions, setPlanOptions] = useState([]);
+  const [userPlan, setUserPlan] = useState(null);
+  const [planInputs, setPlanInputs] = useState({
+    plan_id: 0,
+    start_time: '',
+    end_time: ''
+  });
   const { username, display_name, password, github_id, wechat_id, email, quota, group } =
     inputs;
   const handleInputChange = (e, { name, value }) => {
@@ -36,6 +43,50 @@ const EditUser = () => {
       showError(error.message);
     }
   };
+  const fetchPlans = async () => {
+    let res = await API.get(`/api/plan/`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setPlanOptions([{ key: 0, text: '无套餐', value: 0 }, ...data.map((plan) => ({
+        key: plan.id,
+        text: plan.name,
+        value: plan.id,
+      }))]);
+    } else {
+      showError(message);
+    }
+  };
+  const loadUserPlan = async () => {
+    let res = await API.get(`/api/plan/user/${userId}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setUserPlan(data);
+      if (data) {
+        setPlanInputs((inputs) => ({ ...inputs, plan_id: data.plan.id }));
+      }
+    } else {
+      showError(message);
+    }
+  };
+  const handlePlanInputChange = (e, { name, value }) => {
+    setPlanInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+  const submitPlan = async () => {
+    const res = await API.post(`/api/plan/user`, {
+      user_id: parseInt(userId),
+      plan_id: planInputs.plan_id,
+      start_time: planInputs.start_time ? Date.parse(planInputs.start_time) / 1000 : 0,
+      end_time: planInputs.end_time ? Date.parse(planInputs.end_time) / 1000 : 0
+    });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('用户套餐更新成功！');
+      await loadUserPlan();
+      await loadUser();
+    } else {
+      showError(message);
+    }
+  };
   const navigate = useNavigate();
   const handleCancel = () => {
     navigate("/setting");
@@ -60,6 +111,8 @@ const EditUser = () => {
     loadUser().then();
     if (userId) {
       fetchGroups().then();
+      fetchPlans().then();
+      loadUserPlan().then();
     }
   }, []);
 
@@ -183,6 +236,42 @@ const EditUser = () => {
           <Button positive onClick={submit}>提交</Button>
         </Form>
       </Segment>
+      {
+        userId && <Segment>
+          <Header as='h3'>用户套餐</Header>
+          <p>
+            {userPlan ? `当前套餐：${userPlan.plan.name}，下次额度发放时间：${timestamp2string(userPlan.next_reset_time)}，到期时间：${userPlan.end_time ? timestamp2string(userPlan.end_time) : '永久'}` : '当前没有套餐'}
+          </p>
+          <Form>
+            <Form.Group widths='equal'>
+              <Form.Dropdown
+                label='套餐'
+                name='plan_id'
+                fluid
+                selection
+                options={planOptions}
+                value={planInputs.plan_id}
+                onChange={handlePlanInputChange}
+              />
+              <Form.Input
+                label='开始时间'
+                name='start_time'
+                type='datetime-local'
+                value={planInputs.start_time}
+                onChange={handlePlanInputChange}
+              />
+              <Form.Input
+                label='到期时间'
+                name='end_time'
+                type='datetime-local'
+                value={planInputs.end_time}
+                onChange={handlePlanInputChange}
+              />
+            </Form.Group>
+            <Button positive onClick={submitPlan}>{planInputs.plan_id ? '设置套餐' : '取消套餐'}</Button>
+          </Form>
+        </Segment>
+      }
     </>
   );
 };